@@ -0,0 +1,273 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/path"
+	"github.com/factorysh/density/store"
+	"github.com/google/uuid"
+)
+
+// Bucket of the store
+const Bucket = "apikeys"
+
+// Prefix of the keys, they look like dk_<id>_<secret>
+const Prefix = "dk_"
+
+// lastUsedPrecision limits the writes of the last use of a key
+const lastUsedPrecision = time.Minute
+
+// ErrUnknownKey is returned when deleting a key that doesn't exist
+var ErrUnknownKey = errors.New("Unknown API key")
+
+// ErrInvalidKey is returned for a wrong, unknown or expired key
+var ErrInvalidKey = errors.New("Invalid API key")
+
+// ErrNotGranted is returned when a key would have a scope or a group its creator doesn't have
+var ErrNotGranted = errors.New("Not granted")
+
+var isOwnerValid = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`).MatchString
+
+// APIKey is a static key of a service account. Only the hash of its secret is stored.
+type APIKey struct {
+	Id       uuid.UUID  `json:"id"`
+	Name     string     `json:"name"`
+	Owner    string     `json:"owner"`
+	Scopes   []string   `json:"scopes,omitempty"` // The scopes of the user role if empty
+	Groups   []string   `json:"groups,omitempty"`
+	Path     string     `json:"path,omitempty"` // Glob of the readable volume files
+	Hash     string     `json:"hash,omitempty"`
+	Created  time.Time  `json:"created"`
+	Expires  *time.Time `json:"expires,omitempty"` // Never expires if nil
+	LastUsed *time.Time `json:"last_used,omitempty"`
+}
+
+// Validate a new key
+func (k *APIKey) Validate() error {
+	if !isOwnerValid(k.Owner) {
+		return fmt.Errorf("Invalid owner: %s", k.Owner)
+	}
+	for _, group := range k.Groups {
+		if !isOwnerValid(group) {
+			return fmt.Errorf("Invalid group: %s", group)
+		}
+	}
+	for _, scope := range k.Scopes {
+		if !owner.IsScope(scope) {
+			return fmt.Errorf("Unknown scope: %s", scope)
+		}
+	}
+	if k.Expires != nil && k.Expires.Before(time.Now()) {
+		return errors.New("The key is already expired")
+	}
+	return nil
+}
+
+// GrantedBy checks that the creator of the key has its scopes and its groups.
+// A key without scopes has the scopes of the user role.
+func (k *APIKey) GrantedBy(u *owner.Owner) error {
+	scopes := k.Scopes
+	if len(scopes) == 0 {
+		scopes = owner.Roles[owner.RoleUser]
+	}
+	for _, scope := range scopes {
+		if !u.Can(scope) {
+			return fmt.Errorf("%w: scope %s", ErrNotGranted, scope)
+		}
+	}
+	for _, group := range k.Groups {
+		if !u.Admin && !u.Owns(group) {
+			return fmt.Errorf("%w: group %s", ErrNotGranted, group)
+		}
+	}
+	return nil
+}
+
+// Expired is true after its expiry
+func (k *APIKey) Expired(now time.Time) bool {
+	return k.Expires != nil && !now.Before(*k.Expires)
+}
+
+// Identity of the key, its owner and path
+func (k *APIKey) Identity() (*owner.Owner, path.Path) {
+	u := &owner.Owner{
+		Name:   k.Owner,
+		Groups: k.Groups,
+	}
+	if len(k.Scopes) > 0 {
+		u.Scopes = k.Scopes
+	}
+	return u, path.Path(k.Path)
+}
+
+// IsKey is true for a token looking like an API key, not a JWT
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, Prefix)
+}
+
+// parse a key, its id and the hash of its secret
+func parse(key string) (uuid.UUID, string, error) {
+	parts := strings.Split(strings.TrimPrefix(key, Prefix), "_")
+	if !IsKey(key) || len(parts) != 2 {
+		return uuid.Nil, "", ErrInvalidKey
+	}
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil {
+		return uuid.Nil, "", ErrInvalidKey
+	}
+	id, err := uuid.FromBytes(raw)
+	if err != nil {
+		return uuid.Nil, "", ErrInvalidKey
+	}
+	return id, hash(parts[1]), nil
+}
+
+func hash(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(h[:])
+}
+
+// Keys stores APIKey
+type Keys struct {
+	store store.Store
+	lock  sync.Mutex
+}
+
+// NewKeys uses a store
+func NewKeys(s store.Store) *Keys {
+	return &Keys{store: s}
+}
+
+// Create a key for its creator, the key is only returned here
+func (k *Keys) Create(creator *owner.Owner, key *APIKey) (string, error) {
+	err := key.Validate()
+	if err != nil {
+		return "", err
+	}
+	err = key.GrantedBy(creator)
+	if err != nil {
+		return "", err
+	}
+	key.Id, err = uuid.NewRandom()
+	if err != nil {
+		return "", err
+	}
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	raw := hex.EncodeToString(secret)
+	key.Hash = hash(raw)
+	key.Created = time.Now()
+	key.LastUsed = nil
+	err = k.put(key)
+	if err != nil {
+		return "", err
+	}
+	return Prefix + hex.EncodeToString(key.Id[:]) + "_" + raw, nil
+}
+
+func (k *Keys) put(key *APIKey) error {
+	value, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return k.store.Put([]byte(key.Id.String()), value)
+}
+
+// Get a key, nil if it doesn't exist
+func (k *Keys) Get(id uuid.UUID) (*APIKey, error) {
+	v, err := k.store.Get([]byte(id.String()))
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, nil
+	}
+	var key APIKey
+	err = json.Unmarshal(v, &key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Delete a key
+func (k *Keys) Delete(id uuid.UUID) error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	key, err := k.Get(id)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return ErrUnknownKey
+	}
+	return k.store.Delete([]byte(id.String()))
+}
+
+// List all keys, sorted by owner and name
+func (k *Keys) List() ([]*APIKey, error) {
+	keys := make([]*APIKey, 0)
+	err := k.store.ForEach(func(_, v []byte) error {
+		var key APIKey
+		err := json.Unmarshal(v, &key)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, &key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Owner != keys[j].Owner {
+			return keys[i].Owner < keys[j].Owner
+		}
+		return keys[i].Name < keys[j].Name
+	})
+	return keys, nil
+}
+
+// Authenticate a key, and record its use
+func (k *Keys) Authenticate(raw string) (*APIKey, error) {
+	id, h, err := parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	key, err := k.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || subtle.ConstantTimeCompare([]byte(key.Hash), []byte(h)) != 1 {
+		return nil, ErrInvalidKey
+	}
+	now := time.Now()
+	if key.Expired(now) {
+		return nil, ErrInvalidKey
+	}
+	if key.LastUsed == nil || now.Sub(*key.LastUsed) >= lastUsedPrecision {
+		key.LastUsed = &now
+		err = k.put(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
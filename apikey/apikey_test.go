@@ -0,0 +1,81 @@
+package apikey
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/path"
+	"github.com/factorysh/density/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeys(t *testing.T) {
+	keys := NewKeys(store.NewMemoryStore())
+	root := &owner.Owner{Name: "root", Admin: true}
+
+	key := &APIKey{Name: "cron", Owner: "backup", Scopes: []string{owner.TasksWrite}, Path: "/tmp/*"}
+	raw, err := keys.Create(root, key)
+	assert.NoError(t, err)
+	assert.True(t, IsKey(raw))
+	assert.NotContains(t, key.Hash, raw)
+
+	got, err := keys.Authenticate(raw)
+	assert.NoError(t, err)
+	assert.Equal(t, key.Id, got.Id)
+	assert.NotNil(t, got.LastUsed)
+	u, p := got.Identity()
+	assert.Equal(t, &owner.Owner{Name: "backup", Scopes: []string{owner.TasksWrite}}, u)
+	assert.Equal(t, path.Path("/tmp/*"), p)
+	stored, err := keys.Get(key.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, got.LastUsed.Unix(), stored.LastUsed.Unix())
+
+	for _, wrong := range []string{"plop", "dk_plop_plop", raw + "0", raw[:len(raw)-1] + "x"} {
+		_, err = keys.Authenticate(wrong)
+		assert.Equal(t, ErrInvalidKey, err, wrong)
+	}
+
+	// expired
+	yesterday := time.Now().Add(-24 * time.Hour)
+	_, err = keys.Create(root, &APIKey{Owner: "backup", Expires: &yesterday})
+	assert.Error(t, err)
+	soon := time.Now().Add(time.Hour)
+	old := &APIKey{Owner: "backup", Expires: &soon}
+	oldRaw, err := keys.Create(root, old)
+	assert.NoError(t, err)
+	_, err = keys.Authenticate(oldRaw)
+	assert.NoError(t, err)
+	old.Expires = &yesterday
+	assert.NoError(t, keys.put(old))
+	_, err = keys.Authenticate(oldRaw)
+	assert.Equal(t, ErrInvalidKey, err)
+
+	_, err = keys.Create(root, &APIKey{Owner: "bob/alice"})
+	assert.Error(t, err)
+	_, err = keys.Create(root, &APIKey{Owner: "bob", Scopes: []string{"root"}})
+	assert.Error(t, err)
+
+	// a key can't escalate the privileges of its creator
+	ops := &owner.Owner{Name: "ops", Scopes: []string{owner.AdminKeys, owner.TasksRead, owner.TasksWrite}, Groups: []string{"data"}}
+	_, err = keys.Create(ops, &APIKey{Owner: "backup", Scopes: []string{owner.TasksWriteAny}})
+	assert.True(t, errors.Is(err, ErrNotGranted))
+	_, err = keys.Create(ops, &APIKey{Owner: "backup", Scopes: []string{owner.AdminTokens}})
+	assert.True(t, errors.Is(err, ErrNotGranted))
+	_, err = keys.Create(ops, &APIKey{Owner: "backup", Scopes: []string{owner.TasksRead}, Groups: []string{"finance"}})
+	assert.True(t, errors.Is(err, ErrNotGranted))
+	_, err = keys.Create(ops, &APIKey{Owner: "backup"})
+	assert.True(t, errors.Is(err, ErrNotGranted), "the user role can cancel")
+	_, err = keys.Create(ops, &APIKey{Owner: "backup", Scopes: []string{owner.TasksRead, owner.TasksWrite}, Groups: []string{"data"}})
+	assert.NoError(t, err)
+
+	list, err := keys.List()
+	assert.NoError(t, err)
+	assert.Len(t, list, 3)
+
+	assert.NoError(t, keys.Delete(key.Id))
+	assert.Equal(t, ErrUnknownKey, keys.Delete(key.Id))
+	_, err = keys.Authenticate(raw)
+	assert.Equal(t, ErrInvalidKey, err)
+}
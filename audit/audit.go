@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/factorysh/density/store"
+	"github.com/google/uuid"
+)
+
+// Bucket of the store
+const Bucket = "audit"
+
+// MaxLimit is the largest page of List
+const MaxLimit = 1000
+
+// DefaultMaxAge is the retention of a Log
+const DefaultMaxAge = 365 * 24 * time.Hour
+
+// trimPeriod is the number of appends between two trims
+const trimPeriod = 100
+
+// Outcomes of a request
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+// Entry is a mutating request of the API
+type Entry struct {
+	Id        uuid.UUID `json:"id"`
+	Time      time.Time `json:"time"`
+	Owner     string    `json:"owner"` // Empty if the request has no identity
+	Admin     bool      `json:"admin"`
+	Action    string    `json:"action"` // Method and route, like POST /api/tasks
+	Path      string    `json:"path"`
+	Task      string    `json:"task,omitempty"`
+	Tasks     []string  `json:"tasks,omitempty"` // Tasks affected by a bulk operation
+	SourceIP  string    `json:"source_ip"`
+	RequestID string    `json:"request_id"`
+	Outcome   string    `json:"outcome"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error,omitempty"` // Code of the error
+}
+
+// Filter of the entries, zero values match everything
+type Filter struct {
+	Since time.Time
+	Until time.Time
+	Owner string
+}
+
+func (f *Filter) match(e *Entry) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return f.Owner == "" || e.Owner == f.Owner
+}
+
+// Log is an append only log of Entry, nothing is updated.
+// Entries older than maxAge are deleted.
+type Log struct {
+	store   store.Store
+	maxAge  time.Duration
+	lock    sync.Mutex
+	appends int
+}
+
+// NewLog uses a store, entries are kept during maxAge
+func NewLog(s store.Store, maxAge time.Duration) *Log {
+	return &Log{store: s, maxAge: maxAge}
+}
+
+// timeKey sorts the latest first
+func timeKey(t time.Time) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(math.MaxInt64-t.UnixNano()))
+	return k
+}
+
+// key of an entry, its time, then its id
+func key(e *Entry) []byte {
+	return append(timeKey(e.Time), e.Id[:]...)
+}
+
+// Append an Entry, its id and time are set here
+func (l *Log) Append(e *Entry) error {
+	var err error
+	e.Id, err = uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+	e.Time = time.Now()
+	value, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	err = l.store.Put(key(e), value)
+	if err != nil {
+		return err
+	}
+	// trim from time to time, not at each append
+	l.lock.Lock()
+	l.appends++
+	trim := l.appends >= trimPeriod
+	if trim {
+		l.appends = 0
+	}
+	l.lock.Unlock()
+	if trim {
+		return l.Trim(e.Time.Add(-l.maxAge))
+	}
+	return nil
+}
+
+// Trim deletes the entries before oldest
+func (l *Log) Trim(oldest time.Time) error {
+	limit := timeKey(oldest)
+	return l.store.DeleteWithClause(func(k, v []byte) bool {
+		return bytes.Compare(k[:len(limit)], limit) > 0 // the latest first
+	})
+}
+
+var errPageFull = errors.New("page is full")
+
+type keyed struct {
+	key   []byte
+	entry *Entry
+}
+
+// List a page of the entries matching the filter, latest first, limit is between 1 and MaxLimit.
+// The cursor of the next page is empty for the last page.
+// A store with a cursor stops reading after the page.
+func (l *Log) List(filter *Filter, limit int, cursor string) ([]*Entry, string, error) {
+	if limit <= 0 || limit > MaxLimit {
+		limit = MaxLimit
+	}
+	if filter == nil {
+		filter = &Filter{}
+	}
+	var after []byte
+	if cursor != "" {
+		var err error
+		after, err = base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, "", errors.New("Bad cursor")
+		}
+	}
+	// entries before Until are after its key
+	start := after
+	if !filter.Until.IsZero() {
+		if until := timeKey(filter.Until); bytes.Compare(until, start) > 0 {
+			start = until
+		}
+	}
+	seeker, ordered := l.store.(store.Seeker)
+	entries := make([]keyed, 0)
+	each := func(k, v []byte) error {
+		if after != nil && bytes.Compare(k, after) <= 0 {
+			return nil
+		}
+		var e Entry
+		err := json.Unmarshal(v, &e)
+		if err != nil {
+			return err
+		}
+		if ordered && !filter.Since.IsZero() && e.Time.Before(filter.Since) {
+			return errPageFull // older entries are before Since too
+		}
+		if filter.match(&e) {
+			entries = append(entries, keyed{append([]byte{}, k...), &e})
+		}
+		if ordered && len(entries) > limit {
+			return errPageFull
+		}
+		return nil
+	}
+	var err error
+	if ordered {
+		err = seeker.ForEachFrom(start, each)
+	} else {
+		err = l.store.ForEach(each)
+	}
+	if err != nil && err != errPageFull {
+		return nil, "", err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+	next := ""
+	if len(entries) > limit {
+		entries = entries[:limit]
+		next = base64.RawURLEncoding.EncodeToString(entries[limit-1].key)
+	}
+	page := make([]*Entry, len(entries))
+	for i, e := range entries {
+		page[i] = e.entry
+	}
+	return page, next, nil
+}
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	l := NewLog(store.NewMemoryStore(), DefaultMaxAge)
+	start := time.Now()
+	for _, owner := range []string{"alice", "bob", "alice"} {
+		e := &Entry{Owner: owner, Action: "POST /api/tasks", Outcome: Success, Status: 201}
+		assert.NoError(t, l.Append(e))
+		assert.False(t, e.Time.Before(start))
+		time.Sleep(time.Millisecond)
+	}
+
+	entries, _, err := l.List(nil, 0, "")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.True(t, entries[0].Time.After(entries[2].Time), "latest first")
+
+	entries, _, err = l.List(&Filter{Owner: "alice"}, 0, "")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	entries, _, err = l.List(nil, 1, "")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "alice", entries[0].Owner)
+
+	entries, _, err = l.List(&Filter{Since: time.Now()}, 0, "")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 0)
+	entries, _, err = l.List(&Filter{Until: start}, 0, "")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestTrim(t *testing.T) {
+	l := NewLog(store.NewMemoryStore(), time.Hour)
+	old := &Entry{Id: uuid.New(), Time: time.Now().Add(-2 * time.Hour), Owner: "alice"}
+	value, err := json.Marshal(old)
+	assert.NoError(t, err)
+	assert.NoError(t, l.store.Put(key(old), value))
+
+	for i := 0; i < trimPeriod-1; i++ {
+		assert.NoError(t, l.Append(&Entry{Owner: "bob"}))
+	}
+	entries, _, err := l.List(&Filter{Owner: "alice"}, 0, "")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "not yet trimmed")
+
+	assert.NoError(t, l.Append(&Entry{Owner: "bob"}))
+	entries, _, err = l.List(&Filter{Owner: "alice"}, 0, "")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 0)
+	entries, _, err = l.List(nil, 0, "")
+	assert.NoError(t, err)
+	assert.Len(t, entries, trimPeriod)
+}
+
+func testPages(t *testing.T, l *Log) {
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, l.Append(&Entry{Owner: "bob", Action: "DELETE /api/task/{uuid}", Outcome: Success}))
+		time.Sleep(time.Millisecond)
+	}
+	all, next, err := l.List(nil, 0, "")
+	assert.NoError(t, err)
+	assert.Len(t, all, 5)
+	assert.Equal(t, "", next)
+
+	entries := make([]*Entry, 0)
+	for {
+		var page []*Entry
+		page, next, err = l.List(&Filter{Owner: "bob"}, 2, next)
+		assert.NoError(t, err)
+		entries = append(entries, page...)
+		if next == "" {
+			break
+		}
+	}
+	assert.Equal(t, all, entries)
+
+	_, _, err = l.List(nil, 2, "%")
+	assert.Error(t, err)
+	entries, _, err = l.List(&Filter{Until: all[1].Time}, 0, "")
+	assert.NoError(t, err)
+	assert.Equal(t, all[2:], entries)
+	entries, _, err = l.List(&Filter{Since: all[1].Time}, 0, "")
+	assert.NoError(t, err)
+	assert.Equal(t, all[:2], entries)
+}
+
+func TestPages(t *testing.T) {
+	testPages(t, NewLog(store.NewMemoryStore(), DefaultMaxAge))
+
+	dir, err := ioutil.TempDir("", "audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := store.NewBoltStore(filepath.Join(dir, "store.bolt"))
+	assert.NoError(t, err)
+	defer s.Db.Close()
+	bucket, err := s.Bucket("audit_pages")
+	assert.NoError(t, err)
+	testPages(t, NewLog(bucket, DefaultMaxAge))
+}
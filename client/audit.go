@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/factorysh/density/audit"
+)
+
+// AuditOptions filters the audit log, zero values match everything
+type AuditOptions struct {
+	Since  time.Time
+	Until  time.Time
+	Owner  string
+	Limit  int    // 100 by default
+	Cursor string // Next page, from a previous listing
+}
+
+func (o *AuditOptions) query() url.Values {
+	q := url.Values{}
+	if o == nil {
+		return q
+	}
+	if !o.Since.IsZero() {
+		q.Set("since", o.Since.Format(time.RFC3339))
+	}
+	if !o.Until.IsZero() {
+		q.Set("until", o.Until.Format(time.RFC3339))
+	}
+	if o.Owner != "" {
+		q.Set("owner", o.Owner)
+	}
+	if o.Limit != 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		q.Set("cursor", o.Cursor)
+	}
+	return q
+}
+
+// Audit lists a page of the mutating requests, latest first, and the cursor of the next page.
+// The token needs the admin:audit scope.
+func (c *Client) Audit(ctx context.Context, opts *AuditOptions) ([]audit.Entry, string, error) {
+	r, err := c.request(ctx, http.MethodGet, "/audit", opts.query(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	var entries []audit.Entry
+	res, err := c.doJSON(r, &entries)
+	if err != nil {
+		return nil, "", err
+	}
+	return entries, res.Header.Get("X-Next-Cursor"), nil
+}
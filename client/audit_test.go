@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientAudit(t *testing.T) {
+	_, ts, _, cleanup := newServer(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	c := New(ts.URL, token(t, jwt.MapClaims{"owner": "bob"}))
+	created, err := c.Submit(ctx, waitingTask(t, nil))
+	assert.NoError(t, err)
+	_, _, err = c.Audit(ctx, nil)
+	assert.Error(t, err)
+
+	admin := New(ts.URL, token(t, jwt.MapClaims{"owner": "root", "admin": true}))
+	entries, next, err := admin.Audit(ctx, &AuditOptions{Owner: "bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, "", next)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, created.Id.String(), entries[0].Task)
+	assert.Equal(t, audit.Success, entries[0].Outcome)
+
+	_, err = c.Submit(ctx, waitingTask(t, nil))
+	assert.NoError(t, err)
+	entries, next, err = admin.Audit(ctx, &AuditOptions{Owner: "bob", Limit: 1})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.NotEqual(t, "", next)
+	entries, next, err = admin.Audit(ctx, &AuditOptions{Owner: "bob", Limit: 1, Cursor: next})
+	assert.NoError(t, err)
+	assert.Equal(t, "", next)
+	assert.Equal(t, created.Id.String(), entries[0].Task)
+}
@@ -0,0 +1,404 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/task"
+	_ "github.com/factorysh/density/task/compose" // Registering the compose action
+	"github.com/google/uuid"
+)
+
+// Client of the density REST API, authenticated with a JWT
+type Client struct {
+	root  string
+	token string
+	// HTTP client, without timeout, events and logs are streamed
+	HTTP *http.Client
+}
+
+// New client, root is the URL of the server, like http://localhost:8042
+func New(root, token string) *Client {
+	return &Client{
+		root:  strings.TrimRight(root, "/"),
+		token: token,
+		HTTP:  &http.Client{},
+	}
+}
+
+// FieldError explains why a field is rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error answered by the server
+type Error struct {
+	StatusCode int          `json:"-"`
+	Code       string       `json:"code"`
+	Message    string       `json:"message"`
+	Details    []FieldError `json:"details,omitempty"`
+	RequestID  string       `json:"request_id"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+	for _, detail := range e.Details {
+		if detail.Message == e.Message {
+			msg += fmt.Sprintf(" (%s)", detail.Field)
+			continue
+		}
+		msg += fmt.Sprintf(", %s: %s", detail.Field, detail.Message)
+	}
+	return msg
+}
+
+// IsNotFound is true for an unknown task, or any unknown resource
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// readError reads the error envelope of a response
+func readError(res *http.Response) error {
+	e := &Error{
+		StatusCode: res.StatusCode,
+		Code:       strings.ToLower(strings.ReplaceAll(http.StatusText(res.StatusCode), " ", "_")),
+		Message:    http.StatusText(res.StatusCode),
+	}
+	raw, err := ioutil.ReadAll(res.Body)
+	if err != nil || len(raw) == 0 {
+		return e
+	}
+	var body struct {
+		Error *Error `json:"error"`
+	}
+	if json.Unmarshal(raw, &body) == nil && body.Error != nil {
+		body.Error.StatusCode = res.StatusCode
+		return body.Error
+	}
+	e.Message = strings.TrimSpace(string(raw))
+	return e
+}
+
+func (c *Client) request(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := c.root + "/api" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	r, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Authorization", "Bearer "+c.token)
+	return r, nil
+}
+
+// do a request, an answer with an error status is an *Error.
+// The body of the response must be closed.
+func (c *Client) do(r *http.Request) (*http.Response, error) {
+	res, err := c.HTTP.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 400 {
+		defer res.Body.Close()
+		return nil, readError(res)
+	}
+	return res, nil
+}
+
+// doJSON sends a request, value is unmarshaled from the JSON response, if not nil
+func (c *Client) doJSON(r *http.Request, value interface{}) (*http.Response, error) {
+	res, err := c.do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if value == nil {
+		return res, nil
+	}
+	return res, json.NewDecoder(res.Body).Decode(value)
+}
+
+// Submit a task, its id and owner are chosen by the server
+func (c *Client) Submit(ctx context.Context, t *task.Task) (*task.Task, error) {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.request(ctx, http.MethodPost, "/tasks", nil, bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("content-type", "application/json")
+	var created task.Task
+	_, err = c.doJSON(r, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// SubmitCompose submits a docker-compose file, with its x-batch options, and labels
+func (c *Client) SubmitCompose(ctx context.Context, compose io.Reader, labels map[string]string) (*task.Task, error) {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile("docker-compose", "docker-compose.yml")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(part, compose)
+	if err != nil {
+		return nil, err
+	}
+	if len(labels) > 0 {
+		raw, err := json.Marshal(labels)
+		if err != nil {
+			return nil, err
+		}
+		err = form.WriteField("labels", string(raw))
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = form.Close()
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.request(ctx, http.MethodPost, "/tasks", nil, body)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("content-type", form.FormDataContentType())
+	var created task.Task
+	_, err = c.doJSON(r, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// ListOptions filters and paginates a listing
+type ListOptions struct {
+	Owner    string            // Only for admins
+	Labels   map[string]string // Exact values
+	Selector string            // Label selector, like `env in (prod,staging),!temporary`
+	Status   []string
+	Sort     string // start, mtime or status, - prefix for descending order
+	Limit    int
+	Cursor   string // Next page, from a previous listing
+}
+
+func (o *ListOptions) query() url.Values {
+	query := url.Values{}
+	if o == nil {
+		return query
+	}
+	for key, value := range o.Labels {
+		query.Set("label."+key, value)
+	}
+	if o.Selector != "" {
+		query.Set("selector", o.Selector)
+	}
+	if len(o.Status) > 0 {
+		query.Set("status", strings.Join(o.Status, ","))
+	}
+	if o.Sort != "" {
+		query.Set("sort", o.Sort)
+	}
+	if o.Limit > 0 {
+		query.Set("limit", fmt.Sprint(o.Limit))
+	}
+	if o.Cursor != "" {
+		query.Set("cursor", o.Cursor)
+	}
+	return query
+}
+
+// List tasks, next is the cursor of the next page, empty for the last page
+func (c *Client) List(ctx context.Context, opts *ListOptions) (tasks []task.Resp, next string, err error) {
+	path := "/tasks"
+	if opts != nil && opts.Owner != "" {
+		path += "/" + url.PathEscape(opts.Owner)
+	}
+	r, err := c.request(ctx, http.MethodGet, path, opts.query(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := c.doJSON(r, &tasks)
+	if err != nil {
+		return nil, "", err
+	}
+	return tasks, res.Header.Get("X-Next-Cursor"), nil
+}
+
+// Get a task
+func (c *Client) Get(ctx context.Context, id uuid.UUID) (*task.Resp, error) {
+	r, err := c.request(ctx, http.MethodGet, "/task/"+id.String(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var t task.Resp
+	_, err = c.doJSON(r, &t)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Cancel a task, and wait for it
+func (c *Client) Cancel(ctx context.Context, id uuid.UUID) error {
+	r, err := c.request(ctx, http.MethodDelete, "/task/"+id.String(), url.Values{"wait_for": {""}}, nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.doJSON(r, nil)
+	return err
+}
+
+// Delete a task, in the background
+func (c *Client) Delete(ctx context.Context, id uuid.UUID) error {
+	r, err := c.request(ctx, http.MethodDelete, "/task/"+id.String(), nil, nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.doJSON(r, nil)
+	return err
+}
+
+// Volume downloads a file of the volumes of a task, the token needs a path claim
+func (c *Client) Volume(ctx context.Context, id uuid.UUID, path string, w io.Writer) error {
+	r, err := c.request(ctx, http.MethodGet,
+		"/tasks/"+id.String()+"/volume/"+strings.TrimLeft(path, "/"), nil, nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// EventsOptions filters the events
+type EventsOptions struct {
+	Status   []string          // New statuses, like running or done
+	Labels   map[string]string // Exact values
+	Selector string
+	// LastEventID replays the journaled events after this sequence, "0" replays the whole journal.
+	// Without it, only new events are sent.
+	LastEventID string
+}
+
+func (o *EventsOptions) query() url.Values {
+	query := url.Values{}
+	if o == nil {
+		return query
+	}
+	for key, value := range o.Labels {
+		query.Set(key, value)
+	}
+	if o.Selector != "" {
+		query.Set("selector", o.Selector)
+	}
+	if len(o.Status) > 0 {
+		query.Set("status", strings.Join(o.Status, ","))
+	}
+	if o.LastEventID != "" {
+		query.Set("last_event_id", o.LastEventID)
+	}
+	return query
+}
+
+// Events follows the events of the scheduler, until the context is done, or sink returns an error.
+// The server may close a slow stream, resume it with the Seq of the last event as LastEventID.
+func (c *Client) Events(ctx context.Context, opts *EventsOptions, sink func(pubsub.Event) error) error {
+	r, err := c.request(ctx, http.MethodGet, "/events", opts.query(), nil)
+	if err != nil {
+		return err
+	}
+	r.Header.Set("accept", "text/event-stream")
+	res, err := c.do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// id and event lines are also in the data, comments are keep-alives
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var event pubsub.Event
+		err = json.Unmarshal([]byte(strings.TrimSpace(line[len("data:"):])), &event)
+		if err != nil {
+			return err
+		}
+		err = sink(event)
+		if err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+// LogsOptions filters the logs of a task
+type LogsOptions struct {
+	Services   []string
+	Tail       int // Latest lines only
+	Timestamps bool
+	// Follow streams the logs of a running task, until its end
+	Follow bool
+}
+
+func (o *LogsOptions) query() url.Values {
+	query := url.Values{}
+	if o == nil {
+		return query
+	}
+	if len(o.Services) > 0 {
+		query.Set("service", strings.Join(o.Services, ","))
+	}
+	if o.Tail > 0 {
+		query.Set("tail", fmt.Sprint(o.Tail))
+	}
+	if o.Timestamps {
+		query.Set("timestamps", "true")
+	}
+	if o.Follow {
+		query.Set("follow", "true")
+	}
+	return query
+}
+
+// Logs of the latest run of a task, as text, like docker-compose logs
+func (c *Client) Logs(ctx context.Context, id uuid.UUID, opts *LogsOptions, w io.Writer) error {
+	r, err := c.request(ctx, http.MethodGet, "/task/"+id.String()+"/logs", opts.query(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := c.do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = io.Copy(w, res.Body)
+	return err
+}
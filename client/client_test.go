@@ -0,0 +1,227 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/server"
+	"github.com/factorysh/density/task"
+	"github.com/factorysh/density/task/status"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+const key = "plop"
+
+func token(t *testing.T, claims jwt.MapClaims) string {
+	blob, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+	assert.NoError(t, err)
+	return blob
+}
+
+func newServer(t *testing.T) (*server.Server, *httptest.Server, string, func()) {
+	dir, err := ioutil.TempDir(os.TempDir(), "client-")
+	assert.NoError(t, err)
+	s, err := server.New("", dir, key, 4, 16*1024)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Scheduler.Start(ctx)
+	handler, err := s.Handler()
+	assert.NoError(t, err)
+	ts := httptest.NewServer(handler)
+	return s, ts, dir, func() {
+		ts.Close()
+		cancel()
+		os.RemoveAll(dir)
+	}
+}
+
+// waitingTask is a compose task, starting in a long time
+func waitingTask(t *testing.T, labels map[string]string) *task.Task {
+	var tsk task.Task
+	err := json.Unmarshal([]byte(`{
+		"cpu": 1,
+		"ram": 64,
+		"max_execution_time": "120s",
+		"action": {
+			"compose": {
+				"version": "3",
+				"services": {
+					"hello": {
+						"image": "busybox:latest",
+						"command": "echo World"
+					}
+				}
+			}
+		}
+	}`), &tsk)
+	assert.NoError(t, err)
+	tsk.Start = time.Now().Add(time.Hour)
+	tsk.Labels = labels
+	return &tsk
+}
+
+func TestClient(t *testing.T) {
+	_, ts, dir, cleanup := newServer(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	c := New(ts.URL, token(t, jwt.MapClaims{"owner": "bob"}))
+	tasks, next, err := c.List(ctx, nil)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 0)
+	assert.Equal(t, "", next)
+
+	var ids []uuid.UUID
+	for _, env := range []string{"prod", "staging", "prod"} {
+		created, err := c.Submit(ctx, waitingTask(t, map[string]string{"env": env}))
+		assert.NoError(t, err)
+		assert.Equal(t, "bob", created.Owner)
+		ids = append(ids, created.Id)
+	}
+
+	tasks, next, err = c.List(ctx, &ListOptions{Labels: map[string]string{"env": "prod"}})
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "", next)
+
+	tasks, next, err = c.List(ctx, &ListOptions{Selector: "env in (prod,staging)", Sort: "start", Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 2)
+	assert.NotEqual(t, "", next)
+	tasks, next, err = c.List(ctx, &ListOptions{Selector: "env in (prod,staging)", Sort: "start", Limit: 2, Cursor: next})
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, "", next)
+
+	created, err := c.Submit(ctx, waitingTask(t, nil))
+	assert.NoError(t, err)
+	got, err := c.Get(ctx, created.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, created.Id, got.Id)
+	assert.Equal(t, status.Waiting, got.Status)
+
+	err = c.Cancel(ctx, created.Id)
+	assert.NoError(t, err)
+	got, err = c.Get(ctx, created.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, status.Canceled, got.Status)
+
+	err = c.Delete(ctx, created.Id)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := c.Get(ctx, created.Id)
+		return IsNotFound(err)
+	}, time.Second, 10*time.Millisecond)
+
+	// volumes need a path claim
+	wd := path.Join(dir, "wd", ids[0].String(), "volumes")
+	assert.NoError(t, os.MkdirAll(wd, 0755))
+	assert.NoError(t, ioutil.WriteFile(path.Join(wd, "result.txt"), []byte("42"), 0644))
+	reader := New(ts.URL, token(t, jwt.MapClaims{"owner": "bob", "path": path.Join(dir, "wd", "*", "volumes", "*")}))
+	buff := &bytes.Buffer{}
+	err = reader.Volume(ctx, ids[0], "result.txt", buff)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", buff.String())
+	err = c.Volume(ctx, ids[0], "result.txt", buff)
+	e, ok := err.(*Error)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, e.StatusCode)
+}
+
+func TestClientErrors(t *testing.T) {
+	_, ts, _, cleanup := newServer(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	c := New(ts.URL, token(t, jwt.MapClaims{"owner": "bob"}))
+	_, err := c.Get(ctx, uuid.New())
+	assert.True(t, IsNotFound(err))
+	e, ok := err.(*Error)
+	assert.True(t, ok)
+	assert.Equal(t, "unknown_task", e.Code)
+	assert.NotEqual(t, "", e.RequestID)
+
+	bad := waitingTask(t, nil)
+	bad.MaxExectionTime = 0
+	_, err = c.Submit(ctx, bad)
+	e, ok = err.(*Error)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, e.StatusCode)
+	assert.Equal(t, "invalid_task", e.Code)
+	assert.Equal(t, "max_execution_time", e.Details[0].Field)
+
+	// the yaml is parsed before docker-compose is used
+	_, err = c.SubmitCompose(ctx, strings.NewReader("services: [\n"), nil)
+	e, ok = err.(*Error)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, e.StatusCode)
+	assert.Equal(t, "invalid_compose", e.Code)
+
+	_, _, err = New(ts.URL, "not a token").List(ctx, nil)
+	e, ok = err.(*Error)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusUnauthorized, e.StatusCode)
+}
+
+func TestClientEvents(t *testing.T) {
+	_, ts, _, cleanup := newServer(t)
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := New(ts.URL, token(t, jwt.MapClaims{"owner": "bob"}))
+	created, err := c.Submit(ctx, waitingTask(t, map[string]string{"env": "prod"}))
+	assert.NoError(t, err)
+	err = c.Cancel(ctx, created.Id)
+	assert.NoError(t, err)
+
+	// the journal replays the events since the start
+	var events []pubsub.Event
+	err = c.Events(ctx, &EventsOptions{Selector: "env=prod", LastEventID: "0"}, func(event pubsub.Event) error {
+		events = append(events, event)
+		if event.Action == status.Canceled.String() {
+			cancel()
+		}
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, len(events) >= 2)
+	for _, event := range events {
+		assert.Equal(t, created.Id, event.Id)
+	}
+}
+
+func TestClientSubmitCompose(t *testing.T) {
+	if _, err := exec.LookPath("docker-compose"); err != nil {
+		t.Skip("docker-compose is not installed")
+	}
+	_, ts, _, cleanup := newServer(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	c := New(ts.URL, token(t, jwt.MapClaims{"owner": "bob"}))
+	created, err := c.SubmitCompose(ctx, strings.NewReader(`
+version: "3"
+services:
+  hello:
+    image: busybox:latest
+    command: echo World
+x-batch:
+  max_execution_time: 2m
+`), map[string]string{"env": "prod"})
+	assert.NoError(t, err)
+	assert.Equal(t, "prod", created.Labels["env"])
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/factorysh/density/apikey"
+	"github.com/google/uuid"
+)
+
+// CreateKey creates an API key for a service account, the key is only returned here.
+// The token needs the admin:keys scope.
+func (c *Client) CreateKey(ctx context.Context, key *apikey.APIKey) (string, *apikey.APIKey, error) {
+	raw, err := json.Marshal(key)
+	if err != nil {
+		return "", nil, err
+	}
+	r, err := c.request(ctx, http.MethodPost, "/keys", nil, bytes.NewReader(raw))
+	if err != nil {
+		return "", nil, err
+	}
+	r.Header.Set("content-type", "application/json")
+	var created struct {
+		apikey.APIKey
+		Key string `json:"key"`
+	}
+	_, err = c.doJSON(r, &created)
+	if err != nil {
+		return "", nil, err
+	}
+	return created.Key, &created.APIKey, nil
+}
+
+// Keys lists the API keys, with their last use
+func (c *Client) Keys(ctx context.Context) ([]apikey.APIKey, error) {
+	r, err := c.request(ctx, http.MethodGet, "/keys", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var keys []apikey.APIKey
+	_, err = c.doJSON(r, &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// DeleteKey revokes an API key
+func (c *Client) DeleteKey(ctx context.Context, id uuid.UUID) error {
+	r, err := c.request(ctx, http.MethodDelete, "/keys/"+id.String(), nil, nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.doJSON(r, nil)
+	return err
+}
@@ -0,0 +1,37 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/apikey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientKeys(t *testing.T) {
+	_, ts, _, cleanup := newServer(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	admin := New(ts.URL, token(t, jwt.MapClaims{"owner": "root", "admin": true}))
+	raw, key, err := admin.CreateKey(ctx, &apikey.APIKey{Name: "cron", Owner: "backup"})
+	assert.NoError(t, err)
+	assert.Equal(t, "backup", key.Owner)
+
+	// an API key is used like a token
+	c := New(ts.URL, raw)
+	created, err := c.Submit(ctx, waitingTask(t, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "backup", created.Owner)
+
+	keys, err := admin.Keys(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].LastUsed)
+
+	assert.NoError(t, admin.DeleteKey(ctx, key.Id))
+	_, _, err = c.List(ctx, nil)
+	assert.Error(t, err)
+	assert.True(t, IsNotFound(admin.DeleteKey(ctx, key.Id)))
+}
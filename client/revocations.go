@@ -0,0 +1,55 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/factorysh/density/revocation"
+	"github.com/google/uuid"
+)
+
+// Revoke a token, by its jti, or the tokens of an owner.
+// The token needs the admin:tokens scope.
+func (c *Client) Revoke(ctx context.Context, revoked *revocation.Revocation) (*revocation.Revocation, error) {
+	raw, err := json.Marshal(revoked)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.request(ctx, http.MethodPost, "/revocations", nil, bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("content-type", "application/json")
+	var created revocation.Revocation
+	_, err = c.doJSON(r, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// Revocations lists the revoked tokens, latest first
+func (c *Client) Revocations(ctx context.Context) ([]revocation.Revocation, error) {
+	r, err := c.request(ctx, http.MethodGet, "/revocations", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var revocations []revocation.Revocation
+	_, err = c.doJSON(r, &revocations)
+	if err != nil {
+		return nil, err
+	}
+	return revocations, nil
+}
+
+// DeleteRevocation removes a revocation, its tokens are accepted again
+func (c *Client) DeleteRevocation(ctx context.Context, id uuid.UUID) error {
+	r, err := c.request(ctx, http.MethodDelete, "/revocations/"+id.String(), nil, nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.doJSON(r, nil)
+	return err
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/revocation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientRevocations(t *testing.T) {
+	_, ts, _, cleanup := newServer(t)
+	defer cleanup()
+	ctx := context.Background()
+
+	admin := New(ts.URL, token(t, jwt.MapClaims{"owner": "root", "admin": true}))
+	c := New(ts.URL, token(t, jwt.MapClaims{"owner": "bob", "jti": "bob-1"}))
+	_, _, err := c.List(ctx, nil)
+	assert.NoError(t, err)
+
+	revoked, err := admin.Revoke(ctx, &revocation.Revocation{JTI: "bob-1", Reason: "leaked"})
+	assert.NoError(t, err)
+	assert.Equal(t, "leaked", revoked.Reason)
+	_, _, err = c.List(ctx, nil)
+	assert.Error(t, err)
+
+	revocations, err := admin.Revocations(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, revocations, 1)
+
+	assert.NoError(t, admin.DeleteRevocation(ctx, revoked.Id))
+	_, _, err = c.List(ctx, nil)
+	assert.NoError(t, err)
+	assert.True(t, IsNotFound(admin.DeleteRevocation(ctx, revoked.Id)))
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/factorysh/density/client"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditOwner  string
+	auditSince  string
+	auditUntil  string
+	auditLimit  int
+	auditCursor string
+)
+
+func init() {
+	auditCmd.Flags().StringVar(&auditOwner, "owner", "", "Requests of this owner")
+	auditCmd.Flags().StringVar(&auditSince, "since", "", "Requests since this RFC 3339 time")
+	auditCmd.Flags().StringVar(&auditUntil, "until", "", "Requests before this RFC 3339 time")
+	auditCmd.Flags().IntVar(&auditLimit, "limit", 100, "Latest requests, 1000 at most")
+	auditCmd.Flags().StringVar(&auditCursor, "cursor", "", "Cursor of the next page")
+	addOutputFlag(auditCmd)
+	rootCmd.AddCommand(auditCmd)
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "List the mutating requests, latest first, the token needs the admin:audit scope",
+	Long:  clientHelp,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkOutput()
+		if err != nil {
+			return err
+		}
+		opts := &client.AuditOptions{Owner: auditOwner, Limit: auditLimit, Cursor: auditCursor}
+		for _, flag := range []struct {
+			raw   string
+			value *time.Time
+		}{
+			{auditSince, &opts.Since},
+			{auditUntil, &opts.Until},
+		} {
+			if flag.raw == "" {
+				continue
+			}
+			*flag.value, err = time.Parse(time.RFC3339, flag.raw)
+			if err != nil {
+				return err
+			}
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		entries, next, err := c.Audit(cmd.Context(), opts)
+		if err != nil {
+			return err
+		}
+		if next != "" {
+			fmt.Fprintln(cmd.ErrOrStderr(), "Next page: --cursor", next)
+		}
+		w := cmd.OutOrStdout()
+		if output == "json" {
+			return printJSON(w, entries)
+		}
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "TIME\tOWNER\tACTION\tTASK\tSOURCE\tSTATUS\tERROR")
+		for _, e := range entries {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+				formatTime(e.Time), e.Owner, e.Action, e.Task, e.SourceIP, e.Status, e.Error)
+		}
+		return table.Flush()
+	},
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/factorysh/density/middlewares"
+)
+
+// authHelp documents the configuration of the token verification
+const authHelp = `
+	AUTH_KEY, HMAC key of HS256 tokens
+	AUTH_PUBLIC_KEYS, PEM files of RSA or ECDSA public keys, comma separated, the kid is the file name without extension
+	AUTH_JWKS, JWKS file or URL
+	AUTH_JWKS_REFRESH, period of JWKS reloads, 15m by default
+	AUTH_ISSUER, expected iss claim
+	AUTH_AUDIENCE, expected in the aud claim
+	AUTH_REQUIRE_EXP, tokens without exp claim are rejected
+	AUTH_LEEWAY, tolerated clock skew, like 30s
+	AUTH_OWNER_CLAIMS, for tokens without owner claim or not signed by AUTH_KEY, the first claim found is the owner, like project_path,namespace_path
+	AUTH_GROUP_CLAIMS, claims whose values are groups of the owner, sharing their tasks, like namespace_path
+	AUTH_ADMIN_CLAIM, a claim with groups, like namespace_path
+	AUTH_ADMIN_VALUES, groups of AUTH_ADMIN_CLAIM which are admins, comma separated
+	AUTH_PATH_TEMPLATE, template of the volume path glob, like /tmp/density/wd/*/volumes/{{.project_path}}/**
+	`
+
+// hasPublicKeys is true when tokens can be verified without AUTH_KEY
+func hasPublicKeys() bool {
+	return os.Getenv("AUTH_PUBLIC_KEYS") != "" || os.Getenv("AUTH_JWKS") != ""
+}
+
+// configureVerifier with the env
+func configureVerifier(ctx context.Context, verifier *middlewares.Verifier) error {
+	for _, p := range strings.Split(os.Getenv("AUTH_PUBLIC_KEYS"), ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		err := verifier.LoadPEMFile(p)
+		if err != nil {
+			return err
+		}
+	}
+	if jwks := os.Getenv("AUTH_JWKS"); jwks != "" {
+		err := verifier.UseJWKS(ctx, jwks)
+		if err != nil {
+			return err
+		}
+	}
+	verifier.Issuer = os.Getenv("AUTH_ISSUER")
+	verifier.Audience = os.Getenv("AUTH_AUDIENCE")
+	if raw := os.Getenv("AUTH_REQUIRE_EXP"); raw != "" {
+		var err error
+		verifier.RequireExpiry, err = strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+	}
+	if raw := os.Getenv("AUTH_LEEWAY"); raw != "" {
+		var err error
+		verifier.Leeway, err = time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+	}
+	var err error
+	verifier.Mapping, err = claimMapping()
+	return err
+}
+
+// jwksRefresh is the period of the JWKS reloads
+func jwksRefresh() (time.Duration, error) {
+	if os.Getenv("AUTH_JWKS") == "" {
+		return 0, nil
+	}
+	raw := os.Getenv("AUTH_JWKS_REFRESH")
+	if raw == "" {
+		return 15 * time.Minute, nil
+	}
+	return time.ParseDuration(raw)
+}
+
+// claimMapping of the env, for tokens without owner claim, nil if AUTH_OWNER_CLAIMS is not set
+func claimMapping() (*middlewares.ClaimMapping, error) {
+	claims := os.Getenv("AUTH_OWNER_CLAIMS")
+	if claims == "" {
+		return nil, nil
+	}
+	mapping := &middlewares.ClaimMapping{
+		Owner:      strings.Split(claims, ","),
+		AdminClaim: os.Getenv("AUTH_ADMIN_CLAIM"),
+	}
+	if groups := os.Getenv("AUTH_GROUP_CLAIMS"); groups != "" {
+		mapping.Groups = strings.Split(groups, ",")
+	}
+	if values := os.Getenv("AUTH_ADMIN_VALUES"); values != "" {
+		mapping.AdminValues = strings.Split(values, ",")
+	}
+	if raw := os.Getenv("AUTH_PATH_TEMPLATE"); raw != "" {
+		var err error
+		mapping.Path, err = middlewares.NewPathTemplate(raw)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mapping, nil
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/factorysh/density/client"
+	"github.com/factorysh/density/task"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// clientHelp documents the configuration of the client commands
+const clientHelp = `
+	The server is configured in a YAML file, with url and token keys,
+	~/.config/density/config.yml by default, or the DENSITY_CONFIG env.
+	DENSITY_URL and DENSITY_TOKEN env override the file.
+	`
+
+// clientConfig is the configuration of the client commands
+type clientConfig struct {
+	URL   string `yaml:"url"`
+	Token string `yaml:"token"`
+}
+
+// configPath is the path of the client configuration file
+func configPath() (string, error) {
+	p := os.Getenv("DENSITY_CONFIG")
+	if p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, "density", "config.yml"), nil
+}
+
+// loadClientConfig reads the configuration file, if it exists, then the env
+func loadClientConfig() (*clientConfig, error) {
+	cfg := &clientConfig{}
+	p, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ioutil.ReadFile(p)
+	switch {
+	case err == nil:
+		err = yaml.Unmarshal(raw, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("Bad config file %s: %v", p, err)
+		}
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	if url := os.Getenv("DENSITY_URL"); url != "" {
+		cfg.URL = url
+	}
+	if token := os.Getenv("DENSITY_TOKEN"); token != "" {
+		cfg.Token = token
+	}
+	if cfg.URL == "" {
+		cfg.URL = "http://localhost:8042"
+	}
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("No token, set DENSITY_TOKEN env, or token in %s", p)
+	}
+	return cfg, nil
+}
+
+func newClient() (*client.Client, error) {
+	cfg, err := loadClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return client.New(cfg.URL, cfg.Token), nil
+}
+
+// output format of the client commands, table or json
+var output string
+
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&output, "output", "o", "table", "Output format: table or json")
+}
+
+func checkOutput() error {
+	if output != "table" && output != "json" {
+		return fmt.Errorf("Unknown output format: %s", output)
+	}
+	return nil
+}
+
+func printJSON(w io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// formatLabels as k=v, sorted
+func formatLabels(labels map[string]string) string {
+	kv := make([]string, 0, len(labels))
+	for k, v := range labels {
+		kv = append(kv, k+"="+v)
+	}
+	sort.Strings(kv)
+	return strings.Join(kv, ",")
+}
+
+// parseLabels reads k=v flags
+func parseLabels(raw []string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, kv := range raw {
+		slugs := strings.SplitN(kv, "=", 2)
+		if len(slugs) != 2 || slugs[0] == "" {
+			return nil, fmt.Errorf("Bad label, key=value is expected: %s", kv)
+		}
+		labels[slugs[0]] = slugs[1]
+	}
+	return labels, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+// printTasks as a table, or JSON
+func printTasks(w io.Writer, tasks []task.Resp) error {
+	if output == "json" {
+		return printJSON(w, tasks)
+	}
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tOWNER\tSTATUS\tSTART\tLABELS")
+	for _, t := range tasks {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n",
+			t.Id, t.Owner, t.Status, formatTime(t.Start), formatLabels(t.Labels))
+	}
+	return table.Flush()
+}
+
+// printTask details, as a table, or JSON
+func printTask(w io.Writer, t *task.Resp) error {
+	if output == "json" {
+		return printJSON(w, t)
+	}
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	rows := [][2]string{
+		{"ID", t.Id.String()},
+		{"Owner", t.Owner},
+		{"Status", t.Status.String()},
+		{"Start", formatTime(t.Start)},
+		{"Modified", formatTime(t.Mtime)},
+		{"Labels", formatLabels(t.Labels)},
+		{"CPU", fmt.Sprint(t.CPU)},
+		{"RAM", fmt.Sprint(t.RAM)},
+		{"Max execution time", t.MaxExectionTime.String()},
+		{"Runs", fmt.Sprint(t.RunCounter)},
+	}
+	if t.Cron != "" {
+		rows = append(rows, [2]string{"Cron", t.Cron})
+	}
+	if t.Every != 0 {
+		rows = append(rows, [2]string{"Every", t.Every.String()})
+	}
+	if t.Paused {
+		rows = append(rows, [2]string{"Paused", "true"})
+	}
+	for _, row := range rows {
+		fmt.Fprintf(table, "%s:\t%s\n", row[0], row[1])
+	}
+	return table.Flush()
+}
@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/client"
+	"github.com/factorysh/density/server"
+	"github.com/factorysh/density/task"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+// resetFlags of a previous run
+func resetFlags(t *testing.T, cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			assert.NoError(t, slice.Replace(nil))
+		} else {
+			assert.NoError(t, f.Value.Set(f.DefValue))
+		}
+		f.Changed = false
+	})
+	for _, sub := range cmd.Commands() {
+		resetFlags(t, sub)
+	}
+}
+
+// run a command, with the default flags
+func run(t *testing.T, args ...string) (string, error) {
+	resetFlags(t, rootCmd)
+	out := &bytes.Buffer{}
+	rootCmd.SetOut(out)
+	rootCmd.SetErr(ioutil.Discard)
+	rootCmd.SetArgs(args)
+	err := rootCmd.ExecuteContext(context.Background())
+	return out.String(), err
+}
+
+func TestLoadClientConfig(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "density-config-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cfgPath := path.Join(dir, "config.yml")
+	os.Setenv("DENSITY_CONFIG", cfgPath)
+	defer os.Unsetenv("DENSITY_CONFIG")
+
+	_, err = loadClientConfig()
+	assert.Error(t, err, "a token is mandatory")
+
+	err = ioutil.WriteFile(cfgPath, []byte("url: http://density.example.com\ntoken: secret\n"), 0600)
+	assert.NoError(t, err)
+	cfg, err := loadClientConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://density.example.com", cfg.URL)
+	assert.Equal(t, "secret", cfg.Token)
+
+	os.Setenv("DENSITY_TOKEN", "other")
+	defer os.Unsetenv("DENSITY_TOKEN")
+	cfg, err = loadClientConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://density.example.com", cfg.URL)
+	assert.Equal(t, "other", cfg.Token)
+}
+
+func TestClientCommands(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "density-cmd-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := server.New("", dir, "plop", 4, 16*1024)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Scheduler.Start(ctx)
+	handler, err := s.Handler()
+	assert.NoError(t, err)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"owner": "bob"}).SignedString([]byte("plop"))
+	assert.NoError(t, err)
+	os.Setenv("DENSITY_CONFIG", path.Join(dir, "nope.yml"))
+	defer os.Unsetenv("DENSITY_CONFIG")
+	os.Setenv("DENSITY_URL", ts.URL)
+	defer os.Unsetenv("DENSITY_URL")
+	os.Setenv("DENSITY_TOKEN", token)
+	defer os.Unsetenv("DENSITY_TOKEN")
+
+	var created task.Task
+	err = json.Unmarshal([]byte(`{
+		"cpu": 1,
+		"ram": 64,
+		"max_execution_time": "120s",
+		"action": {
+			"compose": {
+				"version": "3",
+				"services": {
+					"hello": {"image": "busybox:latest", "command": "echo World"}
+				}
+			}
+		}
+	}`), &created)
+	assert.NoError(t, err)
+	created.Start = time.Now().Add(time.Hour)
+	created.Labels = map[string]string{"env": "prod"}
+	c := client.New(ts.URL, token)
+	t1, err := c.Submit(ctx, &created)
+	assert.NoError(t, err)
+
+	out, err := run(t, "list")
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "ID"))
+	assert.Contains(t, lines[1], t1.Id.String())
+	assert.Contains(t, lines[1], "env=prod")
+
+	out, err = run(t, "list", "-o", "json", "--selector", "env=staging")
+	assert.NoError(t, err)
+	var tasks []task.Resp
+	assert.NoError(t, json.Unmarshal([]byte(out), &tasks))
+	assert.Len(t, tasks, 0)
+
+	out, err = run(t, "get", t1.Id.String(), "-o", "table")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Waiting")
+
+	out, err = run(t, "cancel", t1.Id.String())
+	assert.NoError(t, err)
+	assert.Equal(t, t1.Id.String()+"\n", out)
+
+	out, err = run(t, "get", t1.Id.String(), "-o", "json")
+	assert.NoError(t, err)
+	var got task.Resp
+	assert.NoError(t, json.Unmarshal([]byte(out), &got))
+	assert.Equal(t, "Canceled", got.Status.String())
+
+	_, err = run(t, "get", "not-an-uuid")
+	assert.Error(t, err)
+
+	_, err = run(t, "list", "-o", "yaml")
+	assert.Error(t, err)
+
+	_, err = run(t, "delete", t1.Id.String())
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := run(t, "get", t1.Id.String())
+		return client.IsNotFound(err)
+	}, time.Second, 10*time.Millisecond)
+
+	// API keys, for admins
+	_, err = run(t, "key", "list")
+	assert.Error(t, err)
+	admin, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"owner": "root", "admin": true}).SignedString([]byte("plop"))
+	assert.NoError(t, err)
+	os.Setenv("DENSITY_TOKEN", admin)
+	out, err = run(t, "key", "create", "--owner", "cron", "--name", "backup", "--scope", "tasks:read", "--expiry", "1h")
+	assert.NoError(t, err)
+	key := strings.TrimSpace(out)
+	_, err = client.New(ts.URL, key).Get(ctx, t1.Id)
+	assert.True(t, client.IsNotFound(err), "the key is valid")
+	out, err = run(t, "key", "list")
+	assert.NoError(t, err)
+	lines = strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], "backup")
+	id := strings.Fields(lines[1])[0]
+	out, err = run(t, "key", "delete", id)
+	assert.NoError(t, err)
+	assert.Equal(t, id+"\n", out)
+	_, err = client.New(ts.URL, key).Get(ctx, t1.Id)
+	assert.False(t, client.IsNotFound(err))
+
+	// revoked tokens
+	bob, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"owner": "bob", "jti": "bob-1"}).SignedString([]byte("plop"))
+	assert.NoError(t, err)
+	out, err = run(t, "token", "revoke", bob, "--reason", "leaked")
+	assert.NoError(t, err)
+	revoked := strings.TrimSpace(out)
+	_, err = client.New(ts.URL, bob).Get(ctx, t1.Id)
+	assert.False(t, client.IsNotFound(err), "the token is revoked")
+	_, err = run(t, "token", "revoke", bob, "--owner", "bob")
+	assert.Error(t, err)
+	out, err = run(t, "token", "revoked")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "leaked")
+	out, err = run(t, "token", "unrevoke", revoked)
+	assert.NoError(t, err)
+	assert.Equal(t, revoked+"\n", out)
+	_, err = client.New(ts.URL, bob).Get(ctx, t1.Id)
+	assert.True(t, client.IsNotFound(err))
+
+	// audit log of the mutating requests
+	out, err = run(t, "audit", "--owner", "root", "--limit", "10")
+	assert.NoError(t, err)
+	lines = strings.Split(strings.TrimSpace(out), "\n")
+	assert.Len(t, lines, 5, "header, 2 keys and 2 revocations")
+	assert.Contains(t, lines[1], "DELETE /api/revocations/{revocation}")
+	_, err = run(t, "audit", "--since", "yesterday")
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/factorysh/density/apikey"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keyName   string
+	keyOwner  string
+	keyScopes []string
+	keyGroups []string
+	keyPath   string
+	keyExpiry time.Duration
+)
+
+func init() {
+	keyCreateCmd.Flags().StringVar(&keyName, "name", "", "Name of the key, like the script using it")
+	keyCreateCmd.Flags().StringVar(&keyOwner, "owner", "", "Owner of the tasks of the service account")
+	keyCreateCmd.MarkFlagRequired("owner")
+	keyCreateCmd.Flags().StringSliceVar(&keyScopes, "scope", nil, "Scopes, the scopes of the user role by default")
+	keyCreateCmd.Flags().StringSliceVar(&keyGroups, "group", nil, "Groups, sharing their tasks")
+	keyCreateCmd.Flags().StringVar(&keyPath, "path", "", "Glob of the readable volume files")
+	keyCreateCmd.Flags().DurationVar(&keyExpiry, "expiry", 0, "Lifetime of the key, 0 never expires")
+	addOutputFlag(keyCreateCmd)
+	keyCmd.AddCommand(keyCreateCmd)
+
+	addOutputFlag(keyListCmd)
+	keyCmd.AddCommand(keyListCmd)
+
+	keyCmd.AddCommand(keyDeleteCmd)
+
+	rootCmd.AddCommand(keyCmd)
+}
+
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "API keys of service accounts, the token needs the admin:keys scope",
+}
+
+var keyCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an API key, it's only shown once",
+	Long:  clientHelp,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkOutput()
+		if err != nil {
+			return err
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		key := &apikey.APIKey{
+			Name:   keyName,
+			Owner:  keyOwner,
+			Scopes: keyScopes,
+			Groups: keyGroups,
+			Path:   keyPath,
+		}
+		if keyExpiry > 0 {
+			expires := time.Now().Add(keyExpiry)
+			key.Expires = &expires
+		}
+		raw, key, err := c.CreateKey(cmd.Context(), key)
+		if err != nil {
+			return err
+		}
+		if output == "json" {
+			return printJSON(cmd.OutOrStdout(), struct {
+				*apikey.APIKey
+				Key string `json:"key"`
+			}{key, raw})
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), raw)
+		return nil
+	},
+}
+
+var keyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the API keys, with their last use",
+	Long:  clientHelp,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkOutput()
+		if err != nil {
+			return err
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		keys, err := c.Keys(cmd.Context())
+		if err != nil {
+			return err
+		}
+		w := cmd.OutOrStdout()
+		if output == "json" {
+			return printJSON(w, keys)
+		}
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "ID\tNAME\tOWNER\tSCOPES\tEXPIRES\tLAST USED")
+		for _, key := range keys {
+			expires, used := "never", ""
+			if key.Expires != nil {
+				expires = formatTime(*key.Expires)
+			}
+			if key.LastUsed != nil {
+				used = formatTime(*key.LastUsed)
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				key.Id, key.Name, key.Owner, strings.Join(key.Scopes, ","), expires, used)
+		}
+		return table.Flush()
+	},
+}
+
+var keyDeleteCmd = &cobra.Command{
+	Use:   "delete <id>...",
+	Short: "Revoke API keys",
+	Long:  clientHelp,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		for _, arg := range args {
+			id, err := parseID(arg)
+			if err != nil {
+				return err
+			}
+			err = c.DeleteKey(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), id)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/revocation"
+	"github.com/spf13/cobra"
+)
+
+var (
+	revokeJTI    string
+	revokeOwner  string
+	revokeBefore string
+	revokeReason string
+	revokeExpiry time.Duration
+)
+
+func init() {
+	tokenRevokeCmd.Flags().StringVar(&revokeJTI, "jti", "", "ID of the revoked token")
+	tokenRevokeCmd.Flags().StringVar(&revokeOwner, "owner", "", "Revokes every token of this owner")
+	tokenRevokeCmd.Flags().StringVar(&revokeBefore, "before", "", "With --owner, revokes the tokens issued before this RFC 3339 time, now by default")
+	tokenRevokeCmd.Flags().StringVar(&revokeReason, "reason", "", "Reason of the revocation")
+	tokenRevokeCmd.Flags().DurationVar(&revokeExpiry, "expiry", 0, "Lifetime of the revocation, the expiry of the token, or 30 days by default")
+	addOutputFlag(tokenRevokeCmd)
+	tokenCmd.AddCommand(tokenRevokeCmd)
+
+	addOutputFlag(tokenRevokedCmd)
+	tokenCmd.AddCommand(tokenRevokedCmd)
+
+	tokenCmd.AddCommand(tokenUnrevokeCmd)
+}
+
+// revocationOf a token, by its jti, until its expiry
+func revocationOf(raw string) (*revocation.Revocation, error) {
+	claims := jwt.MapClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(raw, claims)
+	if err != nil {
+		return nil, err
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, errors.New("The token has no jti, revoke its owner with --owner")
+	}
+	revoked := &revocation.Revocation{JTI: jti}
+	if exp, ok := claims["exp"].(float64); ok {
+		revoked.Expires = time.Unix(int64(exp), 0)
+	}
+	return revoked, nil
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke [<token>]",
+	Short: "Revoke a token, - reads stdin, or the tokens of --jti or --owner",
+	Long: `Revoke a token, or the tokens of --jti or --owner. The token needs the admin:tokens scope.
+` + clientHelp,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkOutput()
+		if err != nil {
+			return err
+		}
+		revoked := &revocation.Revocation{
+			JTI:   revokeJTI,
+			Owner: revokeOwner,
+		}
+		if len(args) == 1 {
+			if revokeJTI != "" || revokeOwner != "" {
+				return errors.New("A token, --jti or --owner, not both")
+			}
+			raw := args[0]
+			if raw == "-" {
+				blob, err := ioutil.ReadAll(cmd.InOrStdin())
+				if err != nil {
+					return err
+				}
+				raw = string(blob)
+			}
+			revoked, err = revocationOf(strings.TrimSpace(raw))
+			if err != nil {
+				return err
+			}
+		}
+		if revokeBefore != "" {
+			before, err := time.Parse(time.RFC3339, revokeBefore)
+			if err != nil {
+				return err
+			}
+			revoked.IssuedBefore = &before
+		}
+		if revokeExpiry > 0 {
+			revoked.Expires = time.Now().Add(revokeExpiry)
+		}
+		revoked.Reason = revokeReason
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		revoked, err = c.Revoke(cmd.Context(), revoked)
+		if err != nil {
+			return err
+		}
+		if output == "json" {
+			return printJSON(cmd.OutOrStdout(), revoked)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), revoked.Id)
+		return nil
+	},
+}
+
+var tokenRevokedCmd = &cobra.Command{
+	Use:   "revoked",
+	Short: "List the revoked tokens",
+	Long:  clientHelp,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkOutput()
+		if err != nil {
+			return err
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		revocations, err := c.Revocations(cmd.Context())
+		if err != nil {
+			return err
+		}
+		w := cmd.OutOrStdout()
+		if output == "json" {
+			return printJSON(w, revocations)
+		}
+		table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(table, "ID\tJTI\tOWNER\tISSUED BEFORE\tEXPIRES\tREASON")
+		for _, revoked := range revocations {
+			before := ""
+			if revoked.IssuedBefore != nil {
+				before = formatTime(*revoked.IssuedBefore)
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				revoked.Id, revoked.JTI, revoked.Owner, before, formatTime(revoked.Expires), revoked.Reason)
+		}
+		return table.Flush()
+	},
+}
+
+var tokenUnrevokeCmd = &cobra.Command{
+	Use:   "unrevoke <id>...",
+	Short: "Remove revocations, their tokens are accepted again",
+	Long:  clientHelp,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		for _, arg := range args {
+			id, err := parseID(arg)
+			if err != nil {
+				return err
+			}
+			err = c.DeleteRevocation(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), id)
+		}
+		return nil
+	},
+}
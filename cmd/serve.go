@@ -13,6 +13,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/factorysh/density/compose"
+	"github.com/factorysh/density/pubsub"
 	"github.com/factorysh/density/server"
 	"github.com/factorysh/density/version"
 )
@@ -27,11 +28,11 @@ var serveCmd = &cobra.Command{
 	Long: `
 	Sentry is used if SENTRY_DSN env is set.
 	LISTEN
-	AUTH_KEY
 	DATA_DIR
 	CPU
 	RAM
-	`,
+	EVENTS_SLOW_POLICY, for event streams: drop or disconnect (default)
+	` + authHelp,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
 		err := compose.EnsureBin()
@@ -61,8 +62,8 @@ var serveCmd = &cobra.Command{
 		}
 
 		authKey := os.Getenv("AUTH_KEY")
-		if authKey == "" {
-			log.Fatal("Server can't start without an authentication key (`AUTH_KEY` env variable)")
+		if authKey == "" && !hasPublicKeys() {
+			log.Fatal("Server can't start without an authentication key (`AUTH_KEY`, `AUTH_PUBLIC_KEYS` or `AUTH_JWKS` env variable)")
 		}
 
 		dataDir := os.Getenv("DATA_DIR")
@@ -85,6 +86,24 @@ var serveCmd = &cobra.Command{
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
+		err = configureVerifier(ctx, s.Verifier)
+		if err != nil {
+			return err
+		}
+		s.JWKSRefresh, err = jwksRefresh()
+		if err != nil {
+			return err
+		}
+
+		slowPolicy := os.Getenv("EVENTS_SLOW_POLICY")
+		if slowPolicy != "" {
+			policy, err := pubsub.ParsePolicy(slowPolicy)
+			if err != nil {
+				return err
+			}
+			s.Scheduler.Pubsub.SlowPolicy = policy
+		}
+
 		done := make(chan os.Signal, 1)
 		signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 		fmt.Println("Listening", s.Addr)
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/factorysh/density/client"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+var (
+	submitLabels []string
+
+	listOpts   client.ListOptions
+	listLabels []string
+	listStatus string
+
+	logsOpts     client.LogsOptions
+	logsServices string
+)
+
+func init() {
+	submitCmd.Flags().StringArrayVarP(&submitLabels, "label", "l", nil, "Label of the task, key=value, repeatable")
+	addOutputFlag(submitCmd)
+	rootCmd.AddCommand(submitCmd)
+
+	listCmd.Flags().StringVar(&listOpts.Owner, "owner", "", "Tasks of this owner, for admins")
+	listCmd.Flags().StringArrayVarP(&listLabels, "label", "l", nil, "Label value, key=value, repeatable")
+	listCmd.Flags().StringVarP(&listOpts.Selector, "selector", "s", "", "Label selector, like `env in (prod,staging)`")
+	listCmd.Flags().StringVar(&listStatus, "status", "", "Status, comma separated")
+	listCmd.Flags().StringVar(&listOpts.Sort, "sort", "", "start, mtime or status, - prefix for descending order")
+	listCmd.Flags().IntVar(&listOpts.Limit, "limit", 0, "Size of a page")
+	listCmd.Flags().StringVar(&listOpts.Cursor, "cursor", "", "Cursor of the next page")
+	addOutputFlag(listCmd)
+	rootCmd.AddCommand(listCmd)
+
+	addOutputFlag(getCmd)
+	rootCmd.AddCommand(getCmd)
+
+	rootCmd.AddCommand(cancelCmd)
+	rootCmd.AddCommand(deleteCmd)
+
+	logsCmd.Flags().BoolVarP(&logsOpts.Follow, "follow", "f", false, "Follow the logs of a running task")
+	logsCmd.Flags().IntVar(&logsOpts.Tail, "tail", 0, "Latest lines only")
+	logsCmd.Flags().BoolVarP(&logsOpts.Timestamps, "timestamps", "t", false, "Show timestamps")
+	logsCmd.Flags().StringVar(&logsServices, "service", "", "Services, comma separated")
+	rootCmd.AddCommand(logsCmd)
+}
+
+func parseID(raw string) (uuid.UUID, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("Bad task id %s: %v", raw, err)
+	}
+	return id, nil
+}
+
+var submitCmd = &cobra.Command{
+	Use:   "submit <docker-compose.yml>",
+	Short: "Submit a docker-compose file, - reads stdin",
+	Long: `Submit a docker-compose file, with its x-batch options.
+	` + clientHelp,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkOutput()
+		if err != nil {
+			return err
+		}
+		labels, err := parseLabels(submitLabels)
+		if err != nil {
+			return err
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		var compose io.Reader = cmd.InOrStdin()
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			compose = f
+		}
+		t, err := c.SubmitCompose(cmd.Context(), compose, labels)
+		if err != nil {
+			return err
+		}
+		if output == "json" {
+			return printJSON(cmd.OutOrStdout(), t)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), t.Id)
+		return nil
+	},
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tasks",
+	Long: `List tasks, mine, or everything for an admin.
+	With a limit, the cursor of the next page is written on stderr.
+	` + clientHelp,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkOutput()
+		if err != nil {
+			return err
+		}
+		listOpts.Labels, err = parseLabels(listLabels)
+		if err != nil {
+			return err
+		}
+		listOpts.Status = nil
+		if listStatus != "" {
+			listOpts.Status = strings.Split(listStatus, ",")
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		tasks, next, err := c.List(cmd.Context(), &listOpts)
+		if err != nil {
+			return err
+		}
+		err = printTasks(cmd.OutOrStdout(), tasks)
+		if err != nil {
+			return err
+		}
+		if next != "" {
+			fmt.Fprintln(cmd.ErrOrStderr(), "Next page: --cursor", next)
+		}
+		return nil
+	},
+}
+
+var getCmd = &cobra.Command{
+	Use:   "get <id>",
+	Short: "Show a task",
+	Long:  clientHelp,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkOutput()
+		if err != nil {
+			return err
+		}
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		t, err := c.Get(cmd.Context(), id)
+		if err != nil {
+			return err
+		}
+		return printTask(cmd.OutOrStdout(), t)
+	},
+}
+
+var cancelCmd = &cobra.Command{
+	Use:   "cancel <id>...",
+	Short: "Cancel tasks, and wait for them",
+	Long:  clientHelp,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		for _, arg := range args {
+			id, err := parseID(arg)
+			if err != nil {
+				return err
+			}
+			err = c.Cancel(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), id)
+		}
+		return nil
+	},
+}
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete <id>...",
+	Short: "Delete tasks",
+	Long:  clientHelp,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		for _, arg := range args {
+			id, err := parseID(arg)
+			if err != nil {
+				return err
+			}
+			err = c.Delete(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), id)
+		}
+		return nil
+	},
+}
+
+var logsCmd = &cobra.Command{
+	Use:   "logs <id>",
+	Short: "Show the logs of the latest run of a task",
+	Long:  clientHelp,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+		logsOpts.Services = nil
+		if logsServices != "" {
+			logsOpts.Services = strings.Split(logsServices, ",")
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		return c.Logs(cmd.Context(), id, &logsOpts, cmd.OutOrStdout())
+	},
+}
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/middlewares"
+	"github.com/factorysh/density/owner"
+	_path "github.com/factorysh/density/path"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tokenKey      string
+	tokenOwner    string
+	tokenAdmin    bool
+	tokenPath     string
+	tokenExpiry   time.Duration
+	tokenAudience string
+	tokenRoles    []string
+	tokenScopes   []string
+	tokenGroups   []string
+)
+
+func init() {
+	tokenCreateCmd.Flags().StringVar(&tokenOwner, "owner", "", "Owner of the tasks")
+	tokenCreateCmd.MarkFlagRequired("owner")
+	tokenCreateCmd.Flags().BoolVar(&tokenAdmin, "admin", false, "Admin, sees and handles every task")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenRoles, "role", nil, "Roles: admin, user, viewer or operator, user by default")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenScopes, "scope", nil, "Scopes, like tasks:read or tasks:cancel:any, added to the roles")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenGroups, "group", nil, "Groups, sharing their tasks")
+	tokenCreateCmd.Flags().StringVar(&tokenPath, "path", "", "Glob of the readable volume files, like /tmp/density/wd/*/volumes/**")
+	tokenCreateCmd.Flags().DurationVar(&tokenExpiry, "expiry", 24*time.Hour, "Lifetime of the token, 0 never expires")
+	tokenCreateCmd.Flags().StringVar(&tokenAudience, "audience", "", "Audience of the token")
+	tokenCreateCmd.Flags().StringVar(&tokenKey, "key", "", "HMAC key, AUTH_KEY env by default")
+	tokenCmd.AddCommand(tokenCreateCmd)
+
+	tokenInspectCmd.Flags().StringVar(&tokenKey, "key", "", "HMAC key, AUTH_KEY env by default")
+	tokenInspectCmd.Flags().StringVar(&tokenAudience, "audience", "", "Expected audience, AUTH_AUDIENCE env by default")
+	addOutputFlag(tokenInspectCmd)
+	tokenCmd.AddCommand(tokenInspectCmd)
+
+	rootCmd.AddCommand(tokenCmd)
+}
+
+// authKey is the key of the flag, or of the server
+func authKey() (string, error) {
+	if tokenKey != "" {
+		return tokenKey, nil
+	}
+	key := os.Getenv("AUTH_KEY")
+	if key == "" {
+		return "", errors.New("No key, use the --key flag, or the AUTH_KEY env")
+	}
+	return key, nil
+}
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Create, inspect and revoke JWT tokens",
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a token, signed with the key of the server",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key, err := authKey()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		claims := jwt.MapClaims{
+			owner.OWNER: tokenOwner,
+			"iat":       now.Unix(),
+			"jti":       uuid.New().String(),
+		}
+		if tokenAdmin {
+			claims[owner.ADMIN] = true
+		}
+		for _, role := range tokenRoles {
+			if _, ok := owner.Roles[role]; !ok {
+				return fmt.Errorf("Unknown role: %s", role)
+			}
+		}
+		if len(tokenRoles) > 0 {
+			claims[owner.ROLES] = tokenRoles
+		}
+		if len(tokenScopes) > 0 {
+			claims[owner.SCOPE] = strings.Join(tokenScopes, " ")
+		}
+		if len(tokenGroups) > 0 {
+			claims[owner.GROUPS] = tokenGroups
+		}
+		if tokenPath != "" {
+			claims[_path.PATH] = tokenPath
+		}
+		if tokenExpiry > 0 {
+			claims["exp"] = now.Add(tokenExpiry).Unix()
+		}
+		if tokenAudience != "" {
+			claims["aud"] = tokenAudience
+		}
+		blob, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), blob)
+		return nil
+	},
+}
+
+// inspection of a token, as written with the json output
+type inspection struct {
+	Header map[string]interface{} `json:"header"`
+	Claims jwt.MapClaims          `json:"claims"`
+	Owner  *owner.Owner           `json:"owner,omitempty"` // as seen by the server
+	Path   string                 `json:"path,omitempty"`
+	Valid  bool                   `json:"valid"`
+	Error  string                 `json:"error,omitempty"`
+}
+
+// inspect a token like the server does, its claims are decoded even if it's invalid
+func inspect(verifier *middlewares.Verifier, raw string) (*inspection, error) {
+	claims := jwt.MapClaims{}
+	t, _, err := new(jwt.Parser).ParseUnverified(raw, claims)
+	if err != nil {
+		return nil, err
+	}
+	i := &inspection{
+		Header: t.Header,
+		Claims: claims,
+	}
+	verified, err := verifier.Verify(raw)
+	if err == nil {
+		var p _path.Path
+		i.Owner, p, err = verifier.Identify(verified, middlewares.Shared(raw))
+		i.Path = string(p)
+	}
+	if err != nil {
+		i.Error = err.Error()
+	} else {
+		i.Valid = true
+	}
+	return i, nil
+}
+
+// claimTime formats a timestamp claim
+func claimTime(claims jwt.MapClaims, name string) string {
+	value, ok := claims[name].(float64)
+	if !ok {
+		return ""
+	}
+	return formatTime(time.Unix(int64(value), 0))
+}
+
+var tokenInspectCmd = &cobra.Command{
+	Use:   "inspect <token>",
+	Short: "Decode a token, and check it with the keys of the server, - reads stdin",
+	Long: `Decode a token, and check it like the server does, with the same env.
+	` + authHelp,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkOutput()
+		if err != nil {
+			return err
+		}
+		key, err := authKey()
+		if err != nil && !hasPublicKeys() {
+			return err
+		}
+		verifier := middlewares.NewVerifier(key)
+		err = configureVerifier(cmd.Context(), verifier)
+		if err != nil {
+			return err
+		}
+		if tokenAudience != "" {
+			verifier.Audience = tokenAudience
+		}
+		raw := args[0]
+		if raw == "-" {
+			blob, err := ioutil.ReadAll(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			raw = string(blob)
+		}
+		i, err := inspect(verifier, strings.TrimSpace(raw))
+		if err != nil {
+			return err
+		}
+		w := cmd.OutOrStdout()
+		if output == "json" {
+			err = printJSON(w, i)
+		} else {
+			table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+			// the identity seen by the server, or the raw claims of an invalid token
+			name, admin, glob := fmt.Sprint(i.Claims[owner.OWNER]), i.Claims[owner.ADMIN] == true, fmt.Sprint(i.Claims[_path.PATH])
+			groups, scopes := fmt.Sprint(i.Claims[owner.GROUPS]), fmt.Sprint(i.Claims[owner.SCOPE])
+			if i.Owner != nil {
+				name, admin, glob = i.Owner.Name, i.Owner.Admin, i.Path
+				groups, scopes = strings.Join(i.Owner.Groups, ","), strings.Join(i.Owner.Scopes, " ")
+				if i.Owner.Scopes == nil {
+					scopes = strings.Join(owner.Roles[owner.RoleUser], " ")
+				}
+				if admin {
+					scopes = strings.Join(owner.Roles[owner.RoleAdmin], " ")
+				}
+			}
+			expires := claimTime(i.Claims, "exp")
+			if expires == "" {
+				expires = "never"
+			}
+			for _, row := range [][2]string{
+				{"Algorithm", fmt.Sprint(i.Header["alg"])},
+				{"Owner", name},
+				{"Admin", fmt.Sprint(admin)},
+				{"Groups", groups},
+				{"Scopes", scopes},
+				{"Path", glob},
+				{"Audience", fmt.Sprint(i.Claims["aud"])},
+				{"ID", fmt.Sprint(i.Claims["jti"])},
+				{"Issued at", claimTime(i.Claims, "iat")},
+				{"Expires", expires},
+				{"Valid", fmt.Sprint(i.Valid)},
+			} {
+				if row[1] == "<nil>" {
+					row[1] = ""
+				}
+				fmt.Fprintf(table, "%s:\t%s\n", row[0], row[1])
+			}
+			err = table.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		if !i.Valid {
+			return fmt.Errorf("Invalid token: %s", i.Error)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/middlewares"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToken(t *testing.T) {
+	out, err := run(t, "token", "create", "--key", "plop", "--owner", "bob", "--admin",
+		"--path", "/tmp/density/wd/*/volumes/*", "--audience", "density")
+	assert.NoError(t, err)
+	token := strings.TrimSpace(out)
+
+	claims, err := middlewares.Verify("plop", token)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", claims["owner"])
+	assert.Equal(t, true, claims["admin"])
+	assert.Equal(t, "/tmp/density/wd/*/volumes/*", claims["path"])
+	assert.Equal(t, "density", claims["aud"])
+	assert.InDelta(t, time.Now().Add(24*time.Hour).Unix(), claims["exp"], 5)
+	assert.NotEmpty(t, claims["jti"])
+
+	out, err = run(t, "token", "inspect", "--key", "plop", "--audience", "density", token)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "bob")
+
+	_, err = run(t, "token", "inspect", "--key", "plop", "--audience", "other", token)
+	assert.Error(t, err)
+
+	out, err = run(t, "token", "inspect", "--key", "wrong", "-o", "json", token)
+	assert.Error(t, err)
+	var i inspection
+	assert.NoError(t, json.Unmarshal([]byte(out), &i))
+	assert.False(t, i.Valid)
+	assert.Equal(t, "bob", i.Claims["owner"], "an invalid token is decoded")
+
+	// without expiry
+	out, err = run(t, "token", "create", "--key", "plop", "--owner", "alice", "--expiry", "0")
+	assert.NoError(t, err)
+	claims, err = middlewares.Verify("plop", strings.TrimSpace(out))
+	assert.NoError(t, err)
+	_, ok := claims["exp"]
+	assert.False(t, ok)
+
+	// roles, scopes and groups
+	out, err = run(t, "token", "create", "--key", "plop", "--owner", "carol",
+		"--role", "viewer", "--scope", "tasks:cancel", "--group", "team,ops")
+	assert.NoError(t, err)
+	out, err = run(t, "token", "inspect", "--key", "plop", "-o", "json", strings.TrimSpace(out))
+	assert.NoError(t, err)
+	i = inspection{}
+	assert.NoError(t, json.Unmarshal([]byte(out), &i))
+	assert.Equal(t, []string{"team", "ops"}, i.Owner.Groups)
+	assert.Equal(t, []string{"tasks:cancel", "tasks:read", "volumes:read"}, i.Owner.Scopes)
+	_, err = run(t, "token", "create", "--key", "plop", "--owner", "carol", "--role", "plop")
+	assert.Error(t, err)
+
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"owner": "bob",
+		"exp":   time.Now().Add(-time.Minute).Unix(),
+	}).SignedString([]byte("plop"))
+	assert.NoError(t, err)
+	out, err = run(t, "token", "inspect", "--key", "plop", expired)
+	assert.Error(t, err)
+	assert.Contains(t, out, "false")
+
+	_, err = run(t, "token", "create", "--key", "plop")
+	assert.Error(t, err, "owner is required")
+}
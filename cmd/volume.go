@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var volumeOutput string
+
+func init() {
+	volumeGetCmd.Flags().StringVarP(&volumeOutput, "output-file", "O", "", "Write to this file, instead of stdout")
+	volumeCmd.AddCommand(volumeGetCmd)
+	rootCmd.AddCommand(volumeCmd)
+}
+
+var volumeCmd = &cobra.Command{
+	Use:   "volume",
+	Short: "Files of the volumes of a task",
+}
+
+var volumeGetCmd = &cobra.Command{
+	Use:   "get <id> <path>",
+	Short: "Download a file of the volumes of a task",
+	Long: `Download a file of the volumes of a task, the token needs a path claim.
+	` + clientHelp,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := parseID(args[0])
+		if err != nil {
+			return err
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		var w io.Writer = cmd.OutOrStdout()
+		if volumeOutput != "" {
+			f, err := os.Create(volumeOutput)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		return c.Volume(cmd.Context(), id, args[1], w)
+	},
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/factorysh/density/client"
+	"github.com/factorysh/density/pubsub"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchOpts   client.EventsOptions
+	watchLabels []string
+	watchStatus string
+)
+
+func init() {
+	watchCmd.Flags().StringArrayVarP(&watchLabels, "label", "l", nil, "Label value, key=value, repeatable")
+	watchCmd.Flags().StringVarP(&watchOpts.Selector, "selector", "s", "", "Label selector, like `env in (prod,staging)`")
+	watchCmd.Flags().StringVar(&watchStatus, "status", "", "Actions, comma separated, like Running,Done")
+	watchCmd.Flags().StringVar(&watchOpts.LastEventID, "since", "", "Replay the events after this sequence, 0 for the whole journal")
+	addOutputFlag(watchCmd)
+	rootCmd.AddCommand(watchCmd)
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Follow the events of the tasks",
+	Long: `Follow the events of the tasks, one by line, JSON lines with the json output.
+	` + clientHelp,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := checkOutput()
+		if err != nil {
+			return err
+		}
+		watchOpts.Labels, err = parseLabels(watchLabels)
+		if err != nil {
+			return err
+		}
+		watchOpts.Status = nil
+		if watchStatus != "" {
+			watchOpts.Status = strings.Split(watchStatus, ",")
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		w := cmd.OutOrStdout()
+		return c.Events(cmd.Context(), &watchOpts, func(event pubsub.Event) error {
+			if output == "json" {
+				// one line by event, not indented
+				return json.NewEncoder(w).Encode(event)
+			}
+			_, err := fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", event.Seq, formatTime(event.Time),
+				event.Id, event.Action, formatLabels(event.Labels), event.Reason)
+			return err
+		})
+	},
+}
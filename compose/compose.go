@@ -179,7 +179,7 @@ func (c Compose) Validate() error {
 
 	err = cmd.Run()
 	if err != nil {
-		return errors.New(stderr.String())
+		return &ValidationError{Message: strings.TrimSpace(stderr.String())}
 	}
 
 	return err
@@ -0,0 +1,137 @@
+package compose
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	_run "github.com/factorysh/density/task/run"
+)
+
+var _ _run.Logger = &DockerRun{}
+
+// Logs of all the containers of the project, from the start of the run
+func (d *DockerRun) Logs(ctx context.Context, follow bool, sink func(_run.Line) error) error {
+	cli, err := client.NewEnvClient() // FIXME use a singleton
+	if err != nil {
+		return err
+	}
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All: true,
+		Filters: filters.NewArgs(filters.KeyValuePair{
+			Key:   "label",
+			Value: fmt.Sprintf("com.docker.compose.project=%s", path.Base(d.Path)),
+		}),
+	})
+	if err != nil {
+		return err
+	}
+	lock := sync.Mutex{}
+	safeSink := func(line _run.Line) error {
+		lock.Lock()
+		defer lock.Unlock()
+		return sink(line)
+	}
+	wg := sync.WaitGroup{}
+	errs := make(chan error, len(containers))
+	for _, container := range containers {
+		wg.Add(1)
+		go func(id, service string) {
+			defer wg.Done()
+			errs <- d.containerLogs(ctx, cli, id, service, follow, safeSink)
+		}(container.ID, container.Labels["com.docker.compose.service"])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DockerRun) containerLogs(ctx context.Context, cli *client.Client, id, service string,
+	follow bool, sink func(_run.Line) error) error {
+	reader, err := cli.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Follow:     follow,
+		Since:      d.Start.Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	stdout := newLineWriter(service, "stdout", sink)
+	stderr := newLineWriter(service, "stderr", sink)
+	_, err = stdcopy.StdCopy(stdout, stderr, reader)
+	stdout.Close()
+	stderr.Close()
+	if ctx.Err() != nil { // stop following
+		return nil
+	}
+	return err
+}
+
+// lineWriter splits the demultiplexed output in lines, prefixed by a timestamp
+type lineWriter struct {
+	writer *io.PipeWriter
+	done   chan interface{}
+}
+
+func newLineWriter(service, stream string, sink func(_run.Line) error) *lineWriter {
+	reader, writer := io.Pipe()
+	l := &lineWriter{
+		writer: writer,
+		done:   make(chan interface{}),
+	}
+	go func() {
+		defer close(l.done)
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := _run.Line{
+				Service: service,
+				Stream:  stream,
+				Text:    scanner.Text(),
+			}
+			parts := strings.SplitN(line.Text, " ", 2)
+			if len(parts) == 2 {
+				t, err := time.Parse(time.RFC3339Nano, parts[0])
+				if err == nil {
+					line.Time = t
+					line.Text = parts[1]
+				}
+			}
+			if sink(line) != nil {
+				break
+			}
+		}
+		// unblock the writer
+		io.Copy(ioutil.Discard, reader)
+	}()
+	return l
+}
+
+func (l *lineWriter) Write(p []byte) (int, error) {
+	return l.writer.Write(p)
+}
+
+// Close waits for the last line
+func (l *lineWriter) Close() error {
+	err := l.writer.Close()
+	<-l.done
+	return err
+}
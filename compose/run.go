@@ -19,6 +19,9 @@ func init() {
 
 var _ _run.Run = &DockerRun{}
 
+// StopGrace is the delay between SIGTERM and SIGKILL, when a run is canceled, preempted or times out
+var StopGrace = 10 * time.Second
+
 // DockerRun implements task.Run for Docker
 type DockerRun struct {
 	Path     string    `json:"path"`
@@ -150,7 +153,14 @@ func (d *DockerRun) Wait(ctx context.Context) (_status.Status, error) {
 	}
 	d.Running = false
 	d.Finish = time.Now()
-	if status != 0 {
+	switch status {
+	case _status.Canceled, _status.Timeout:
+		// SIGTERM, then SIGKILL after the grace delay
+		err = cli.ContainerStop(context.TODO(), d.RID, &StopGrace)
+		if err != nil {
+			return _status.Error, err
+		}
+	case _status.Error:
 		// FIXME `docker-compose down`
 		err = cli.ContainerKill(context.TODO(), d.RID, "KILL")
 		if err != nil {
@@ -48,6 +48,20 @@ func init() {
 	}
 }
 
+// ValidationError is a service rejected by a validator
+type ValidationError struct {
+	Service string
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Service == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s, in service %s", e.Message, e.Service)
+}
+
 type VolumeValidator func(source, destination string, readOnly bool) error
 type ServiceValidator func(service map[string]interface{}) error
 
@@ -147,13 +161,17 @@ func (cv *ComposeValidator) Validate(c *Compose) []error {
 		for _, service := range cv.serviceValidators {
 			err := service(value)
 			if err != nil {
-				errs = append(errs, err)
+				errs = append(errs, &ValidationError{Service: name, Message: err.Error()})
 			}
 		}
 		for _, bad := range cv.badConfig {
 			_, ok := value[bad]
 			if ok {
-				errs = append(errs, fmt.Errorf("the %s config is not available", bad))
+				errs = append(errs, &ValidationError{
+					Service: name,
+					Field:   bad,
+					Message: fmt.Sprintf("the %s config is not available", bad),
+				})
 			}
 		}
 		volumesRaw, ok := value["volumes"]
@@ -176,7 +194,7 @@ func (cv *ComposeValidator) Validate(c *Compose) []error {
 			for _, v := range cv.volumeValidators {
 				err := v(slugs[0], slugs[1], ro)
 				if err != nil {
-					errs = append(errs, err)
+					errs = append(errs, &ValidationError{Service: name, Field: "volumes", Message: err.Error()})
 				}
 			}
 		}
@@ -2,63 +2,171 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 
+	"github.com/factorysh/density/apikey"
+	"github.com/factorysh/density/audit"
 	"github.com/factorysh/density/middlewares"
 	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/revocation"
 	"github.com/factorysh/density/scheduler"
+	"github.com/factorysh/density/store"
 	"github.com/factorysh/density/task"
+	"github.com/factorysh/density/template"
+	"github.com/factorysh/density/webhook"
 	"github.com/getsentry/sentry-go"
 	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
 )
 
 type API struct {
-	schd      *scheduler.Scheduler
-	validator *task.Validator
-	recompose *task.ActionRecomposator
-	authKey   string
+	schd        *scheduler.Scheduler
+	validator   *task.Validator
+	recompose   *task.ActionRecomposator
+	templates   *template.Templates
+	webhooks    *webhook.Webhooks
+	deliveries  *webhook.Deliveries
+	apikeys     *apikey.Keys
+	revocations *revocation.Revocations
+	audit       *audit.Log
 }
 
-func RegisterAPI(router *mux.Router, schd *scheduler.Scheduler, validator *task.Validator, authKey string) {
+// RegisterAPI adds the routes of the API, its stores are buckets of the scheduler store
+func RegisterAPI(router *mux.Router, schd *scheduler.Scheduler, validator *task.Validator, verifier *middlewares.Verifier) error {
+	buckets := make(map[string]store.Store)
+	for _, name := range []string{"templates", webhook.WebhooksBucket, webhook.DeliveriesBucket,
+		apikey.Bucket, revocation.Bucket, audit.Bucket} {
+		bucket, err := schd.Bucket(name)
+		if err != nil {
+			return err
+		}
+		buckets[name] = bucket
+	}
+	revocations, err := revocation.NewRevocations(buckets[revocation.Bucket])
+	if err != nil {
+		return err
+	}
 	api := &API{
-		schd:      schd,
-		validator: validator,
-		authKey:   authKey,
+		schd:        schd,
+		validator:   validator,
+		templates:   template.NewTemplates(buckets["templates"]),
+		webhooks:    webhook.NewWebhooks(buckets[webhook.WebhooksBucket]),
+		deliveries:  webhook.NewDeliveries(buckets[webhook.DeliveriesBucket]),
+		apikeys:     apikey.NewKeys(buckets[apikey.Bucket]),
+		revocations: revocations,
+		audit:       audit.NewLog(buckets[audit.Bucket], audit.DefaultMaxAge),
 	}
-	router.Use(middlewares.Auth(authKey))
-	router.HandleFunc("/tasks/{owner}", api.wrapMyHandler(api.HandleGetTasks)).Methods(http.MethodGet)
-	router.HandleFunc("/task/{uuid}", api.wrapMyHandler(api.HandleGetTask)).Methods(http.MethodGet)
-	router.HandleFunc("/tasks", api.wrapMyHandler(api.HandleGetTasks)).Methods(http.MethodGet)
-	router.HandleFunc("/tasks", api.wrapMyHandler(api.HandlePostTasks)).Methods(http.MethodPost)
-	router.HandleFunc("/tasks/{owner}", api.wrapMyHandler(api.HandlePostTasks)).Methods(http.MethodPost)
-	router.HandleFunc("/tasks/{job}", api.wrapMyHandler(api.HandleDeleteTasks)).Methods(http.MethodDelete)
-	router.PathPrefix("/tasks/{job}/volume/").Handler(api.wrapMyHandler(api.HandleGetVolumes)).Methods(http.MethodGet)
+	// API keys are accepted next to the tokens, revoked tokens are rejected
+	verifier.APIKeys = api.apikeys
+	verifier.Revocations = api.revocations
+	verifier.Rejected = api.rejected
+	router.Use(middlewares.Auth(verifier))
+	router.HandleFunc("/tasks/{owner}", api.wrapMyHandler(owner.TasksRead, api.HandleGetTasks)).Methods(http.MethodGet)
+	router.HandleFunc("/task/{uuid}", api.wrapMyHandler(owner.TasksRead, api.HandleGetTask)).Methods(http.MethodGet)
+	router.HandleFunc("/task/{uuid}", api.wrapMyHandler(owner.TasksWrite, api.HandlePutTask)).Methods(http.MethodPut)
+	router.HandleFunc("/task/{uuid}", api.wrapMyHandler(owner.TasksCancel, api.HandleDeleteTasks)).Methods(http.MethodDelete)
+	router.HandleFunc("/task/{uuid}/logs", api.wrapMyHandler(owner.TasksRead, api.HandleGetTaskLogs)).Methods(http.MethodGet)
+	router.HandleFunc("/task/{uuid}/runs/{run}/logs", api.wrapMyHandler(owner.TasksRead, api.HandleGetRunLogs)).Methods(http.MethodGet)
+	router.HandleFunc("/tasks", api.wrapMyHandler(owner.TasksRead, api.HandleGetTasks)).Methods(http.MethodGet)
+	router.HandleFunc("/tasks", api.wrapMyHandler(owner.TasksWrite, api.HandlePostTasks)).Methods(http.MethodPost)
+	router.HandleFunc("/tasks/{owner}", api.wrapMyHandler(owner.TasksWrite, api.HandlePostTasks)).Methods(http.MethodPost)
+	router.HandleFunc("/tasks:{operation}", api.wrapMyHandler("", api.HandlePostBulk)).Methods(http.MethodPost)
+	router.HandleFunc("/tasks/{job}", api.wrapMyHandler(owner.TasksCancel, api.HandleDeleteTasks)).Methods(http.MethodDelete)
+	router.PathPrefix("/tasks/{job}/volume/").Handler(api.wrapMyHandler(owner.VolumesRead, api.HandleGetVolumes)).Methods(http.MethodGet)
+	router.HandleFunc("/events", api.wrapMyHandler(owner.TasksRead, api.HandleGetEvents)).Methods(http.MethodGet)
+	router.HandleFunc("/blackouts", api.wrapMyHandler(owner.TasksRead, api.HandleGetBlackouts)).Methods(http.MethodGet)
+	router.HandleFunc("/blackouts", api.wrapMyHandler(owner.AdminResources, api.HandlePostBlackouts)).Methods(http.MethodPost)
+	router.HandleFunc("/blackouts/{blackout}", api.wrapMyHandler(owner.AdminResources, api.HandleDeleteBlackout)).Methods(http.MethodDelete)
+	router.HandleFunc("/templates", api.wrapMyHandler(owner.TasksRead, api.HandleGetTemplates)).Methods(http.MethodGet)
+	router.HandleFunc("/templates", api.wrapMyHandler(owner.TasksWrite, api.HandlePostTemplates)).Methods(http.MethodPost)
+	router.HandleFunc("/templates/{template}", api.wrapMyHandler(owner.TasksRead, api.HandleGetTemplate)).Methods(http.MethodGet)
+	router.HandleFunc("/templates/{template}", api.wrapMyHandler(owner.TasksWrite, api.HandlePutTemplate)).Methods(http.MethodPut)
+	router.HandleFunc("/templates/{template}", api.wrapMyHandler(owner.TasksWrite, api.HandleDeleteTemplate)).Methods(http.MethodDelete)
+	router.HandleFunc("/webhooks", api.wrapMyHandler(owner.TasksRead, api.HandleGetWebhooks)).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks", api.wrapMyHandler(owner.TasksWrite, api.HandlePostWebhooks)).Methods(http.MethodPost)
+	router.HandleFunc("/webhooks/deliveries", api.wrapMyHandler(owner.TasksRead, api.HandleGetDeliveries)).Methods(http.MethodGet)
+	router.HandleFunc("/webhooks/{webhook}", api.wrapMyHandler(owner.TasksWrite, api.HandleDeleteWebhook)).Methods(http.MethodDelete)
+	router.HandleFunc("/keys", api.wrapMyHandler(owner.AdminKeys, api.HandleGetAPIKeys)).Methods(http.MethodGet)
+	router.HandleFunc("/keys", api.wrapMyHandler(owner.AdminKeys, api.HandlePostAPIKeys)).Methods(http.MethodPost)
+	router.HandleFunc("/keys/{key}", api.wrapMyHandler(owner.AdminKeys, api.HandleGetAPIKey)).Methods(http.MethodGet)
+	router.HandleFunc("/keys/{key}", api.wrapMyHandler(owner.AdminKeys, api.HandleDeleteAPIKey)).Methods(http.MethodDelete)
+	router.HandleFunc("/revocations", api.wrapMyHandler(owner.AdminTokens, api.HandleGetRevocations)).Methods(http.MethodGet)
+	router.HandleFunc("/revocations", api.wrapMyHandler(owner.AdminTokens, api.HandlePostRevocations)).Methods(http.MethodPost)
+	router.HandleFunc("/revocations/{revocation}", api.wrapMyHandler(owner.AdminTokens, api.HandleDeleteRevocation)).Methods(http.MethodDelete)
+	router.HandleFunc("/audit", api.wrapMyHandler(owner.AdminAudit, api.HandleGetAudit)).Methods(http.MethodGet)
+	router.HandleFunc("/templates/{template}/tasks", api.wrapMyHandler(owner.TasksWrite, api.HandlePostTemplateTasks)).Methods(http.MethodPost)
+	return nil
 }
 
-func (a *API) wrapMyHandler(handler func(*owner.Owner, http.ResponseWriter,
+// wrapMyHandler serves a handler, for users with this scope.
+// Without scope, the handler checks it.
+// Mutating requests are written to the audit log.
+func (a *API) wrapMyHandler(scope string, handler func(*owner.Owner, http.ResponseWriter,
 	*http.Request) (interface{}, error)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		id := requestID(r)
 		w.Header().Set("content-type", "application/json")
-		hub := sentry.GetHubFromContext(r.Context())
+		w.Header().Set(RequestIDHeader, id)
+		rw := &responseWriter{ResponseWriter: w}
+		var u *owner.Owner
+		var data interface{}
+		if audited(r.Method) {
+			defer func() { a.record(r, id, u, rw, data) }()
+		}
 		u, err := owner.FromCtx(r.Context())
 		if err != nil {
-			hub.CaptureException(err)
-			w.WriteHeader(http.StatusBadRequest)
+			writeError(rw, r, id, &Error{Status: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+		if scope != "" && !u.Can(scope) {
+			writeError(rw, r, id, missingScope(scope))
 			return
 		}
-		data, err := handler(u, w, r)
+		data, err = handler(u, rw, r)
 		if err != nil {
-			// FIXME correct error handling
-			if hub == nil {
-				fmt.Println("Error:", err)
-			} else {
-				hub.CaptureException(err)
+			writeError(rw, r, id, err)
+			return
+		}
+		if data == nil {
+			if rw.status >= 400 && !rw.written {
+				// the handler only has a status
+				writeError(rw, r, id, errors.New(http.StatusText(rw.status)))
 			}
 			return
 		}
-		json.NewEncoder(w).Encode(data)
+		json.NewEncoder(rw).Encode(data)
+	}
+}
+
+// writeError writes the error envelope, if the response hasn't started.
+// Server errors are sent to Sentry.
+func writeError(w *responseWriter, r *http.Request, id string, err error) {
+	e := newError(w.status, err)
+	e.RequestID = id
+	w.code = e.Code
+	hub := sentry.GetHubFromContext(r.Context())
+	if hub == nil {
+		l := log.WithError(err).WithField("request_id", id).WithField("status", e.Status)
+		if e.Status >= 500 {
+			l.Error("Request failed")
+		} else {
+			l.Info("Request refused")
+		}
+	} else if e.Status >= 500 {
+		hub.WithScope(func(scope *sentry.Scope) {
+			scope.SetTag("request_id", id)
+			hub.CaptureException(err)
+		})
+	}
+	if w.answered() {
+		return
+	}
+	if w.status == 0 {
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(e.Status)
 	}
+	json.NewEncoder(w).Encode(errorEnvelope{Error: e})
 }
 
 // GetDataDir return the configured storage directory for this runner
@@ -10,12 +10,14 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/docker/docker/client"
 	"github.com/factorysh/density/compose"
+	"github.com/factorysh/density/middlewares"
 	"github.com/factorysh/density/runner"
 	"github.com/factorysh/density/scheduler"
 	"github.com/factorysh/density/store"
@@ -40,7 +42,8 @@ func TestAPI(t *testing.T) {
 	}
 	err = recompose.Register(docker, "bob")
 	assert.NoError(t, err)
-	s := scheduler.New(scheduler.NewResources(4, 16*1024), runner.New(dir, recompose), store.NewMemoryStore())
+	s, err := scheduler.New(scheduler.NewResources(4, 16*1024), runner.New(dir, recompose), store.NewMemoryStore())
+	assert.NoError(t, err)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go s.Start(ctx)
@@ -53,7 +56,8 @@ func TestAPI(t *testing.T) {
 	}
 	err = v.Register()
 	assert.NoError(t, err)
-	RegisterAPI(router.PathPrefix("/api").Subrouter(), s, v, key)
+	err = RegisterAPI(router.PathPrefix("/api").Subrouter(), s, v, middlewares.NewVerifier(key))
+	assert.NoError(t, err)
 	ts := httptest.NewServer(router)
 	defer ts.Close()
 
@@ -100,10 +104,14 @@ type testClient struct {
 }
 
 func newClient(root, key string) (*testClient, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	return newClientWithClaims(root, key, jwt.MapClaims{
 		"owner": "bob",
 		"nbf":   time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC).Unix(),
 	})
+}
+
+func newClientWithClaims(root, key string, claims jwt.MapClaims) (*testClient, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	blob, err := token.SignedString([]byte(key))
 	if err != nil {
 		return nil, err
@@ -116,8 +124,18 @@ func newClient(root, key string) (*testClient, error) {
 }
 
 // Do a request.
-// value is a pointer for unmarshaled JSON response
+// value is a pointer for unmarshaled JSON response.
+// Request and response are validated with the OpenAPI document.
 func (t *testClient) Do(method, url string, header http.Header, body io.Reader, value interface{}) (*http.Response, error) {
+	var sent []byte
+	if body != nil {
+		var err error
+		sent, err = ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(sent)
+	}
 	r, err := http.NewRequest(method, t.root+url, body)
 	if err != nil {
 		return nil, err
@@ -126,19 +144,28 @@ func (t *testClient) Do(method, url string, header http.Header, body io.Reader,
 		r.Header = header
 	}
 	r.Header.Set("Authorization", t.authorization)
+	path := strings.TrimPrefix(r.URL.Path, "/api")
+	err = Spec().ValidateRequest(method, path, r.Header.Get("content-type"), sent)
+	if err != nil {
+		return nil, err
+	}
 	res, err := t.client.Do(r)
 	if err != nil {
 		return res, err
 	}
 	defer res.Body.Close()
 	ct := res.Header.Get("content-type")
-	if ct != "application/json" {
-		return res, fmt.Errorf("Wrong content-type : %s", ct)
-	}
 	raw, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return res, err
 	}
+	err = Spec().ValidateResponse(method, path, res.StatusCode, ct, raw)
+	if err != nil {
+		return res, err
+	}
+	if ct != "application/json" {
+		return res, fmt.Errorf("Wrong content-type : %s", ct)
+	}
 	fmt.Println("raw", string(raw))
 	err = json.Unmarshal(raw, value)
 	return res, err
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/factorysh/density/apikey"
+	"github.com/factorysh/density/owner"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// APIKEY is used as key in map of http vars
+const APIKEY = "key"
+
+// CreatedAPIKey is an API key with its secret, only given at its creation
+type CreatedAPIKey struct {
+	*apikey.APIKey
+	Key string `json:"key"`
+}
+
+// HandleGetAPIKeys lists the API keys, their hashes are hidden
+func (a *API) HandleGetAPIKeys(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	keys, err := a.apikeys.List()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	for _, key := range keys {
+		key.Hash = ""
+	}
+	return keys, nil
+}
+
+// HandlePostAPIKeys creates an API key for a service account, the key is only in this response.
+// The key can't have a scope or a group the user doesn't have.
+func (a *API) HandlePostAPIKeys(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	var key apikey.APIKey
+	err := json.NewDecoder(r.Body).Decode(&key)
+	r.Body.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	raw, err := a.apikeys.Create(u, &key)
+	if errors.Is(err, apikey.ErrNotGranted) {
+		return nil, err
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	key.Hash = ""
+	w.WriteHeader(http.StatusCreated)
+	return CreatedAPIKey{APIKey: &key, Key: raw}, nil
+}
+
+// HandleGetAPIKey returns an API key, with its last use
+func (a *API) HandleGetAPIKey(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)[APIKEY])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	key, err := a.apikeys.Get(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	if key == nil {
+		return nil, apikey.ErrUnknownKey
+	}
+	key.Hash = ""
+	return key, nil
+}
+
+// HandleDeleteAPIKey revokes an API key
+func (a *API) HandleDeleteAPIKey(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)[APIKEY])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	err = a.apikeys.Delete(id)
+	if err != nil {
+		return nil, err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil, nil
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/apikey"
+	"github.com/factorysh/density/task"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeys(t *testing.T) {
+	_, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	admin, err := newClientWithClaims(ts.URL, "plop", jwt.MapClaims{"owner": "root", "admin": true})
+	assert.NoError(t, err)
+	bob, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+
+	h := make(http.Header)
+	h.Set("content-type", "application/json")
+	var created CreatedAPIKey
+	res, err := admin.Do("POST", "/api/keys", h, bytes.NewReader([]byte(`{
+		"name": "nightly backup",
+		"owner": "cron",
+		"scopes": ["tasks:read", "tasks:write"]
+	}`)), &created)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.True(t, apikey.IsKey(created.Key))
+	assert.Equal(t, "", created.Hash)
+
+	res, _ = admin.Do("POST", "/api/keys", h, bytes.NewReader([]byte(`{"owner": "cron", "scopes": ["root"]}`)), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = bob.Do("GET", "/api/keys", nil, nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// a key has at most the scopes and groups of its creator
+	ops, err := newClientWithClaims(ts.URL, "plop", jwt.MapClaims{"owner": "ops", "scope": "admin:keys tasks:read", "groups": []string{"data"}})
+	assert.NoError(t, err)
+	for _, body := range []string{
+		`{"owner": "cron", "scopes": ["tasks:read:any"]}`,
+		`{"owner": "cron", "scopes": ["admin:tokens"]}`,
+		`{"owner": "cron", "scopes": ["tasks:read"], "groups": ["finance"]}`,
+	} {
+		res, _ = ops.Do("POST", "/api/keys", h, bytes.NewReader([]byte(body)), nil)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode, body)
+	}
+	res, _ = ops.Do("POST", "/api/keys", h, bytes.NewReader([]byte(`{"owner": "cron", "scopes": ["tasks:read"], "groups": ["data"]}`)), nil)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	// the service account uses its key
+	cron := &testClient{root: ts.URL, client: &http.Client{}, authorization: "Bearer " + created.Key}
+	var tsk task.Task
+	res, err = cron.Do("POST", "/api/tasks", h, bytes.NewReader([]byte(`{
+		"start": "2042-01-01T00:00:00Z",
+		"cpu": 1,
+		"ram": 64,
+		"max_execution_time": "60s",
+		"action": {"dummy": {"name": "backup"}}
+	}`)), &tsk)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "cron", tsk.Owner)
+	res, _ = cron.Do("DELETE", "/api/task/"+tsk.Id.String()+"?wait_for", nil, nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode, "tasks:cancel is missing")
+
+	var keys []apikey.APIKey
+	res, err = admin.Do("GET", "/api/keys", nil, nil, &keys)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, keys, 2)
+	for _, key := range keys {
+		assert.Equal(t, "", key.Hash)
+		if key.Id == created.Id {
+			assert.NotNil(t, key.LastUsed)
+		}
+	}
+
+	res, _ = admin.Do("DELETE", "/api/keys/"+created.Id.String(), nil, nil, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res, _ = admin.Do("GET", "/api/keys/"+created.Id.String(), nil, nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	res, _ = cron.Do("GET", "/api/tasks", nil, nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/factorysh/density/audit"
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/task"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// audited methods are the mutating ones
+func audited(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+}
+
+// record a request in the audit log, after its response
+func (a *API) record(r *http.Request, id string, u *owner.Owner, w *responseWriter, data interface{}) {
+	e := &audit.Entry{
+		Action:    r.Method + " " + r.URL.Path,
+		Path:      r.URL.Path,
+		SourceIP:  r.RemoteAddr,
+		RequestID: id,
+		Status:    w.status,
+		Error:     w.code,
+		Outcome:   audit.Success,
+	}
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			e.Action = r.Method + " " + tmpl
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		e.SourceIP = host
+	}
+	if u != nil {
+		e.Owner, e.Admin = u.Name, u.Admin
+	}
+	vars := mux.Vars(r)
+	if t, ok := data.(*task.Task); ok {
+		e.Task = t.Id.String()
+	} else if report, ok := data.(*BulkReport); ok {
+		for _, result := range report.Results {
+			if !report.DryRun && result.Error == "" {
+				e.Tasks = append(e.Tasks, result.Id.String())
+			}
+		}
+	} else if j, ok := vars[JOB]; ok {
+		e.Task = j
+	} else {
+		e.Task = vars[task.UUID]
+	}
+	if e.Status == 0 {
+		e.Status = http.StatusOK
+	}
+	if e.Status >= 400 {
+		e.Outcome = audit.Failure
+	}
+	err := a.audit.Append(e)
+	if err != nil {
+		log.WithError(err).WithField("request_id", id).Error("Can't write the audit log")
+	}
+}
+
+// rejected answers a request refused by the authentication, with the error envelope.
+// Mutating ones are audited.
+func (a *API) rejected(w http.ResponseWriter, r *http.Request, status int, err error) {
+	id := requestID(r)
+	w.Header().Set(RequestIDHeader, id)
+	rw := &responseWriter{ResponseWriter: w}
+	if audited(r.Method) {
+		defer a.record(r, id, nil, rw, nil)
+	}
+	writeError(rw, r, id, &Error{Status: status, Message: err.Error()})
+}
+
+// HandleGetAudit lists the mutating requests, latest first.
+// `since` and `until` filter by RFC 3339 times, `owner` by owner, `limit` is 100 by default.
+// The cursor of the next page is in the `X-Next-Cursor` header, and a `Link` header.
+func (a *API) HandleGetAudit(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	params := r.URL.Query()
+	filter := &audit.Filter{Owner: params.Get(owner.OWNER)}
+	for _, param := range []struct {
+		name  string
+		value *time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	} {
+		raw := params.Get(param.name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil, err
+		}
+		*param.value = t
+	}
+	limit := 100
+	if raw := params.Get("limit"); raw != "" {
+		var err error
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit <= 0 || limit > audit.MaxLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			return nil, &Error{Message: fmt.Sprintf("limit is between 1 and %d", audit.MaxLimit)}
+		}
+	}
+	entries, next, err := a.audit.List(filter, limit, params.Get("cursor"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+		nextURL := *r.URL
+		query := nextURL.Query()
+		query.Set("cursor", next)
+		nextURL.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, nextURL.RequestURI()))
+	}
+	return entries, nil
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/audit"
+	"github.com/factorysh/density/task"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudit(t *testing.T) {
+	_, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	admin, err := newClientWithClaims(ts.URL, "plop", jwt.MapClaims{"owner": "root", "admin": true})
+	assert.NoError(t, err)
+	bob, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+	start := time.Now().Add(-time.Second)
+
+	h := make(http.Header)
+	h.Set("content-type", "application/json")
+	h.Set(RequestIDHeader, "req-1")
+	var tsk task.Task
+	res, err := bob.Do("POST", "/api/tasks", h, bytes.NewReader([]byte(`{
+		"start": "2042-01-01T00:00:00Z",
+		"cpu": 1,
+		"ram": 64,
+		"max_execution_time": "60s",
+		"action": {"dummy": {"name": "audited"}}
+	}`)), &tsk)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	unknown := uuid.New().String()
+	res, _ = bob.Do("DELETE", "/api/task/"+unknown, nil, nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	res, _ = bob.Do("GET", "/api/audit", nil, nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	var entries []audit.Entry
+	res, err = admin.Do("GET", "/api/audit?owner=bob&since="+url.QueryEscape(start.Format(time.RFC3339)), nil, nil, &entries)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, entries, 2, "reads are not audited")
+	deleted, created := entries[0], entries[1]
+	assert.Equal(t, "DELETE /api/task/{uuid}", deleted.Action)
+	assert.Equal(t, unknown, deleted.Task)
+	assert.Equal(t, audit.Failure, deleted.Outcome)
+	assert.Equal(t, http.StatusNotFound, deleted.Status)
+	assert.Equal(t, "unknown_task", deleted.Error)
+	assert.Equal(t, "POST /api/tasks", created.Action)
+	assert.Equal(t, "bob", created.Owner)
+	assert.False(t, created.Admin)
+	assert.Equal(t, tsk.Id.String(), created.Task)
+	assert.Equal(t, "127.0.0.1", created.SourceIP)
+	assert.Equal(t, "req-1", created.RequestID)
+	assert.Equal(t, audit.Success, created.Outcome)
+	assert.Equal(t, http.StatusCreated, created.Status)
+
+	res, err = admin.Do("GET", "/api/audit?limit=1", nil, nil, &entries)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, entries, 1)
+	res, err = admin.Do("GET", "/api/audit?owner=alice", nil, nil, &entries)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, entries, 0)
+	res, _ = admin.Do("GET", "/api/audit?until=yesterday", nil, nil, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = admin.Do("GET", "/api/audit?limit=0", nil, nil, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// pages
+	res, err = admin.Do("GET", "/api/audit?owner=bob&limit=1", nil, nil, &entries)
+	assert.NoError(t, err)
+	assert.Equal(t, deleted.Id, entries[0].Id)
+	next := res.Header.Get("X-Next-Cursor")
+	assert.NotEqual(t, "", next)
+	res, err = admin.Do("GET", "/api/audit?owner=bob&limit=1&cursor="+next, nil, nil, &entries)
+	assert.NoError(t, err)
+	assert.Equal(t, created.Id, entries[0].Id)
+	assert.Equal(t, "", res.Header.Get("X-Next-Cursor"))
+}
+
+func TestAuditBulkAndRefused(t *testing.T) {
+	s, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	admin, err := newClientWithClaims(ts.URL, "plop", jwt.MapClaims{"owner": "root", "admin": true})
+	assert.NoError(t, err)
+	bob, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+	addLaterTask(t, s, "bob")
+	addLaterTask(t, s, "bob")
+
+	h := make(http.Header)
+	h.Set("content-type", "application/json")
+	var report BulkReport
+	res, err := bob.Do("POST", "/api/tasks:cancel", h, bytes.NewReader([]byte(`{"status": ["waiting"]}`)), &report)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// a bad token, the request is refused before the handler
+	r, err := http.NewRequest("DELETE", ts.URL+"/api/task/"+uuid.New().String(), nil)
+	assert.NoError(t, err)
+	r.Header.Set("Authorization", "Bearer nope")
+	res, err = http.DefaultClient.Do(r)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	var entries []audit.Entry
+	res, err = admin.Do("GET", "/api/audit", nil, nil, &entries)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	refused, bulk := entries[0], entries[1]
+	assert.Equal(t, "DELETE /api/task/{uuid}", refused.Action)
+	assert.Equal(t, "", refused.Owner)
+	assert.Equal(t, audit.Failure, refused.Outcome)
+	assert.Equal(t, http.StatusUnauthorized, refused.Status)
+	assert.Equal(t, "unauthorized", refused.Error)
+	assert.Equal(t, "POST /api/tasks:{operation}", bulk.Action)
+	assert.Len(t, bulk.Tasks, 2)
+	for _, t2 := range tasksOf(t, s, "bob", nil) {
+		assert.Contains(t, bulk.Tasks, t2.Id.String())
+	}
+}
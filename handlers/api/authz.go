@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/scheduler"
+	"github.com/factorysh/density/task"
+	"github.com/google/uuid"
+)
+
+// Every route of the API declares the scope it needs, in RegisterAPI.
+// Handlers check the owner of their tasks with the helpers of this file:
+// a scope is granted on the tasks of the user and its groups, or on every task
+// with its `:any` variant.
+
+// missingScope is the error of a forbidden request
+func missingScope(scope string) error {
+	return &Error{
+		Status:  http.StatusForbidden,
+		Code:    "missing_scope",
+		Message: fmt.Sprintf("Missing scope %s", scope),
+	}
+}
+
+// forbiddenOwner is the error of a request on the tasks of an other owner
+func forbiddenOwner(scope, name string) error {
+	return &Error{
+		Status:  http.StatusForbidden,
+		Code:    "forbidden_owner",
+		Message: fmt.Sprintf("Missing scope %s on the tasks of %s", scope, name),
+	}
+}
+
+// authorizedTask returns the task, if the user has this scope on it.
+// The tasks of others are unknown.
+func (a *API) authorizedTask(u *owner.Owner, id uuid.UUID, scope string) (*task.Task, error) {
+	t, err := a.schd.GetTask(id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || !u.Allowed(scope, t.Owner) {
+		return nil, fmt.Errorf("%w: %s", scheduler.ErrUnknownTask, id.String())
+	}
+	return t, nil
+}
+
+// authorizeOwner checks the owner chosen by a request, or restricts the query
+// to the owners shared with the user
+func authorizeOwner(u *owner.Owner, scope, name string, q *scheduler.Query) error {
+	if name != "" {
+		if !u.Allowed(scope, name) {
+			return forbiddenOwner(scope, name)
+		}
+		q.Owner = name
+		return nil
+	}
+	if !u.Can(scope + owner.Any) {
+		q.Owners = u.Owners()
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/task"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorization(t *testing.T) {
+	s, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	for _, owner := range []string{"bob", "team", "alice"} {
+		addLaterTask(t, s, owner)
+	}
+	ids := make(map[string]string)
+	for _, tsk := range s.List() {
+		ids[tsk.Owner] = tsk.Id.String()
+	}
+	client := func(claims jwt.MapClaims) *testClient {
+		c, err := newClientWithClaims(ts.URL, "plop", claims)
+		assert.NoError(t, err)
+		return c
+	}
+	h := make(http.Header)
+	h.Set("content-type", "application/json")
+	body := func() *bytes.Reader {
+		return bytes.NewReader([]byte(`{
+			"start": "2042-01-01T00:00:00Z",
+			"cpu": 1,
+			"ram": 64,
+			"max_execution_time": "60s",
+			"action": {"dummy": {"name": "later"}}
+		}`))
+	}
+
+	// a viewer of the team reads its tasks, and nothing more
+	viewer := client(jwt.MapClaims{"owner": "carol", "roles": []string{"viewer"}, "groups": []string{"team"}})
+	var tasks []task.Resp
+	res, err := viewer.Do("GET", "/api/tasks", nil, nil, &tasks)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, tasks, 1)
+	res, _ = viewer.Do("GET", "/api/task/"+ids["team"], nil, nil, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res, _ = viewer.Do("GET", "/api/task/"+ids["alice"], nil, nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	res, _ = viewer.Do("DELETE", "/api/task/"+ids["team"]+"?wait_for", nil, nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = viewer.Do("POST", "/api/tasks", h, body(), nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// a member of the team, with the default scopes, shares its tasks
+	member := client(jwt.MapClaims{"owner": "dave", "groups": []string{"team"}})
+	res, err = member.Do("GET", "/api/tasks/team", nil, nil, &tasks)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, tasks, 1)
+	res, _ = member.Do("GET", "/api/tasks/alice", nil, nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	var created task.Task
+	res, err = member.Do("POST", "/api/tasks/team", h, body(), &created)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "team", created.Owner)
+	res, _ = member.Do("POST", "/api/tasks/alice", h, body(), nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = member.Do("DELETE", "/api/task/"+ids["team"]+"?wait_for", nil, nil, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res, _ = member.Do("DELETE", "/api/task/"+ids["alice"]+"?wait_for", nil, nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	// an operator cancels any task, without writing
+	operator := client(jwt.MapClaims{"owner": "erin", "roles": []string{"operator"}})
+	res, err = operator.Do("GET", "/api/tasks", nil, nil, &tasks)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 4)
+	res, _ = operator.Do("DELETE", "/api/task/"+ids["alice"]+"?wait_for", nil, nil, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res, _ = operator.Do("DELETE", "/api/task/"+ids["alice"], nil, nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = operator.Do("POST", "/api/blackouts", h, bytes.NewReader([]byte(`{}`)), nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// explicit scopes replace the default ones
+	reader := client(jwt.MapClaims{"owner": "bob", "scope": "tasks:read"})
+	res, err = reader.Do("GET", "/api/tasks", nil, nil, &tasks)
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	res, _ = reader.Do("POST", "/api/tasks", h, body(), nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = reader.Do("GET", "/api/tasks/"+ids["bob"]+"/volume/result.txt", nil, nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/scheduler"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// BLACKOUT is used as key in map of http vars
+const BLACKOUT = "blackout"
+
+// HandleGetBlackouts lists the global blackouts and those of my groups, all of them with the admin:resources scope
+func (a *API) HandleGetBlackouts(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	blackouts := a.schd.Blackouts.List()
+	if u.Can(owner.AdminResources) {
+		return blackouts, nil
+	}
+	mine := make([]*scheduler.Blackout, 0, len(blackouts))
+	for _, blackout := range blackouts {
+		if blackout.Owner == "" || u.Owns(blackout.Owner) {
+			mine = append(mine, blackout)
+		}
+	}
+	return mine, nil
+}
+
+// HandlePostBlackouts declares a new blackout, with the admin:resources scope
+func (a *API) HandlePostBlackouts(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	var blackout scheduler.Blackout
+	err := json.NewDecoder(r.Body).Decode(&blackout)
+	r.Body.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	if blackout.Id != uuid.Nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, errors.New("don't choose your UUID, it's my job")
+	}
+	err = a.schd.AddBlackout(&blackout)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return blackout, nil
+}
+
+// HandleDeleteBlackout removes a blackout, with the admin:resources scope
+func (a *API) HandleDeleteBlackout(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)[BLACKOUT])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	err = a.schd.DeleteBlackout(id)
+	if err != nil {
+		if err == scheduler.ErrUnknownBlackout {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return nil, err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil, nil
+}
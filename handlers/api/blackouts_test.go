@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlackouts(t *testing.T) {
+	_, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	admin, err := newClientWithClaims(ts.URL, "plop", jwt.MapClaims{"owner": "root", "admin": true})
+	assert.NoError(t, err)
+	bob, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+	h := make(http.Header)
+	h.Set("content-type", "application/json")
+
+	for _, body := range []string{
+		`{"start": "2021-06-01T12:00:00Z", "end": "2021-06-01T14:00:00Z"}`,
+		`{"start": "2021-06-01T12:00:00Z", "end": "2021-06-01T14:00:00Z", "owner": "bob", "selector": "env in (prod,staging)"}`,
+		`{"start": "2021-06-01T12:00:00Z", "end": "2021-06-01T14:00:00Z", "owner": "alice"}`,
+	} {
+		var created scheduler.Blackout
+		res, err := admin.Do("POST", "/api/blackouts", h, bytes.NewReader([]byte(body)), &created)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, res.StatusCode)
+	}
+	res, _ := admin.Do("POST", "/api/blackouts", h, bytes.NewReader([]byte(
+		`{"start": "2021-06-01T12:00:00Z", "end": "2021-06-01T14:00:00Z", "selector": "env in ()"}`)), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	var blackouts []scheduler.Blackout
+	res, err = admin.Do("GET", "/api/blackouts", nil, nil, &blackouts)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, blackouts, 3)
+
+	// the global blackout and mine
+	res, err = bob.Do("GET", "/api/blackouts", nil, nil, &blackouts)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, blackouts, 2)
+	for _, blackout := range blackouts {
+		assert.NotEqual(t, "alice", blackout.Owner)
+	}
+}
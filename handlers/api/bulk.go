@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/scheduler"
+	"github.com/factorysh/density/selector"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// MaxBulk is the maximum number of tasks of a bulk operation
+var MaxBulk = 1000
+
+// Bulk is a bulk operation request
+type Bulk struct {
+	Selector string   `json:"selector"`
+	Owner    string   `json:"owner"` // One of my groups, or anybody with the :any scope
+	Status   []string `json:"status"`
+	DryRun   bool     `json:"dry_run"`
+}
+
+// BulkResult is the result of an operation on a task
+type BulkResult struct {
+	Id     uuid.UUID `json:"id"`
+	Owner  string    `json:"owner"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// BulkReport lists the tasks affected by a bulk operation
+type BulkReport struct {
+	DryRun    bool         `json:"dry_run"`
+	Results   []BulkResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+}
+
+func (a *API) bulkOperation(name string) func(uuid.UUID) error {
+	switch name {
+	case "cancel":
+		return a.schd.Cancel
+	case "delete":
+		return a.schd.Delete
+	case "pause":
+		return a.schd.Pause
+	case "resume":
+		return a.schd.Resume
+	case "retry":
+		return a.schd.Retry
+	}
+	return nil
+}
+
+// bulkScope is the scope of an operation
+func bulkScope(name string) string {
+	if name == "cancel" {
+		return owner.TasksCancel
+	}
+	return owner.TasksWrite
+}
+
+// newBulkQuery reads the filters of a bulk operation, a selector or a status is mandatory
+func newBulkQuery(bulk *Bulk) (*scheduler.Query, error) {
+	if bulk.Selector == "" && len(bulk.Status) == 0 {
+		return nil, errors.New("A selector or a status is mandatory")
+	}
+	q := &scheduler.Query{
+		Statuses: make(map[_status.Status]bool),
+	}
+	var err error
+	q.Selector, err = selector.Parse(bulk.Selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range bulk.Status {
+		s, err := _status.Parse(name)
+		if err != nil {
+			return nil, err
+		}
+		q.Statuses[s] = true
+	}
+	return q, nil
+}
+
+// HandlePostBulk handles a post on /tasks:{operation}, the operation is
+// cancel, delete, pause, resume or retry. It's applied to each task matching
+// the selector, owner and status filters, a report lists the results.
+// With `dry_run`, the affected tasks are listed, nothing is done.
+func (a *API) HandlePostBulk(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	name := mux.Vars(r)["operation"]
+	operation := a.bulkOperation(name)
+	if operation == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, errors.New("Unknown operation")
+	}
+	scope := bulkScope(name)
+	if !u.Can(scope) {
+		return nil, missingScope(scope)
+	}
+	var bulk Bulk
+	err := json.NewDecoder(r.Body).Decode(&bulk)
+	r.Body.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	q, err := newBulkQuery(&bulk)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	err = authorizeOwner(u, scope, bulk.Owner, q)
+	if err != nil {
+		return nil, err
+	}
+	q.Limit = MaxBulk + 1
+	tasks, _, err := a.schd.Query(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	if len(tasks) > MaxBulk {
+		return nil, &Error{
+			Status:  http.StatusBadRequest,
+			Code:    "too_many_tasks",
+			Message: fmt.Sprintf("More than %d tasks, use a narrower selector", MaxBulk),
+		}
+	}
+
+	report := &BulkReport{
+		DryRun:  bulk.DryRun,
+		Results: make([]BulkResult, 0, len(tasks)),
+	}
+	for _, t := range tasks {
+		result := BulkResult{
+			Id:     t.Id,
+			Owner:  t.Owner,
+			Status: t.Status.String(),
+		}
+		if !bulk.DryRun {
+			err = operation(t.Id)
+			if err != nil {
+				result.Error = err.Error()
+				report.Failed++
+			} else {
+				report.Succeeded++
+			}
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
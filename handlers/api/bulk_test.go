@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/task"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulk(t *testing.T) {
+	s, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	for _, env := range []string{"prod", "staging", "staging"} {
+		_, err := s.Add(&task.Task{
+			Owner:           "bob",
+			Start:           time.Now().Add(time.Hour),
+			MaxExectionTime: time.Minute,
+			Action:          &task.DummyAction{Name: env},
+			CPU:             1,
+			RAM:             64,
+			Labels:          map[string]string{"env": env},
+		})
+		assert.NoError(t, err)
+	}
+	addLaterTask(t, s, "alice")
+	c, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+	h := make(http.Header)
+	h.Set("content-type", "application/json")
+
+	var report BulkReport
+	res, err := c.Do("POST", "/api/tasks:cancel", h,
+		bytes.NewReader([]byte(`{"selector": "env=staging", "dry_run": true}`)), &report)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.True(t, report.DryRun)
+	assert.Len(t, report.Results, 2)
+	assert.Equal(t, 0, report.Succeeded)
+	assert.Len(t, tasksOf(t, s, "bob", map[string]string{"env": "staging"}), 2)
+	for _, t2 := range tasksOf(t, s, "bob", nil) {
+		assert.Equal(t, _status.Waiting, t2.Status)
+	}
+
+	res, err = c.Do("POST", "/api/tasks:cancel", h,
+		bytes.NewReader([]byte(`{"selector": "env=staging"}`)), &report)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Succeeded)
+	assert.Equal(t, 0, report.Failed)
+
+	// the prod task is still waiting, it can't be retried
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := s.Pubsub.Subscribe(ctx)
+	res, err = c.Do("POST", "/api/tasks:retry", h,
+		bytes.NewReader([]byte(`{"selector": "env"}`)), &report)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Succeeded)
+	assert.Equal(t, 1, report.Failed)
+	for done := 0; done < 2; {
+		if event := <-events; event.Action == "Done" {
+			done++
+		}
+	}
+	cancel()
+
+	res, err = c.Do("POST", "/api/tasks:delete", h,
+		bytes.NewReader([]byte(`{"selector": "env"}`)), &report)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.Succeeded)
+	assert.Len(t, tasksOf(t, s, "bob", nil), 0)
+	assert.Len(t, tasksOf(t, s, "alice", nil), 1)
+
+	// a filter is mandatory, and the owner is mine, or one of my groups
+	res, _ = c.Do("POST", "/api/tasks:delete", h, bytes.NewReader([]byte(`{}`)), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	res, _ = c.Do("POST", "/api/tasks:delete", h,
+		bytes.NewReader([]byte(`{"owner": "alice", "status": ["waiting"]}`)), nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = c.Do("POST", "/api/tasks:plop", h, bytes.NewReader([]byte(`{"status": ["waiting"]}`)), nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestBulkScopes(t *testing.T) {
+	s, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	addLaterTask(t, s, "bob")
+	addLaterTask(t, s, "bob")
+	h := make(http.Header)
+	h.Set("content-type", "application/json")
+
+	// deleting needs tasks:write, not tasks:cancel
+	writer, err := newClientWithClaims(ts.URL, "plop", jwt.MapClaims{"owner": "bob", "scope": "tasks:read tasks:write"})
+	assert.NoError(t, err)
+	res, _ := writer.Do("POST", "/api/tasks:cancel", h, bytes.NewReader([]byte(`{"status": ["waiting"]}`)), nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	MaxBulk = 1
+	defer func() { MaxBulk = 1000 }()
+	res, _ = writer.Do("POST", "/api/tasks:delete", h, bytes.NewReader([]byte(`{"status": ["waiting"]}`)), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Len(t, tasksOf(t, s, "bob", nil), 2)
+
+	MaxBulk = 2
+	var report BulkReport
+	res, err = writer.Do("POST", "/api/tasks:delete", h, bytes.NewReader([]byte(`{"status": ["waiting"]}`)), &report)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, 2, report.Succeeded)
+	assert.Len(t, tasksOf(t, s, "bob", nil), 0)
+}
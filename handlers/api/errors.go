@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/factorysh/density/apikey"
+	"github.com/factorysh/density/compose"
+	"github.com/factorysh/density/revocation"
+	"github.com/factorysh/density/scheduler"
+	"github.com/factorysh/density/webhook"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader identifies a request, it's read from the client or generated
+const RequestIDHeader = "X-Request-Id"
+
+// Error is the body of every API error, in an `error` envelope
+type Error struct {
+	Status    int          `json:"-"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id"`
+}
+
+// FieldError explains why a field is rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if len(e.Details) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s %v", e.Message, e.Details)
+}
+
+type errorEnvelope struct {
+	Error *Error `json:"error"`
+}
+
+// codes of the HTTP statuses, for errors without a more specific code
+var codes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusPreconditionFailed:    "precondition_failed",
+	http.StatusRequestEntityTooLarge: "too_large",
+	http.StatusPreconditionRequired:  "precondition_required",
+	http.StatusInternalServerError:   "internal_error",
+}
+
+// sentinels are the known errors of the scheduler and its stores
+var sentinels = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{scheduler.ErrUnknownTask, http.StatusNotFound, "unknown_task"},
+	{scheduler.ErrUnknownBlackout, http.StatusNotFound, "unknown_blackout"},
+	{webhook.ErrUnknownWebhook, http.StatusNotFound, "unknown_webhook"},
+	{apikey.ErrUnknownKey, http.StatusNotFound, "unknown_key"},
+	{apikey.ErrNotGranted, http.StatusForbidden, "not_granted"},
+	{revocation.ErrUnknownRevocation, http.StatusNotFound, "unknown_revocation"},
+	{scheduler.ErrConflict, http.StatusPreconditionFailed, "task_modified"},
+	{scheduler.ErrNotWaiting, http.StatusConflict, "not_waiting"},
+	{scheduler.ErrNotFinished, http.StatusConflict, "not_finished"},
+	{scheduler.ErrNotRunning, http.StatusConflict, "not_running"},
+}
+
+func codeOf(status int) string {
+	code, ok := codes[status]
+	if ok {
+		return code
+	}
+	if status >= 500 {
+		return "internal_error"
+	}
+	return "error"
+}
+
+// composeField is the path of a compose validation error in a task
+func composeField(err *compose.ValidationError) string {
+	field := "action"
+	if err.Service != "" {
+		field += ".services." + err.Service
+	}
+	if err.Field != "" {
+		field += "." + err.Field
+	}
+	return field
+}
+
+// newError translates an error, status is the one written by the handler, or 0.
+// Typed errors of the scheduler and compose choose the status, when the handler didn't.
+func newError(status int, err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		e := *apiErr
+		if status != 0 {
+			e.Status = status
+		}
+		if e.Status == 0 {
+			e.Status = http.StatusBadRequest
+		}
+		if e.Code == "" {
+			e.Code = codeOf(e.Status)
+		}
+		return &e
+	}
+
+	e := &Error{Message: err.Error()}
+	var invalid *scheduler.InvalidTaskError
+	var invalidCompose *compose.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		e.Status = http.StatusBadRequest
+		e.Code = "invalid_task"
+		e.Details = []FieldError{{Field: invalid.Field, Message: invalid.Message}}
+	case errors.As(err, &invalidCompose):
+		e.Status = http.StatusBadRequest
+		e.Code = "invalid_compose"
+		e.Details = []FieldError{{Field: composeField(invalidCompose), Message: invalidCompose.Message}}
+	default:
+		for _, sentinel := range sentinels {
+			if errors.Is(err, sentinel.err) {
+				e.Status = sentinel.status
+				e.Code = sentinel.code
+				break
+			}
+		}
+	}
+	if status != 0 {
+		if e.Status != status {
+			e.Code = ""
+		}
+		e.Status = status
+	}
+	if e.Status == 0 {
+		e.Status = http.StatusInternalServerError
+	}
+	if e.Code == "" {
+		e.Code = codeOf(e.Status)
+	}
+	if e.Status >= 500 {
+		// don't leak internals, the request id is enough for debugging
+		e.Message = http.StatusText(e.Status)
+	}
+	return e
+}
+
+// requestID of a request, from its header, or a new one
+func requestID(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > 128 {
+		return uuid.New().String()
+	}
+	return id
+}
+
+// responseWriter remembers what the handler has already written
+type responseWriter struct {
+	http.ResponseWriter
+	status   int
+	code     string // of the error
+	written  bool
+	hijacked bool
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush is used for streaming
+func (w *responseWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack is used by websockets
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("Hijacking is not supported")
+	}
+	w.hijacked = true
+	return hijacker.Hijack()
+}
+
+// answered is true when the response can't be an error anymore
+func (w *responseWriter) answered() bool {
+	return w.hijacked || w.written || (w.status != 0 && w.status < 400)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/factorysh/density/compose"
+	"github.com/factorysh/density/scheduler"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewError(t *testing.T) {
+	e := newError(0, fmt.Errorf("%w: plop", scheduler.ErrUnknownTask))
+	assert.Equal(t, http.StatusNotFound, e.Status)
+	assert.Equal(t, "unknown_task", e.Code)
+
+	e = newError(0, &compose.ValidationError{Service: "web", Field: "volumes", Message: "Relative volume only"})
+	assert.Equal(t, http.StatusBadRequest, e.Status)
+	assert.Equal(t, "invalid_compose", e.Code)
+	assert.Equal(t, []FieldError{{Field: "action.services.web.volumes", Message: "Relative volume only"}}, e.Details)
+
+	// the status written by the handler wins
+	e = newError(http.StatusConflict, scheduler.ErrConflict)
+	assert.Equal(t, http.StatusConflict, e.Status)
+	assert.Equal(t, "conflict", e.Code)
+
+	e = newError(0, errors.New("secret internal stuff"))
+	assert.Equal(t, http.StatusInternalServerError, e.Status)
+	assert.Equal(t, "Internal Server Error", e.Message)
+}
+
+func TestAPIErrors(t *testing.T) {
+	_, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	c, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+
+	var body errorEnvelope
+	res, err := c.Do("DELETE", "/api/tasks/plop", nil, nil, &body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, "bad_request", body.Error.Code)
+	assert.NotEqual(t, "", body.Error.RequestID)
+	assert.Equal(t, res.Header.Get(RequestIDHeader), body.Error.RequestID)
+
+	h := make(http.Header)
+	h.Set(RequestIDHeader, "my-request")
+	res, err = c.Do("GET", "/api/task/"+uuid.New().String(), h, nil, &body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	assert.Equal(t, "unknown_task", body.Error.Code)
+	assert.Equal(t, "my-request", body.Error.RequestID)
+
+	res, err = c.Do("DELETE", "/api/tasks/"+uuid.New().String()+"?wait_for", nil, nil, &body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	h = make(http.Header)
+	h.Set("content-type", "application/json")
+	res, err = c.Do("POST", "/api/tasks", h, bytes.NewReader([]byte(`{
+		"cpu": 1,
+		"ram": 64,
+		"max_execution_time": "60s",
+		"labels": {"env": "pr/od"},
+		"action": {"dummy": {"name": "labels"}}
+	}`)), &body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, "invalid_task", body.Error.Code)
+	assert.Equal(t, []FieldError{{Field: "labels.env", Message: "Value `pr/od` do not respect labels policy"}}, body.Error.Details)
+
+	body = errorEnvelope{}
+	res, err = c.Do("POST", "/api/tasks", h, bytes.NewReader([]byte(`{
+		"cpu": 1000,
+		"ram": 64,
+		"max_execution_time": "60s",
+		"action": {"dummy": {"name": "cpu"}}
+	}`)), &body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, "invalid_task", body.Error.Code)
+	assert.Equal(t, "cpu", body.Error.Details[0].Field)
+
+	// refused by the authentication
+	body = errorEnvelope{}
+	bad := &testClient{root: ts.URL, client: c.client, authorization: "Bearer nope"}
+	res, err = bad.Do("GET", "/api/tasks", nil, nil, &body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(t, "unauthorized", body.Error.Code)
+	assert.NotEqual(t, "", body.Error.Message)
+	assert.Equal(t, res.Header.Get(RequestIDHeader), body.Error.RequestID)
+}
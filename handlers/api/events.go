@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/selector"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/gorilla/websocket"
+)
+
+// keepAlive is the period of SSE comments and websocket pings, for proxies
+const keepAlive = 30 * time.Second
+
+var upgrader = websocket.Upgrader{}
+
+// eventFilter chooses the events sent to a subscriber
+type eventFilter struct {
+	owner    *owner.Owner
+	statuses map[_status.Status]bool
+	labels   map[string]string
+	selector selector.Selector
+}
+
+// newEventFilter uses the `status` parameter, comma separated new statuses, a label `selector`,
+// the other parameters are labels
+func newEventFilter(u *owner.Owner, query url.Values) (*eventFilter, error) {
+	filter := &eventFilter{
+		owner:    u,
+		statuses: make(map[_status.Status]bool),
+		labels:   make(map[string]string),
+	}
+	for key, values := range query {
+		if len(values) > 1 {
+			return nil, fmt.Errorf("http parameter %s is used multiple times", key)
+		}
+		switch key {
+		case "status":
+			for _, name := range strings.Split(values[0], ",") {
+				s, err := _status.Parse(name)
+				if err != nil {
+					return nil, err
+				}
+				filter.statuses[s] = true
+			}
+		case "selector":
+			var err error
+			filter.selector, err = selector.Parse(values[0])
+			if err != nil {
+				return nil, err
+			}
+		case "token", "last_event_id": // authentication and cursor, not labels
+		default:
+			filter.labels[key] = values[0]
+		}
+	}
+	return filter, nil
+}
+
+// cursor is the sequence of the last event seen by the client, from the
+// `Last-Event-ID` header or the `last_event_id` parameter.
+// Without cursor, only new events are sent.
+func cursor(r *http.Request) (uint64, error) {
+	id := r.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = r.URL.Query().Get("last_event_id")
+	}
+	if id == "" {
+		return math.MaxUint64, nil
+	}
+	return strconv.ParseUint(id, 10, 64)
+}
+
+// match uses the owner and labels of the event, the task may be already deleted
+func (filter *eventFilter) match(event pubsub.Event) bool {
+	if len(filter.statuses) > 0 {
+		to, err := _status.Parse(event.To)
+		if err != nil || !filter.statuses[to] {
+			return false
+		}
+	}
+	if !filter.owner.Allowed(owner.TasksRead, event.Owner) {
+		return false
+	}
+	for key, value := range filter.labels {
+		eventValue, found := event.Labels[key]
+		if !found || eventValue != value {
+			return false
+		}
+	}
+	return filter.selector.Matches(event.Labels)
+}
+
+// HandleGetEvents streams events of the scheduler, with Server-Sent Events, or a websocket.
+// Users see the events of their tasks and of their groups, the tasks:read:any scope sees everything.
+func (a *API) HandleGetEvents(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	filter, err := newEventFilter(u, r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	since, err := cursor(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	// subscribe before answering, nothing is lost after the headers
+	events, err := a.schd.Pubsub.SubscribeSince(r.Context(), since)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	if websocket.IsWebSocketUpgrade(r) {
+		return nil, a.streamWebsocket(filter, events, w, r)
+	}
+	return nil, a.streamSSE(filter, events, w, r)
+}
+
+func (a *API) streamSSE(filter *eventFilter, events chan pubsub.Event, w http.ResponseWriter, r *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return errors.New("Streaming is not supported")
+	}
+	w.Header().Set("content-type", "text/event-stream")
+	w.Header().Set("cache-control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-ticker.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil {
+				return err
+			}
+		case event, ok := <-events:
+			if !ok { // too slow, the client can resume with its last event id
+				return nil
+			}
+			if !filter.match(event) {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Action, data)
+			if err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func (a *API) streamWebsocket(filter *eventFilter, events chan pubsub.Event, w http.ResponseWriter, r *http.Request) error {
+	// the upgrader writes its own headers
+	w.Header().Del("content-type")
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// read messages, only to handle pong and close
+	closed := make(chan interface{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(time.Second))
+		case <-closed:
+			return nil
+		case <-ticker.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(keepAlive))
+			if err != nil {
+				return err
+			}
+		case event, ok := <-events:
+			if !ok {
+				return conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "too slow"), time.Now().Add(time.Second))
+			}
+			if !filter.match(event) {
+				continue
+			}
+			err = conn.WriteJSON(event)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/scheduler"
+	"github.com/factorysh/density/task"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func addLaterTask(t *testing.T, s *scheduler.Scheduler, owner string) {
+	_, err := s.Add(&task.Task{
+		Owner:           owner,
+		Start:           time.Now().Add(time.Hour),
+		MaxExectionTime: time.Minute,
+		Action:          &task.DummyAction{Name: owner},
+		CPU:             1,
+		RAM:             64,
+	})
+	assert.NoError(t, err)
+}
+
+func TestSSE(t *testing.T) {
+	s, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	c, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, err := http.NewRequestWithContext(ctx, "GET", ts.URL+"/api/events?status=waiting", nil)
+	assert.NoError(t, err)
+	r.Header.Set("Authorization", c.authorization)
+	res, err := http.DefaultClient.Do(r)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("content-type"))
+
+	addLaterTask(t, s, "alice")
+	addLaterTask(t, s, "bob")
+
+	reader := bufio.NewReader(res.Body)
+	lines := make([]string, 0)
+	for len(lines) < 4 {
+		line, err := reader.ReadString('\n')
+		assert.NoError(t, err)
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	assert.Equal(t, "event: added", lines[1])
+	var event pubsub.Event
+	err = json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &event)
+	assert.NoError(t, err)
+	tasks := tasksOf(t, s, "bob", nil)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, tasks[0].Id, event.Id)
+	assert.Equal(t, fmt.Sprintf("id: %d", event.Seq), lines[0])
+}
+
+func TestSSEResume(t *testing.T) {
+	s, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	c, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+
+	addLaterTask(t, s, "bob")
+	first := s.Pubsub.Last()
+	addLaterTask(t, s, "bob")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, err := http.NewRequestWithContext(ctx, "GET", ts.URL+"/api/events?status=waiting", nil)
+	assert.NoError(t, err)
+	r.Header.Set("Authorization", c.authorization)
+	r.Header.Set("Last-Event-ID", fmt.Sprintf("%d", first))
+	res, err := http.DefaultClient.Do(r)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+
+	// the missed event is replayed
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("id: %d", s.Pubsub.Last()), strings.TrimSpace(line))
+}
+
+func TestWebsocketEvents(t *testing.T) {
+	s, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	c, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+
+	h := make(http.Header)
+	h.Set("Authorization", c.authorization)
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(ts.URL, "http", "ws", 1)+"/api/events", h)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	addLaterTask(t, s, "alice")
+	addLaterTask(t, s, "bob")
+
+	var event pubsub.Event
+	err = conn.ReadJSON(&event)
+	assert.NoError(t, err)
+	assert.Equal(t, "added", event.Action)
+	tasks := tasksOf(t, s, "bob", nil)
+	assert.Len(t, tasks, 1)
+	assert.Equal(t, tasks[0].Id, event.Id)
+}
+
+func TestEventFilterStatus(t *testing.T) {
+	admin := &owner.Owner{Name: "root", Admin: true}
+	filter, err := newEventFilter(admin, url.Values{"status": []string{"RUNNING,done"}})
+	assert.NoError(t, err)
+	assert.True(t, filter.match(pubsub.Event{Action: "Running", To: "Running"}))
+	assert.True(t, filter.match(pubsub.Event{Action: "updated", To: "Done"}))
+	assert.False(t, filter.match(pubsub.Event{Action: "added", To: "Waiting"}))
+
+	_, err = newEventFilter(admin, url.Values{"status": []string{"added"}})
+	assert.Error(t, err)
+}
+
+func TestEventFilterOwner(t *testing.T) {
+	bob := &owner.Owner{Name: "bob", Groups: []string{"team"}}
+	filter, err := newEventFilter(bob, url.Values{"env": []string{"prod"}, "selector": []string{"app=web"}})
+	assert.NoError(t, err)
+	prod := map[string]string{"env": "prod", "app": "web"}
+	// the task is unknown, already deleted, its events are still sent
+	assert.True(t, filter.match(pubsub.Event{Action: "Done", To: "Done", Owner: "bob", Labels: prod}))
+	assert.True(t, filter.match(pubsub.Event{Action: "added", Owner: "team", Labels: prod}))
+	assert.False(t, filter.match(pubsub.Event{Action: "added", Owner: "alice", Labels: prod}))
+	assert.False(t, filter.match(pubsub.Event{Action: "added", Owner: "bob", Labels: map[string]string{"env": "prod"}}))
+	assert.False(t, filter.match(pubsub.Event{Action: "added", Owner: "bob"}))
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/factorysh/density/logs"
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/scheduler"
+	"github.com/factorysh/density/task"
+	_run "github.com/factorysh/density/task/run"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// RUN is used as key in map of http vars
+const RUN = "run"
+
+// logsQuery reads the `service` parameter, comma separated, `tail` and `timestamps`
+type logsQuery struct {
+	services   map[string]bool
+	tail       int
+	timestamps bool
+}
+
+func newLogsQuery(query url.Values) (*logsQuery, error) {
+	q := &logsQuery{
+		services: make(map[string]bool),
+	}
+	var err error
+	if query.Get("tail") != "" {
+		q.tail, err = strconv.Atoi(query.Get("tail"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if query.Get("service") != "" {
+		for _, service := range strings.Split(query.Get("service"), ",") {
+			q.services[service] = true
+		}
+	}
+	q.timestamps, _ = strconv.ParseBool(query.Get("timestamps"))
+	return q, nil
+}
+
+func (q *logsQuery) serviceList() []string {
+	services := make([]string, 0, len(q.services))
+	for service := range q.services {
+		services = append(services, service)
+	}
+	return services
+}
+
+// logsTask returns the task, if I can read it
+func (a *API) logsTask(u *owner.Owner, w http.ResponseWriter, r *http.Request) (*task.Task, error) {
+	id, err := uuid.Parse(mux.Vars(r)[task.UUID])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	return a.authorizedTask(u, id, owner.TasksRead)
+}
+
+// HandleGetRunLogs returns the logs of a run, as text, like docker-compose logs.
+// The `service` parameter filters, comma separated, `tail` keeps the latest lines,
+// `timestamps` shows the time of each line.
+func (a *API) HandleGetRunLogs(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	run, err := strconv.Atoi(mux.Vars(r)[RUN])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	q, err := newLogsQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	t, err := a.logsTask(u, w, r)
+	if err != nil {
+		return nil, err
+	}
+	return nil, a.writeStoredLogs(t, run, q, w)
+}
+
+// HandleGetTaskLogs returns the logs of the latest run of a task.
+// With `follow`, the logs of the running task are streamed, with chunked HTTP or a websocket,
+// from the start of the run until its end.
+func (a *API) HandleGetTaskLogs(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	q, err := newLogsQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	t, err := a.logsTask(u, w, r)
+	if err != nil {
+		return nil, err
+	}
+	follow, _ := strconv.ParseBool(r.URL.Query().Get("follow"))
+	if !follow {
+		return nil, a.writeStoredLogs(t, lastRun(t), q, w)
+	}
+	if websocket.IsWebSocketUpgrade(r) {
+		return nil, a.followWebsocket(t, q, w, r)
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, errors.New("Streaming is not supported")
+	}
+	started := false
+	err = a.schd.FollowLogs(r.Context(), t.Id, func(line _run.Line) error {
+		if len(q.services) > 0 && !q.services[line.Service] {
+			return nil
+		}
+		if !started {
+			w.Header().Set("content-type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		err := logs.Format(w, line, q.timestamps)
+		if err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err == scheduler.ErrNotRunning {
+		// already finished, its logs are stored
+		return nil, a.writeStoredLogs(t, lastRun(t), q, w)
+	}
+	if err != nil && !started {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	return nil, err
+}
+
+func (a *API) followWebsocket(t *task.Task, q *logsQuery, w http.ResponseWriter, r *http.Request) error {
+	// the upgrader writes its own headers
+	w.Header().Del("content-type")
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = a.schd.FollowLogs(r.Context(), t.Id, func(line _run.Line) error {
+		if len(q.services) > 0 && !q.services[line.Service] {
+			return nil
+		}
+		return conn.WriteJSON(line)
+	})
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	}
+	return conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason))
+}
+
+// lastRun is the id of the latest run of a task
+func lastRun(t *task.Task) int {
+	if len(t.Runs) > 0 {
+		return t.Runs[0].ID
+	}
+	return t.RunCounter
+}
+
+func (a *API) writeStoredLogs(t *task.Task, run int, q *logsQuery, w http.ResponseWriter) error {
+	if a.schd.Logs == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return fmt.Errorf("logs are not stored")
+	}
+	lines, err := a.schd.Logs.Read(t.Id, run, q.serviceList(), q.tail)
+	if err != nil {
+		switch {
+		case os.IsNotExist(err):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, logs.ErrBadService):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return err
+	}
+	w.Header().Set("content-type", "text/plain; charset=utf-8")
+	for _, line := range lines {
+		err = logs.Format(w, line, q.timestamps)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
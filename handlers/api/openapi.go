@@ -0,0 +1,701 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/factorysh/density/middlewares"
+	"github.com/factorysh/density/openapi"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/factorysh/density/version"
+)
+
+var (
+	spec     *openapi.Document
+	specOnce sync.Once
+)
+
+// Spec is the OpenAPI document of the API, every route of RegisterAPI is described
+func Spec() *openapi.Document {
+	specOnce.Do(func() {
+		spec = newSpec()
+	})
+	return spec
+}
+
+// HandleGetOpenAPI serves the OpenAPI document, without authentication
+func HandleGetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(Spec())
+}
+
+func str(description string) *openapi.Schema {
+	return &openapi.Schema{Type: "string", Description: description}
+}
+
+func integer(description string) *openapi.Schema {
+	return &openapi.Schema{Type: "integer", Description: description}
+}
+
+func boolean(description string) *openapi.Schema {
+	return &openapi.Schema{Type: "boolean", Description: description}
+}
+
+func dateTime(description string) *openapi.Schema {
+	return &openapi.Schema{Type: "string", Format: "date-time", Description: description}
+}
+
+func uuidSchema(description string) *openapi.Schema {
+	return &openapi.Schema{Type: "string", Format: "uuid", Description: description}
+}
+
+// any value, even null
+func any(description string) *openapi.Schema {
+	return &openapi.Schema{Nullable: true, Description: description}
+}
+
+func nullable(s *openapi.Schema) *openapi.Schema {
+	s.Nullable = true
+	return s
+}
+
+func labels() *openapi.Schema {
+	return nullable(openapi.MapOf(str("")))
+}
+
+func pathParam(name, description string) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "path", Required: true, Description: description, Schema: str("")}
+}
+
+func queryParam(name, description string, schema *openapi.Schema) *openapi.Parameter {
+	return &openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func jsonBody(schema *openapi.Schema) *openapi.RequestBody {
+	return &openapi.RequestBody{Required: true, Content: openapi.JSON(schema)}
+}
+
+// responses of an operation, with the error envelope by default
+func responses(status string, response *openapi.Response) map[string]*openapi.Response {
+	return map[string]*openapi.Response{
+		status: response,
+		"default": {
+			Description: "Error",
+			Content:     openapi.JSON(openapi.Ref("Error")),
+		},
+	}
+}
+
+func jsonResponse(description string, schema *openapi.Schema) *openapi.Response {
+	return &openapi.Response{Description: description, Content: openapi.JSON(schema)}
+}
+
+func content(description, media string, schema *openapi.Schema) *openapi.Response {
+	return &openapi.Response{
+		Description: description,
+		Content:     map[string]*openapi.MediaType{media: {Schema: schema}},
+	}
+}
+
+func statuses() []interface{} {
+	names := make([]interface{}, 0)
+	for s := _status.Waiting; s <= _status.Error; s++ {
+		names = append(names, s.String())
+	}
+	return names
+}
+
+func schemas() map[string]*openapi.Schema {
+	taskInput := map[string]*openapi.Schema{
+		"start":              dateTime("Start time, now if empty"),
+		"max_wait_time":      openapi.Ref("Duration"),
+		"max_execution_time": openapi.Ref("Duration"),
+		"cpu":                integer("CPU quota"),
+		"ram":                integer("RAM quota, in MB"),
+		"action":             openapi.MapOf(&openapi.Schema{Type: "object"}),
+		"retry":              integer("Number of retry before crash"),
+		"every":              integer("Periodic execution, in nanoseconds. Exclusive with cron"),
+		"cron":               str("Cron definition. Exclusive with every"),
+		"catch_up":           boolean("Run a periodic occurrence missed during a blackout once it ends"),
+		"priority":           integer("Higher priority starts first"),
+		"preemptible":        boolean("Can be stopped to make room for a task with a higher priority"),
+		"paused":             boolean("A paused waiting task doesn't start"),
+		"array":              openapi.Ref("Array"),
+		"parameters":         openapi.MapOf(str("")),
+		"environments":       openapi.MapOf(str("")),
+		"labels":             labels(),
+		"notify":             nullable(openapi.ArrayOf(openapi.Ref("Notify"))),
+	}
+
+	task := map[string]*openapi.Schema{
+		"id":                 uuidSchema(""),
+		"status":             openapi.Ref("Status"),
+		"mtime":              dateTime("Modified time"),
+		"revision":           integer("Incremented at each modification, it's the ETag"),
+		"owner":              str(""),
+		"parent":             uuidSchema("Array task of this child"),
+		"array_index":        integer("Index of this child"),
+		"run_counter":        integer(""),
+		"runs":               nullable(openapi.ArrayOf(openapi.Ref("RunData"))),
+		"history":            nullable(openapi.ArrayOf(openapi.Ref("Transition"))),
+		"max_wait_time":      integer("Max wait time before starting the action, in nanoseconds"),
+		"max_execution_time": integer("Max execution time, in nanoseconds"),
+		"run":                openapi.Ref("RunData"),
+	}
+	for name, s := range taskInput {
+		if _, ok := task[name]; !ok && name != "action" {
+			task[name] = s
+		}
+	}
+
+	created := map[string]*openapi.Schema{
+		"action": taskInput["action"],
+		"run":    openapi.MapOf(any("")),
+	}
+	for name, s := range task {
+		if _, ok := created[name]; !ok {
+			created[name] = s
+		}
+	}
+	created["max_wait_time"] = openapi.Ref("Duration")
+	created["max_execution_time"] = openapi.Ref("Duration")
+	// a whole task can be sent, its read only fields are ignored
+	for name, s := range created {
+		if _, ok := taskInput[name]; !ok {
+			taskInput[name] = s
+		}
+	}
+
+	taskRequired := []string{"start", "max_wait_time", "max_execution_time", "cpu", "ram", "id", "status",
+		"mtime", "revision", "owner", "retry", "every", "cron", "catch_up", "priority", "preemptible", "paused",
+		"parent", "array_index", "run", "run_counter", "runs", "history", "labels"}
+
+	notify := map[string]*openapi.Schema{
+		"url":    str("Called with a POST of the event"),
+		"events": nullable(openapi.ArrayOf(str("Lower case status names, every transition if empty"))),
+		"secret": str("HMAC SHA256 key of the X-Density-Signature header, written, never read"),
+	}
+	webhook := map[string]*openapi.Schema{
+		"id":    uuidSchema(""),
+		"owner": str("Every task, for an admin webhook without owner"),
+	}
+	for name, s := range notify {
+		webhook[name] = s
+	}
+
+	apiKey := map[string]*openapi.Schema{
+		"id":        uuidSchema(""),
+		"name":      str(""),
+		"owner":     str("Owner of the tasks of the service account"),
+		"scopes":    nullable(openapi.ArrayOf(str("The scopes of the user role if empty"))),
+		"groups":    nullable(openapi.ArrayOf(str(""))),
+		"path":      str("Glob of the readable volume files"),
+		"created":   dateTime(""),
+		"expires":   nullable(dateTime("Never expires if null")),
+		"last_used": nullable(dateTime("With a precision of a minute")),
+	}
+	createdKey := map[string]*openapi.Schema{
+		"key": str("The key, only given at its creation"),
+	}
+	for name, s := range apiKey {
+		createdKey[name] = s
+	}
+
+	return map[string]*openapi.Schema{
+		"Status": {Type: "string", Enum: statuses()},
+		"Duration": {
+			Description: "A duration, in nanoseconds, or a string like 90s",
+			OneOf:       []*openapi.Schema{integer(""), str("")},
+		},
+		"Task":        openapi.Object(task, taskRequired...),
+		"TaskInput":   openapi.Object(taskInput, "action"),
+		"CreatedTask": openapi.Object(created, append(taskRequired, "action")...),
+		"TaskFields":  {Type: "object", Description: "Some fields of a task, chosen with the fields parameter"},
+		"RunData": openapi.Object(map[string]*openapi.Schema{
+			"start":     dateTime(""),
+			"finish":    dateTime(""),
+			"id":        integer(""),
+			"exit_code": integer(""),
+			"runner":    str(""),
+			"running":   boolean(""),
+			"preempted": boolean("Stopped to make room for a task with a higher priority"),
+		}, "start", "finish", "id", "exit_code", "runner", "running"),
+		"Transition": openapi.Object(map[string]*openapi.Schema{
+			"from":   openapi.Ref("Status"),
+			"to":     openapi.Ref("Status"),
+			"time":   dateTime(""),
+			"reason": str(""),
+		}, "from", "to", "time"),
+		"Array": openapi.Object(map[string]*openapi.Schema{
+			"start":       integer("First index"),
+			"end":         integer("Last index, included"),
+			"parameters":  openapi.ArrayOf(openapi.MapOf(str(""))),
+			"parallelism": integer("Maximum children running at once, 0 is unlimited"),
+		}),
+		"Notify": openapi.Object(notify, "url"),
+		"Event": openapi.Object(map[string]*openapi.Schema{
+			"seq":       integer("Sequence number, the SSE id"),
+			"action":    str(""),
+			"id":        uuidSchema("Task id"),
+			"from":      str("Previous status"),
+			"to":        str("New status"),
+			"owner":     str(""),
+			"labels":    labels(),
+			"run_id":    integer(""),
+			"exit_code": nullable(integer("Only for a finished run")),
+			"time":      dateTime(""),
+			"reason":    str(""),
+		}, "seq", "action", "id", "time"),
+		"Bulk": openapi.Object(map[string]*openapi.Schema{
+			"selector": str("Label selector"),
+			"owner":    str("Only for admins"),
+			"status":   nullable(openapi.ArrayOf(str(""))),
+			"dry_run":  boolean("Only list the affected tasks"),
+		}),
+		"BulkReport": openapi.Object(map[string]*openapi.Schema{
+			"dry_run": boolean(""),
+			"results": openapi.ArrayOf(openapi.Object(map[string]*openapi.Schema{
+				"id":     uuidSchema(""),
+				"owner":  str(""),
+				"status": openapi.Ref("Status"),
+				"error":  str(""),
+			}, "id", "owner", "status")),
+			"succeeded": integer(""),
+			"failed":    integer(""),
+		}, "dry_run", "results", "succeeded", "failed"),
+		"Blackout": openapi.Object(map[string]*openapi.Schema{
+			"id":       uuidSchema(""),
+			"name":     str(""),
+			"start":    dateTime(""),
+			"end":      dateTime(""),
+			"cron":     str("Recurring window, opened at each occurrence"),
+			"duration": openapi.Ref("Duration"),
+			"owner":    str("Only tasks of this owner, everybody if empty"),
+			"labels":   labels(),
+			"selector": str("Only tasks matching this label selector"),
+		}),
+		"Template": openapi.Object(map[string]*openapi.Schema{
+			"name":       str(""),
+			"owner":      str("Me if empty, or one of my groups"),
+			"compose":    str("Compose document, a Go template"),
+			"x-batch":    openapi.MapOf(any("")),
+			"parameters": nullable(openapi.ArrayOf(openapi.Ref("TemplateParameter"))),
+			"mtime":      dateTime(""),
+		}, "name", "compose"),
+		"TemplateParameter": openapi.Object(map[string]*openapi.Schema{
+			"name":        str(""),
+			"type":        {Type: "string", Enum: []interface{}{"string", "int", "bool", "duration"}},
+			"default":     any("The parameter is required without default"),
+			"pattern":     str("Regexp for a string"),
+			"enum":        openapi.ArrayOf(str("")),
+			"description": str(""),
+		}, "name", "type"),
+		"TemplateTask": openapi.Object(map[string]*openapi.Schema{
+			"parameters": nullable(openapi.MapOf(any(""))),
+			"labels":     labels(),
+		}),
+		"Webhook":       openapi.Object(webhook, "url"),
+		"APIKey":        openapi.Object(apiKey, "owner"),
+		"CreatedAPIKey": openapi.Object(createdKey, "id", "owner", "created", "key"),
+		"Revocation": openapi.Object(map[string]*openapi.Schema{
+			"id":            uuidSchema(""),
+			"jti":           str("A revoked token"),
+			"owner":         str("Every token of this owner issued before issued_before"),
+			"issued_before": nullable(dateTime("Now by default, tokens issued in the same second are revoked")),
+			"reason":        str(""),
+			"created":       dateTime(""),
+			"expires":       dateTime("The entry is removed, 30 days by default"),
+		}),
+		"Delivery": openapi.Object(map[string]*openapi.Schema{
+			"id":           uuidSchema(""),
+			"owner":        str(""),
+			"webhook":      uuidSchema("Nil for a webhook of a task"),
+			"url":          str(""),
+			"secret":       str(""),
+			"event":        openapi.Ref("Event"),
+			"state":        {Type: "string", Enum: []interface{}{"pending", "delivered", "failed"}},
+			"attempts":     integer(""),
+			"next_attempt": dateTime(""),
+			"status_code":  integer("Of the latest attempt"),
+			"last_error":   str(""),
+			"created":      dateTime(""),
+			"mtime":        dateTime(""),
+		}, "id", "owner", "webhook", "url", "event", "state", "attempts", "next_attempt", "created", "mtime"),
+		"AuditEntry": openapi.Object(map[string]*openapi.Schema{
+			"id":         uuidSchema(""),
+			"time":       dateTime(""),
+			"owner":      str("Empty if the request has no identity"),
+			"admin":      boolean(""),
+			"action":     str("Method and route, like POST /api/tasks"),
+			"path":       str(""),
+			"task":       str("Id of the task"),
+			"tasks":      openapi.ArrayOf(str("Ids of the tasks affected by a bulk operation")),
+			"source_ip":  str(""),
+			"request_id": str(""),
+			"outcome":    {Type: "string", Enum: []interface{}{"success", "failure"}},
+			"status":     integer("HTTP status"),
+			"error":      str("Code of the error"),
+		}, "id", "time", "owner", "admin", "action", "path", "source_ip", "request_id", "outcome", "status"),
+		"Error": openapi.Object(map[string]*openapi.Schema{
+			"error": openapi.Object(map[string]*openapi.Schema{
+				"code":    str("Machine readable"),
+				"message": str(""),
+				"details": openapi.ArrayOf(openapi.Object(map[string]*openapi.Schema{
+					"field":   str("JSON path of the field"),
+					"message": str(""),
+				}, "field", "message")),
+				"request_id": str("Also in the X-Request-Id header"),
+			}, "code", "message", "request_id"),
+		}, "error"),
+	}
+}
+
+func newSpec() *openapi.Document {
+	uuidParam := pathParam("uuid", "Task id")
+	ownerParam := pathParam("owner", "Owner, `[a-zA-Z-0-9_\\-]+`, can't look like an UUID")
+	tasks := openapi.ArrayOf(&openapi.Schema{
+		AnyOf: []*openapi.Schema{openapi.Ref("Task"), openapi.Ref("TaskFields")},
+	})
+	taskQuery := []*openapi.Parameter{
+		queryParam("limit", "Size of a page", integer("")),
+		queryParam("cursor", "From the X-Next-Cursor header", str("")),
+		queryParam("sort", "start, mtime or status, - prefix for descending order", str("")),
+		queryParam("status", "Comma separated", str("")),
+		queryParam("selector", "Label selector: env in (prod,staging),team!=ops,!temporary", str("")),
+		queryParam("start_after", "", dateTime("")),
+		queryParam("start_before", "", dateTime("")),
+		queryParam("fields", "Comma separated JSON fields", str("")),
+	}
+	pagination := map[string]*openapi.Header{
+		"X-Next-Cursor": {Description: "Cursor of the next page", Schema: str("")},
+		"Link":          {Description: `rel="next" link`, Schema: str("")},
+	}
+	listTasks := jsonResponse("Tasks, other parameters are labels, prefixed with `label.` for a reserved name", tasks)
+	listTasks.Headers = pagination
+	createTask := func(id string, parameters ...*openapi.Parameter) *openapi.Operation {
+		return &openapi.Operation{
+			Summary:     "Creates a task, from JSON, or a multipart form with a docker-compose file and labels",
+			OperationID: id,
+			Tags:        []string{"tasks"},
+			Parameters:  parameters,
+			RequestBody: &openapi.RequestBody{Required: true, Content: map[string]*openapi.MediaType{
+				"application/json": {Schema: openapi.Ref("TaskInput")},
+				"multipart/form-data": {Schema: openapi.Object(map[string]*openapi.Schema{
+					"docker-compose": {Type: "string", Format: "binary"},
+					"labels":         str("JSON object"),
+				}, "docker-compose")},
+			}},
+			Responses: responses("201", jsonResponse("Created", openapi.Ref("CreatedTask"))),
+		}
+	}
+	logsQuery := []*openapi.Parameter{
+		queryParam("service", "Comma separated", str("")),
+		queryParam("tail", "Latest lines", integer("")),
+		queryParam("timestamps", "1 shows the time", str("")),
+	}
+	logs := content("service | text lines", "text/plain", str(""))
+	withEtag := jsonResponse("Task", openapi.Ref("Task"))
+	withEtag.Headers = map[string]*openapi.Header{"ETag": {Schema: str("")}}
+	deleteTask := func(id string, parameters ...*openapi.Parameter) *openapi.Operation {
+		return &openapi.Operation{
+			Summary:     "Deletes a task, or cancels it and waits, with wait_for",
+			OperationID: id,
+			Tags:        []string{"tasks"},
+			Parameters: append(parameters,
+				queryParam("wait_for", "Cancel the task, and answer when it's done", str(""))),
+			Responses: map[string]*openapi.Response{
+				"202":     {Description: "Deletion is started"},
+				"204":     {Description: "Canceled"},
+				"default": {Description: "Error", Content: openapi.JSON(openapi.Ref("Error"))},
+			},
+		}
+	}
+	noContent := map[string]*openapi.Response{
+		"204":     {Description: "Deleted"},
+		"default": {Description: "Error", Content: openapi.JSON(openapi.Ref("Error"))},
+	}
+	templateParam := pathParam("template", "Template name")
+	templateOwner := queryParam("owner", "Owner of the template, else the first one of mine", str(""))
+	keyParam := pathParam("key", "API key id")
+	revocationParam := pathParam("revocation", "Revocation id")
+
+	return &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       "Density",
+			Description: "Batch scheduler, with docker-compose tasks",
+			Version:     version.Version(),
+		},
+		Servers: []openapi.Server{{URL: "/api"}},
+		Paths: map[string]*openapi.PathItem{
+			"/openapi.json": {Get: &openapi.Operation{
+				Summary:     "This document",
+				OperationID: "getOpenAPI",
+				Responses:   map[string]*openapi.Response{"200": jsonResponse("OpenAPI document", &openapi.Schema{Type: "object"})},
+				Security:    []map[string][]string{{}},
+			}},
+			"/tasks": {
+				Get: &openapi.Operation{
+					Summary:     "My tasks, all tasks for an admin",
+					OperationID: "listTasks",
+					Tags:        []string{"tasks"},
+					Parameters:  taskQuery,
+					Responses:   responses("200", listTasks),
+				},
+				Post: createTask("createTask"),
+			},
+			"/tasks/{owner}": {
+				Get: &openapi.Operation{
+					Summary:     "Tasks of an owner, admin only",
+					OperationID: "listOwnerTasks",
+					Tags:        []string{"tasks"},
+					Parameters:  append([]*openapi.Parameter{ownerParam}, taskQuery...),
+					Responses:   responses("200", listTasks),
+				},
+				Post: createTask("createOwnerTask", ownerParam),
+				Delete: func() *openapi.Operation {
+					o := deleteTask("deleteTaskLegacy", pathParam("owner", "The task id, not an owner"))
+					o.Deprecated = true
+					o.Summary += ", use DELETE /task/{uuid}"
+					return o
+				}(),
+			},
+			"/tasks:{operation}": {Post: &openapi.Operation{
+				Summary:     "Bulk operation on tasks matching a selector, owner and status filter",
+				OperationID: "bulkTasks",
+				Tags:        []string{"tasks"},
+				Parameters: []*openapi.Parameter{{
+					Name: "operation", In: "path", Required: true,
+					Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"cancel", "delete", "pause", "resume", "retry"}},
+				}},
+				RequestBody: jsonBody(openapi.Ref("Bulk")),
+				Responses:   responses("200", jsonResponse("Result of each task", openapi.Ref("BulkReport"))),
+			}},
+			"/tasks/{job}/volume/{path}": {Get: &openapi.Operation{
+				Summary:     "A file of a task volume, allowed by the path claim of the token",
+				OperationID: "getVolume",
+				Tags:        []string{"tasks"},
+				Parameters:  []*openapi.Parameter{pathParam("job", "Task id"), pathParam("path", "Path in the volumes")},
+				Responses:   responses("200", content("File", "application/octet-stream", &openapi.Schema{Type: "string", Format: "binary"})),
+			}},
+			"/task/{uuid}": {
+				Get: &openapi.Operation{
+					Summary:     "A task, with its ETag",
+					OperationID: "getTask",
+					Tags:        []string{"tasks"},
+					Parameters:  []*openapi.Parameter{uuidParam},
+					Responses:   responses("200", withEtag),
+				},
+				Put: &openapi.Operation{
+					Summary:     "Updates a waiting task",
+					OperationID: "updateTask",
+					Tags:        []string{"tasks"},
+					Parameters: []*openapi.Parameter{uuidParam, {
+						Name: "If-Match", In: "header", Required: true, Description: "ETag of the task", Schema: str(""),
+					}},
+					RequestBody: jsonBody(openapi.Ref("TaskInput")),
+					Responses:   responses("200", withEtag),
+				},
+				Delete: deleteTask("deleteTask", uuidParam),
+			},
+			"/task/{uuid}/logs": {Get: &openapi.Operation{
+				Summary:     "Logs of the latest run, follow=1 streams the running task, chunked or with a websocket of JSON lines",
+				OperationID: "getTaskLogs",
+				Tags:        []string{"logs"},
+				Parameters:  append([]*openapi.Parameter{uuidParam, queryParam("follow", "", str(""))}, logsQuery...),
+				Responses:   responses("200", logs),
+			}},
+			"/task/{uuid}/runs/{run}/logs": {Get: &openapi.Operation{
+				Summary:     "Logs of a run",
+				OperationID: "getRunLogs",
+				Tags:        []string{"logs"},
+				Parameters:  append([]*openapi.Parameter{uuidParam, pathParam("run", "Run id")}, logsQuery...),
+				Responses:   responses("200", logs),
+			}},
+			"/events": {Get: &openapi.Operation{
+				Summary:     "Server-Sent Events of my tasks, or a websocket of JSON events",
+				OperationID: "getEvents",
+				Tags:        []string{"events"},
+				Parameters: []*openapi.Parameter{
+					queryParam("status", "Comma separated new statuses, case insensitive", str("")),
+					queryParam("selector", "Label selector", str("")),
+					queryParam("last_event_id", "Resume after this event, like the Last-Event-ID header", integer("")),
+				},
+				Responses: responses("200", content("Event stream, the data is an Event", "text/event-stream", str(""))),
+			}},
+			"/blackouts": {
+				Get: &openapi.Operation{
+					Summary:     "Periods when no new task may start, global ones and those of my groups",
+					OperationID: "listBlackouts",
+					Tags:        []string{"blackouts"},
+					Responses:   responses("200", jsonResponse("Blackouts", nullable(openapi.ArrayOf(openapi.Ref("Blackout"))))),
+				},
+				Post: &openapi.Operation{
+					Summary:     "Adds a blackout, admin only",
+					OperationID: "createBlackout",
+					Tags:        []string{"blackouts"},
+					RequestBody: jsonBody(openapi.Ref("Blackout")),
+					Responses:   responses("201", jsonResponse("Created", openapi.Ref("Blackout"))),
+				},
+			},
+			"/blackouts/{blackout}": {Delete: &openapi.Operation{
+				Summary:     "Deletes a blackout, admin only",
+				OperationID: "deleteBlackout",
+				Tags:        []string{"blackouts"},
+				Parameters:  []*openapi.Parameter{pathParam("blackout", "Blackout id")},
+				Responses:   noContent,
+			}},
+			"/templates": {
+				Get: &openapi.Operation{
+					Summary:     "Compose templates of my owners, with typed parameters",
+					OperationID: "listTemplates",
+					Tags:        []string{"templates"},
+					Responses:   responses("200", jsonResponse("Templates", nullable(openapi.ArrayOf(openapi.Ref("Template"))))),
+				},
+				Post: &openapi.Operation{
+					Summary:     "Adds a template, for me or one of my groups",
+					OperationID: "createTemplate",
+					Tags:        []string{"templates"},
+					RequestBody: jsonBody(openapi.Ref("Template")),
+					Responses:   responses("201", jsonResponse("Created", openapi.Ref("Template"))),
+				},
+			},
+			"/templates/{template}": {
+				Get: &openapi.Operation{
+					Summary:     "A template",
+					OperationID: "getTemplate",
+					Tags:        []string{"templates"},
+					Parameters:  []*openapi.Parameter{templateParam, templateOwner},
+					Responses:   responses("200", jsonResponse("Template", openapi.Ref("Template"))),
+				},
+				Put: &openapi.Operation{
+					Summary:     "Updates a template, only by its owner or an admin",
+					OperationID: "updateTemplate",
+					Tags:        []string{"templates"},
+					Parameters:  []*openapi.Parameter{templateParam, templateOwner},
+					RequestBody: jsonBody(openapi.Ref("Template")),
+					Responses:   responses("200", jsonResponse("Template", openapi.Ref("Template"))),
+				},
+				Delete: &openapi.Operation{
+					Summary:     "Deletes a template, only by its owner or an admin",
+					OperationID: "deleteTemplate",
+					Tags:        []string{"templates"},
+					Parameters:  []*openapi.Parameter{templateParam, templateOwner},
+					Responses:   noContent,
+				},
+			},
+			"/templates/{template}/tasks": {Post: &openapi.Operation{
+				Summary:     "Creates a task from a template",
+				OperationID: "createTemplateTask",
+				Tags:        []string{"templates"},
+				Parameters:  []*openapi.Parameter{templateParam, templateOwner},
+				RequestBody: jsonBody(openapi.Ref("TemplateTask")),
+				Responses:   responses("201", jsonResponse("Created", openapi.Ref("CreatedTask"))),
+			}},
+			"/webhooks": {
+				Get: &openapi.Operation{
+					Summary:     "My webhooks, all of them for an admin, secrets are hidden",
+					OperationID: "listWebhooks",
+					Tags:        []string{"webhooks"},
+					Responses:   responses("200", jsonResponse("Webhooks", nullable(openapi.ArrayOf(openapi.Ref("Webhook"))))),
+				},
+				Post: &openapi.Operation{
+					Summary:     "Adds a webhook, without secret a random one is given, only in this response",
+					OperationID: "createWebhook",
+					Tags:        []string{"webhooks"},
+					RequestBody: jsonBody(openapi.Ref("Webhook")),
+					Responses:   responses("201", jsonResponse("Created", openapi.Ref("Webhook"))),
+				},
+			},
+			"/webhooks/deliveries": {Get: &openapi.Operation{
+				Summary:     "Deliveries of my webhooks",
+				OperationID: "listDeliveries",
+				Tags:        []string{"webhooks"},
+				Parameters:  []*openapi.Parameter{queryParam("state", "pending, delivered or failed", str(""))},
+				Responses:   responses("200", jsonResponse("Deliveries", nullable(openapi.ArrayOf(openapi.Ref("Delivery"))))),
+			}},
+			"/webhooks/{webhook}": {Delete: &openapi.Operation{
+				Summary:     "Deletes a webhook",
+				OperationID: "deleteWebhook",
+				Tags:        []string{"webhooks"},
+				Parameters:  []*openapi.Parameter{pathParam("webhook", "Webhook id")},
+				Responses:   noContent,
+			}},
+			"/keys": {
+				Get: &openapi.Operation{
+					Summary:     "API keys of the service accounts, with the admin:keys scope",
+					OperationID: "listAPIKeys",
+					Tags:        []string{"keys"},
+					Responses:   responses("200", jsonResponse("API keys", nullable(openapi.ArrayOf(openapi.Ref("APIKey"))))),
+				},
+				Post: &openapi.Operation{
+					Summary:     "Creates an API key, the key is only in this response",
+					OperationID: "createAPIKey",
+					Tags:        []string{"keys"},
+					RequestBody: jsonBody(openapi.Ref("APIKey")),
+					Responses:   responses("201", jsonResponse("Created", openapi.Ref("CreatedAPIKey"))),
+				},
+			},
+			"/audit": {Get: &openapi.Operation{
+				Summary:     "Mutating requests, latest first, with the admin:audit scope",
+				OperationID: "listAudit",
+				Tags:        []string{"audit"},
+				Parameters: []*openapi.Parameter{
+					queryParam("since", "", dateTime("")),
+					queryParam("until", "", dateTime("")),
+					queryParam("owner", "", str("")),
+					queryParam("limit", "Size of a page, 100 by default, 1000 at most", integer("")),
+					queryParam("cursor", "From the X-Next-Cursor header", str("")),
+				},
+				Responses: responses("200", jsonResponse("Audit entries", nullable(openapi.ArrayOf(openapi.Ref("AuditEntry"))))),
+			}},
+			"/revocations": {
+				Get: &openapi.Operation{
+					Summary:     "Revoked tokens, with the admin:tokens scope",
+					OperationID: "listRevocations",
+					Tags:        []string{"revocations"},
+					Responses:   responses("200", jsonResponse("Revocations", nullable(openapi.ArrayOf(openapi.Ref("Revocation"))))),
+				},
+				Post: &openapi.Operation{
+					Summary:     "Revokes a token, by its jti, or the tokens of an owner",
+					OperationID: "createRevocation",
+					Tags:        []string{"revocations"},
+					RequestBody: jsonBody(openapi.Ref("Revocation")),
+					Responses:   responses("201", jsonResponse("Created", openapi.Ref("Revocation"))),
+				},
+			},
+			"/revocations/{revocation}": {Delete: &openapi.Operation{
+				Summary:     "Removes a revocation, its tokens are accepted again",
+				OperationID: "deleteRevocation",
+				Tags:        []string{"revocations"},
+				Parameters:  []*openapi.Parameter{revocationParam},
+				Responses:   noContent,
+			}},
+			"/keys/{key}": {
+				Get: &openapi.Operation{
+					Summary:     "An API key, with its last use",
+					OperationID: "getAPIKey",
+					Tags:        []string{"keys"},
+					Parameters:  []*openapi.Parameter{keyParam},
+					Responses:   responses("200", jsonResponse("API key", openapi.Ref("APIKey"))),
+				},
+				Delete: &openapi.Operation{
+					Summary:     "Revokes an API key",
+					OperationID: "deleteAPIKey",
+					Tags:        []string{"keys"},
+					Parameters:  []*openapi.Parameter{keyParam},
+					Responses:   noContent,
+				},
+			},
+		},
+		Components: openapi.Components{
+			Schemas: schemas(),
+			SecuritySchemes: map[string]*openapi.SecurityScheme{
+				"jwt":    {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				"apiKey": {Type: "apiKey", In: "header", Name: middlewares.APIKeyHeader},
+			},
+		},
+		Security: []map[string][]string{{"jwt": {}}, {"apiKey": {}}},
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/middlewares"
+	"github.com/factorysh/density/openapi"
+	"github.com/factorysh/density/scheduler"
+	"github.com/factorysh/density/store"
+	"github.com/factorysh/density/task"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var variable = regexp.MustCompile(`{[^}]+}`)
+
+func TestOpenAPIRoutes(t *testing.T) {
+	router := mux.NewRouter()
+	s, err := scheduler.New(scheduler.NewResources(4, 16*1024), nil, store.NewMemoryStore())
+	assert.NoError(t, err)
+	err = RegisterAPI(router.PathPrefix("/api").Subrouter(), s, &task.Validator{}, middlewares.NewVerifier("plop"))
+	assert.NoError(t, err)
+	doc := Spec()
+
+	documented := make(map[string]bool)
+	for template, item := range doc.Paths {
+		for method := range item.Operations() {
+			documented[method+" "+variable.ReplaceAllString(template, "{}")] = true
+		}
+	}
+	routes := 0
+	err = router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil // the /api prefix
+		}
+		template = variable.ReplaceAllString(strings.TrimPrefix(template, "/api"), "{}")
+		if strings.HasSuffix(template, "/") { // a path prefix
+			template += "{}"
+		}
+		for _, method := range methods {
+			routes++
+			assert.True(t, documented[method+" "+template], "%s %s is not documented", method, template)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	// the OpenAPI document is served outside of the API router
+	assert.Equal(t, len(documented)-1, routes)
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	w := httptest.NewRecorder()
+	HandleGetOpenAPI(w, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var doc openapi.Document
+	err := json.Unmarshal(w.Body.Bytes(), &doc)
+	assert.NoError(t, err)
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+	assert.Contains(t, doc.Paths, "/task/{uuid}")
+
+	// every reference is a schema
+	refs := regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(w.Body.String(), -1)
+	assert.NotEmpty(t, refs)
+	for _, ref := range refs {
+		assert.Contains(t, doc.Components.Schemas, ref[1])
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	doc := Spec()
+	tsk := &task.Task{
+		Id:              [16]byte{1},
+		Owner:           "bob",
+		Start:           time.Now(),
+		MaxExectionTime: time.Minute,
+		Action:          &task.DummyAction{Name: "schema"},
+		CPU:             1,
+		RAM:             64,
+	}
+	raw, err := json.Marshal(tsk.ToTaskResp())
+	assert.NoError(t, err)
+	assert.NoError(t, doc.ValidateJSON(openapi.Ref("Task"), raw))
+	raw, err = json.Marshal(tsk)
+	assert.NoError(t, err)
+	assert.NoError(t, doc.ValidateJSON(openapi.Ref("CreatedTask"), raw))
+
+	raw, err = json.Marshal(errorEnvelope{Error: newError(http.StatusNotFound, scheduler.ErrUnknownTask)})
+	assert.NoError(t, err)
+	assert.NoError(t, doc.ValidateJSON(openapi.Ref("Error"), raw))
+
+	// drift is detected
+	err = doc.ValidateJSON(openapi.Ref("Task"), []byte(`{"id": "plop"}`))
+	assert.Error(t, err)
+	err = doc.ValidateResponse("GET", "/task/"+tsk.Id.String(), 200, "application/json", []byte(`{"error": {}}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/revocation"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// REVOCATION is used as key in map of http vars
+const REVOCATION = "revocation"
+
+// HandleGetRevocations lists the revoked tokens, latest first
+func (a *API) HandleGetRevocations(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	revocations, err := a.revocations.List()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	return revocations, nil
+}
+
+// HandlePostRevocations revokes a token by its jti, or the tokens of an owner issued before a time
+func (a *API) HandlePostRevocations(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	var revoked revocation.Revocation
+	err := json.NewDecoder(r.Body).Decode(&revoked)
+	r.Body.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	if revoked.Id != uuid.Nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, errors.New("don't choose your UUID, it's my job")
+	}
+	err = a.revocations.Revoke(&revoked)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return revoked, nil
+}
+
+// HandleDeleteRevocation removes a revocation, its tokens are accepted again
+func (a *API) HandleDeleteRevocation(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)[REVOCATION])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	err = a.revocations.Delete(id)
+	if err != nil {
+		return nil, err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil, nil
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/revocation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevocations(t *testing.T) {
+	_, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	admin, err := newClientWithClaims(ts.URL, "plop", jwt.MapClaims{"owner": "root", "admin": true})
+	assert.NoError(t, err)
+	bob, err := newClientWithClaims(ts.URL, "plop", jwt.MapClaims{
+		"owner": "bob",
+		"jti":   "bob-1",
+		"iat":   time.Now().Add(-time.Minute).Unix(),
+	})
+	assert.NoError(t, err)
+	alice, err := newClientWithClaims(ts.URL, "plop", jwt.MapClaims{
+		"owner": "alice",
+		"iat":   time.Now().Add(-time.Minute).Unix(),
+	})
+	assert.NoError(t, err)
+
+	res, _ := bob.Do("GET", "/api/revocations", nil, nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	h := make(http.Header)
+	h.Set("content-type", "application/json")
+	res, _ = admin.Do("POST", "/api/revocations", h, bytes.NewReader([]byte(`{"jti": "bob-1", "owner": "bob"}`)), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	var byJTI, byOwner revocation.Revocation
+	res, err = admin.Do("POST", "/api/revocations", h, bytes.NewReader([]byte(`{"jti": "bob-1", "reason": "leaked"}`)), &byJTI)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	res, err = admin.Do("POST", "/api/revocations", h, bytes.NewReader([]byte(`{"owner": "alice"}`)), &byOwner)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.NotNil(t, byOwner.IssuedBefore)
+
+	for _, c := range []*testClient{bob, alice} {
+		res, _ = c.Do("GET", "/api/tasks", nil, nil, nil)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	var revocations []revocation.Revocation
+	res, err = admin.Do("GET", "/api/revocations", nil, nil, &revocations)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, revocations, 2)
+
+	res, _ = admin.Do("DELETE", "/api/revocations/"+byJTI.Id.String(), nil, nil, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res, _ = admin.Do("DELETE", "/api/revocations/"+byJTI.Id.String(), nil, nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	res, _ = bob.Do("GET", "/api/tasks", nil, nil, nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
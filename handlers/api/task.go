@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/factorysh/density/owner"
 	"github.com/factorysh/density/task"
@@ -12,24 +14,82 @@ import (
 )
 
 // HandleGetTask will retreive a task, convert it into a resp and return the data
-func (a *API) HandleGetTask(u *owner.Owner, _ http.ResponseWriter, r *http.Request) (interface{}, error) {
-	fmt.Println(u)
-
+func (a *API) HandleGetTask(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	vars := mux.Vars(r)
 	rawID, ok := vars[task.UUID]
 	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
 		return nil, errors.New("No uuid in request")
 	}
 
 	id, err := uuid.Parse(rawID)
 	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+
+	t, err := a.authorizedTask(u, id, owner.TasksRead)
+	if err != nil {
+		return nil, err
+	}
+
+	w.Header().Set("ETag", etag(t))
+	return t.ToTaskResp(), nil
+}
+
+// HandlePutTask updates a waiting task. The If-Match header is the ETag of the task, read with a GET.
+func (a *API) HandlePutTask(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)[task.UUID])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+
+	match := r.Header.Get("If-Match")
+	if match == "" {
+		w.WriteHeader(http.StatusPreconditionRequired)
+		return nil, errors.New("If-Match header is mandatory")
+	}
+	revision, err := parseETag(match)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
 		return nil, err
 	}
 
-	t, err := a.schd.GetTask(id)
+	_, err = a.authorizedTask(u, id, owner.TasksWrite)
 	if err != nil {
 		return nil, err
 	}
 
+	t, err := a.readTask(w, r)
+	if err != nil {
+		return nil, err
+	}
+	err = a.validateTask(t)
+	if err != nil {
+		return nil, err
+	}
+
+	// typed errors of the scheduler choose the status
+	err = a.schd.Update(id, revision, t)
+	if err != nil {
+		return nil, err
+	}
+
+	w.Header().Set("ETag", etag(t))
 	return t.ToTaskResp(), nil
 }
+
+// etag of a task is its revision
+func etag(t *task.Task) string {
+	return strconv.Quote(strconv.Itoa(t.Revision))
+}
+
+func parseETag(value string) (int, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+	raw, err := strconv.Unquote(value)
+	if err != nil {
+		return 0, fmt.Errorf("Bad ETag: %s", value)
+	}
+	return strconv.Atoi(raw)
+}
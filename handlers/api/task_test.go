@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/logs"
+	"github.com/factorysh/density/middlewares"
+	"github.com/factorysh/density/runner"
+	"github.com/factorysh/density/scheduler"
+	"github.com/factorysh/density/store"
+	"github.com/factorysh/density/task"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func newDummyAPI(t *testing.T) (*scheduler.Scheduler, *httptest.Server, func()) {
+	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
+	assert.NoError(t, err)
+	s, err := scheduler.New(scheduler.NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	router := mux.NewRouter()
+	v := &task.Validator{
+		Validators: map[string]map[string]interface{}{
+			"dummy": {},
+		},
+	}
+	err = v.Register()
+	assert.NoError(t, err)
+	err = RegisterAPI(router.PathPrefix("/api").Subrouter(), s, v, middlewares.NewVerifier("plop"))
+	assert.NoError(t, err)
+	ts := httptest.NewServer(router)
+	return s, ts, func() {
+		ts.Close()
+		cancel()
+		os.RemoveAll(dir)
+	}
+}
+
+// tasksOf lists the tasks of an owner, with these labels
+func tasksOf(t *testing.T, s *scheduler.Scheduler, owner string, labels map[string]string) []*task.Task {
+	tasks, _, err := s.Query(&scheduler.Query{Owner: owner, Labels: labels})
+	assert.NoError(t, err)
+	return tasks
+}
+
+func TestPutTask(t *testing.T) {
+	_, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+
+	c, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+
+	h := make(http.Header)
+	h.Set("content-type", "application/json")
+	var created task.Task
+	res, err := c.Do("POST", "/api/tasks", h, bytes.NewReader([]byte(`{
+		"start": "2042-01-01T00:00:00Z",
+		"cpu": 1,
+		"ram": 128,
+		"max_execution_time": "120s",
+		"action": {
+			"dummy": {
+				"name": "later"
+			}
+		}
+	}`)), &created)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, res.StatusCode)
+
+	var got task.Resp
+	res, err = c.Do("GET", "/api/task/"+created.Id.String(), nil, nil, &got)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	etag := res.Header.Get("ETag")
+	assert.NotEqual(t, "", etag)
+
+	update := []byte(`{
+		"start": "2042-01-02T00:00:00Z",
+		"cpu": 2,
+		"ram": 256,
+		"max_execution_time": "60s",
+		"labels": {"env": "prod"},
+		"action": {
+			"dummy": {
+				"name": "later"
+			}
+		}
+	}`)
+
+	var updated task.Resp
+	// If-Match is mandatory, errors have an empty body
+	h.Del("If-Match")
+	res, _ = c.Do("PUT", "/api/task/"+created.Id.String(), h, bytes.NewReader(update), &updated)
+	assert.Equal(t, http.StatusPreconditionRequired, res.StatusCode)
+
+	h.Set("If-Match", etag)
+	res, err = c.Do("PUT", "/api/task/"+created.Id.String(), h, bytes.NewReader(update), &updated)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, 2, updated.CPU)
+	assert.Equal(t, time.Minute, updated.MaxExectionTime)
+	assert.Equal(t, "bob", updated.Owner)
+	assert.Equal(t, "prod", updated.Labels["env"])
+	assert.NotEqual(t, etag, res.Header.Get("ETag"))
+
+	// the second update, with the same ETag, is rejected
+	res, _ = c.Do("PUT", "/api/task/"+created.Id.String(), h, bytes.NewReader(update), &updated)
+	assert.Equal(t, http.StatusPreconditionFailed, res.StatusCode)
+}
+
+func TestRunLogs(t *testing.T) {
+	s, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	dir, err := ioutil.TempDir(os.TempDir(), "logs-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s.Logs = logs.New(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := s.Pubsub.Subscribe(ctx)
+	id, err := s.Add(&task.Task{
+		Owner:           "bob",
+		Start:           time.Now(),
+		MaxExectionTime: time.Minute,
+		Action:          &task.DummyAction{Name: "Hello logs"},
+		CPU:             1,
+		RAM:             64,
+	})
+	assert.NoError(t, err)
+	for event := range done {
+		if event.Action == "Done" {
+			break
+		}
+	}
+
+	c, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+	r, err := http.NewRequest("GET", ts.URL+"/api/task/"+id.String()+"/runs/0/logs?tail=1", nil)
+	assert.NoError(t, err)
+	r.Header.Set("Authorization", c.authorization)
+	res, err := http.DefaultClient.Do(r)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "dummy | Hello logs\n", string(body))
+
+	assert.NoError(t, s.Delete(id))
+	_, err = os.Stat(path.Join(dir, id.String()))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFollowLogs(t *testing.T) {
+	s, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	running := s.Pubsub.Subscribe(ctx)
+	id, err := s.Add(&task.Task{
+		Owner:           "bob",
+		Start:           time.Now(),
+		MaxExectionTime: time.Minute,
+		Action:          &task.DummyAction{Name: "Hello follow", Wait: 500 * time.Millisecond},
+		CPU:             1,
+		RAM:             64,
+	})
+	assert.NoError(t, err)
+	for event := range running {
+		if event.Action == "Running" {
+			break
+		}
+	}
+
+	c, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+	r, err := http.NewRequest("GET", ts.URL+"/api/task/"+id.String()+"/logs?follow=1", nil)
+	assert.NoError(t, err)
+	r.Header.Set("Authorization", c.authorization)
+	res, err := http.DefaultClient.Do(r)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+	// the stream ends with the run
+	body, err := ioutil.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "dummy | Hello follow\n", string(body))
+}
+
+func TestGetTasksPages(t *testing.T) {
+	s, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	for i := 0; i < 3; i++ {
+		addLaterTask(t, s, "bob")
+	}
+	_, err := s.Add(&task.Task{
+		Owner:           "bob",
+		Start:           time.Now().Add(time.Hour),
+		MaxExectionTime: time.Minute,
+		Action:          &task.DummyAction{Name: "labeled"},
+		CPU:             1,
+		RAM:             64,
+		Labels:          map[string]string{"status": "ok"},
+	})
+	assert.NoError(t, err)
+	c, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+
+	var page []task.Resp
+	res, err := c.Do("GET", "/api/tasks?limit=3&sort=-mtime", nil, nil, &page)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Len(t, page, 3)
+	next := res.Header.Get("X-Next-Cursor")
+	assert.NotEqual(t, "", next)
+
+	res, err = c.Do("GET", "/api/tasks?limit=3&sort=-mtime&cursor="+next, nil, nil, &page)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, "", res.Header.Get("X-Next-Cursor"))
+
+	// a reserved parameter, and a label with the same name
+	res, err = c.Do("GET", "/api/tasks?status=waiting&label.status=ok", nil, nil, &page)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	assert.Equal(t, "ok", page[0].Labels["status"])
+
+	res, err = c.Do("GET", "/api/tasks?selector="+url.QueryEscape("status in (ok,ko),!temporary"), nil, nil, &page)
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+	res, err = c.Do("GET", "/api/tasks?selector="+url.QueryEscape("!status"), nil, nil, &page)
+	assert.NoError(t, err)
+	assert.Len(t, page, 3)
+	res, _ = c.Do("GET", "/api/tasks?selector="+url.QueryEscape("status in ok"), nil, nil, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	var fields []map[string]interface{}
+	res, err = c.Do("GET", "/api/tasks?fields=id,status", nil, nil, &fields)
+	assert.NoError(t, err)
+	assert.Len(t, fields, 4)
+	assert.Len(t, fields[0], 2)
+
+	res, _ = c.Do("GET", "/api/tasks?status=plop", nil, nil, nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func TestTaskSecrets(t *testing.T) {
+	_, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	c, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+
+	h := make(http.Header)
+	h.Set("content-type", "application/json")
+	var raw json.RawMessage
+	res, err := c.Do("POST", "/api/tasks", h, bytes.NewReader([]byte(`{
+		"start": "2042-01-01T00:00:00Z",
+		"cpu": 1,
+		"ram": 128,
+		"max_execution_time": "120s",
+		"action": {
+			"dummy": {
+				"name": "later"
+			}
+		},
+		"notify": [{"url": "https://example.com/hook", "secret": "s3cr3t"}]
+	}`)), &raw)
+	assert.NoError(t, err)
+	assert.Equal(t, 201, res.StatusCode)
+	assert.NotContains(t, string(raw), "s3cr3t")
+	var created task.Task
+	assert.NoError(t, json.Unmarshal(raw, &created))
+	assert.Len(t, created.Notify, 1)
+
+	res, err = c.Do("GET", "/api/task/"+created.Id.String(), nil, nil, &raw)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.NotContains(t, string(raw), "s3cr3t")
+	assert.Contains(t, string(raw), "https://example.com/hook")
+
+	res, err = c.Do("GET", "/api/tasks", nil, nil, &raw)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.NotContains(t, string(raw), "s3cr3t")
+}
@@ -2,18 +2,25 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	rawCompose "github.com/factorysh/density/compose"
 	"github.com/factorysh/density/input/compose"
 	"github.com/factorysh/density/owner"
 	_path "github.com/factorysh/density/path"
+	"github.com/factorysh/density/scheduler"
+	"github.com/factorysh/density/selector"
 	"github.com/factorysh/density/task"
+	_status "github.com/factorysh/density/task/status"
 	"github.com/getsentry/sentry-go"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -27,45 +34,131 @@ const JOB = "job"
 // MAXFORMMEM is used to setup max form memory limit
 const MAXFORMMEM = 1024
 
-// HandleGetTasks handles a get on /schedules endpoint
-func (a *API) HandleGetTasks(u *owner.Owner, w http.ResponseWriter,
-	r *http.Request) (interface{}, error) {
-	labels := make(map[string]string)
-	var ts []*task.Task
-	// toSend array contains task with translated to task.Resp, removing private task fields
-	toSend := []task.Resp{}
-	vars := mux.Vars(r)
-	o, filter := vars[owner.OWNER]
+// MAXLIMIT is the biggest page of tasks
+const MAXLIMIT = 1000
 
-	// unpriviledged user can't request with a filter option
-	if !u.Admin && filter {
-		w.WriteHeader(http.StatusUnauthorized)
-		return nil, nil
+// newQuery reads the pagination, sort, and filters of a task listing, the other parameters are labels.
+// A label with the name of a reserved parameter is filtered with a `label.` prefix.
+func newQuery(query url.Values) (*scheduler.Query, []string, error) {
+	q := &scheduler.Query{
+		Labels:   make(map[string]string),
+		Statuses: make(map[_status.Status]bool),
 	}
-
-	for key, values := range r.URL.Query() {
+	var fields []string
+	for key, values := range query {
 		if len(values) > 1 {
-			w.WriteHeader(http.StatusBadRequest)
-			return nil, fmt.Errorf("http parameter %s is used multiple times", key)
+			return nil, nil, fmt.Errorf("http parameter %s is used multiple times", key)
+		}
+		value := values[0]
+		var err error
+		switch key {
+		case "limit":
+			q.Limit, err = strconv.Atoi(value)
+			if err == nil && (q.Limit < 0 || q.Limit > MAXLIMIT) {
+				err = fmt.Errorf("limit must be between 0 and %d", MAXLIMIT)
+			}
+		case "cursor":
+			q.Cursor = value
+		case "sort":
+			q.Sort = value
+		case "selector":
+			q.Selector, err = selector.Parse(value)
+		case "status":
+			for _, name := range strings.Split(value, ",") {
+				var s _status.Status
+				s, err = _status.Parse(name)
+				if err != nil {
+					break
+				}
+				q.Statuses[s] = true
+			}
+		case "start_after":
+			q.StartAfter, err = time.Parse(time.RFC3339, value)
+		case "start_before":
+			q.StartBefore, err = time.Parse(time.RFC3339, value)
+		case "fields":
+			fields = strings.Split(value, ",")
+		case "token": // authentication, not a label
+		default:
+			q.Labels[strings.TrimPrefix(key, "label.")] = value
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return q, fields, nil
+}
+
+// selectFields keeps some JSON fields of a task
+func selectFields(t task.Resp, fields []string) (map[string]interface{}, error) {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]interface{}
+	err = json.Unmarshal(raw, &all)
+	if err != nil {
+		return nil, err
+	}
+	selected := make(map[string]interface{})
+	for _, field := range fields {
+		value, ok := all[field]
+		if !ok {
+			return nil, fmt.Errorf("Unknown field: %s", field)
 		}
+		selected[field] = value
+	}
+	return selected, nil
+}
+
+// HandleGetTasks handles a get on /tasks endpoint, my tasks and those of my groups,
+// every task with tasks:read:any, or the tasks of an owner, /tasks/{owner}.
+// With a `limit`, the cursor of the next page is in the `X-Next-Cursor` header, and a `Link` header.
+// `sort` is start, mtime or status, `-` prefix for descending order.
+// `status`, comma separated, `start_after`, `start_before` and a label `selector` filter,
+// `fields` selects JSON fields, other parameters are labels.
+func (a *API) HandleGetTasks(u *owner.Owner, w http.ResponseWriter,
+	r *http.Request) (interface{}, error) {
+	q, fields, err := newQuery(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	// my tasks and the tasks of my groups, without the :any scope
+	err = authorizeOwner(u, owner.TasksRead, mux.Vars(r)[owner.OWNER], q)
+	if err != nil {
+		return nil, err
+	}
 
-		labels[key] = values[0]
+	ts, next, err := a.schd.Query(q)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+		nextURL := *r.URL
+		query := nextURL.Query()
+		query.Set("cursor", next)
+		nextURL.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, nextURL.RequestURI()))
 	}
 
-	// if user is an admin
-	if u.Admin {
-		if filter || len(labels) > 1 {
-			// request with a filter
-			ts = a.schd.Filter(o, labels)
-		} else {
-			// request all
-			ts = a.schd.List()
+	if len(fields) > 0 {
+		selected := make([]map[string]interface{}, 0, len(ts))
+		for _, t := range ts {
+			s, err := selectFields(t.ToTaskResp(), fields)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return nil, err
+			}
+			selected = append(selected, s)
 		}
-	} else {
-		// used context information to get current user name
-		ts = a.schd.Filter(u.Name, labels)
+		return selected, nil
 	}
 
+	// toSend array contains task with translated to task.Resp, removing private task fields
+	toSend := make([]task.Resp, 0, len(ts))
 	for _, t := range ts {
 		toSend = append(toSend, t.ToTaskResp())
 	}
@@ -76,9 +169,15 @@ func (a *API) HandleGetTasks(u *owner.Owner, w http.ResponseWriter,
 // HandlePostTasks handles a post on /tasks endpoint
 func (a *API) HandlePostTasks(u *owner.Owner,
 	w http.ResponseWriter, r *http.Request) (interface{}, error) {
-	vars := mux.Vars(r)
-	o, explicit := vars[owner.OWNER]
+	t, err := a.readTask(w, r)
+	if err != nil {
+		return nil, err
+	}
+	return a.addTask(u, w, r, t)
+}
 
+// readTask reads a task, from JSON or from a multipart form with a compose file
+func (a *API) readTask(w http.ResponseWriter, r *http.Request) (*task.Task, error) {
 	t := new(task.Task)
 
 	switch r.Header.Get("Content-Type") {
@@ -119,22 +218,9 @@ func (a *API) HandlePostTasks(u *owner.Owner,
 			w.WriteHeader(http.StatusInternalServerError)
 			return nil, err
 		}
-		myCompose := rawCompose.NewCompose()
-		err = yaml.Unmarshal(content, myCompose)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return nil, err
-		}
 
-		err = myCompose.Validate()
+		t, err = a.taskFromCompose(content)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return nil, err
-		}
-
-		t, err = compose.TaskFromCompose(myCompose)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
 			return nil, err
 		}
 
@@ -143,45 +229,98 @@ func (a *API) HandlePostTasks(u *owner.Owner,
 		}
 	}
 
-	var errs []error
+	return t, nil
+}
+
+// taskFromCompose parses and validates a compose file
+func (a *API) taskFromCompose(content []byte) (*task.Task, error) {
+	myCompose := rawCompose.NewCompose()
+	err := yaml.Unmarshal(content, myCompose)
+	if err != nil {
+		return nil, &Error{Code: "invalid_compose", Message: err.Error()}
+	}
+
+	// a rejected compose file is a typed error, a missing docker-compose isn't
+	err = myCompose.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := compose.TaskFromCompose(myCompose)
+	if err != nil {
+		return nil, &Error{Code: "invalid_compose", Message: err.Error()}
+	}
+	return t, nil
+}
+
+// validateTask checks labels, webhooks and action of a task, the error lists the rejected fields
+func (a *API) validateTask(t *task.Task) error {
+	var details []FieldError
 	for key, value := range t.Labels {
 		if !task.IsLabelValid(key) {
-			errs = append(errs, fmt.Errorf("Key `%v` do not respect labels policy", key))
+			details = append(details, FieldError{
+				Field:   "labels",
+				Message: fmt.Sprintf("Key `%v` do not respect labels policy", key),
+			})
 		}
 		if !task.IsLabelValid(value) {
-			errs = append(errs, fmt.Errorf("Key `%v` do not respect labels policy", value))
+			details = append(details, FieldError{
+				Field:   "labels." + key,
+				Message: fmt.Sprintf("Value `%v` do not respect labels policy", value),
+			})
 		}
 	}
-	if errs != nil && len(errs) > 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		errz := make([]string, len(errs))
-		for i := 0; i < len(errs); i++ {
-			errz[i] = errs[i].Error()
+	for i, notify := range t.Notify {
+		err := notify.Validate()
+		if err != nil {
+			details = append(details, FieldError{
+				Field:   fmt.Sprintf("notify.%d", i),
+				Message: err.Error(),
+			})
+		}
+	}
+	if len(details) > 0 {
+		return &Error{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_task",
+			Message: "Labels or webhooks errors",
+			Details: details,
 		}
-		json.NewEncoder(w).Encode(errz)
-		return nil, fmt.Errorf("Labels errors %v", errs)
 	}
 
-	errs = a.validator.ValidateAction(t.Action)
-	if errs != nil && len(errs) > 0 {
-		fmt.Println("Validate errors", errs)
-		w.WriteHeader(400)
-		errz := make([]string, len(errs))
-		for i := 0; i < len(errs); i++ {
-			errz[i] = errs[i].Error()
+	for _, err := range a.validator.ValidateAction(t.Action) {
+		detail := FieldError{Field: "action", Message: err.Error()}
+		var invalid *rawCompose.ValidationError
+		if errors.As(err, &invalid) {
+			detail = FieldError{Field: composeField(invalid), Message: invalid.Message}
 		}
-		json.NewEncoder(w).Encode(errz)
-		return nil, fmt.Errorf("Validate errors %v", errs)
+		details = append(details, detail)
 	}
-	// unpriviledged user can't create explicit job
-	if !u.Admin && explicit {
-		w.WriteHeader(http.StatusUnauthorized)
-		return nil, nil
+	if len(details) > 0 {
+		return &Error{
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_action",
+			Message: "Action errors",
+			Details: details,
+		}
 	}
+	return nil
+}
 
-	// if user is admin and request for an explicit task creation
-	if u.Admin && explicit {
-		// use parameter as owner
+// addTask validates a new task, chooses its owner and adds it to the scheduler
+func (a *API) addTask(u *owner.Owner, w http.ResponseWriter, r *http.Request, t *task.Task) (interface{}, error) {
+	vars := mux.Vars(r)
+	o, explicit := vars[owner.OWNER]
+
+	err := a.validateTask(t)
+	if err != nil {
+		return nil, err
+	}
+	if explicit {
+		// for one of my groups, or anybody with the :any scope
+		if !u.Allowed(owner.TasksWrite, o) {
+			return nil, forbiddenOwner(owner.TasksWrite, o)
+		}
 		t.Owner = o
 	} else {
 		// else, just use the user passed in the context
@@ -194,41 +333,56 @@ func (a *API) HandlePostTasks(u *owner.Owner,
 	}
 
 	// add tasks to current tasks
-	_, err := a.schd.Add(t)
+	_, err = a.schd.Add(t)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		// an invalid task is a typed error
 		return nil, err
 	}
 
-	fmt.Println(a.schd.List())
-
+	// webhook secrets are only written, never read
+	created := *t
+	created.Notify = task.HideSecrets(t.Notify)
 	w.WriteHeader(http.StatusCreated)
-	return t, err
+	return &created, err
 }
 
-// HandleDeleteTasks handle a delete on schedules
+// HandleDeleteTasks handle a delete on schedules, /task/{uuid}, or the legacy /tasks/{job}
 func (a *API) HandleDeleteTasks(u *owner.Owner,
 	w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	params := r.URL.Query()
 	vars := mux.Vars(r)
-	j, _ := vars[JOB]
+	j, ok := vars[JOB]
+	if !ok {
+		j = vars[task.UUID]
+	}
 
 	uuid, err := uuid.Parse(j)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		return nil, err
 	}
 
 	if _, wait := params["wait_for"]; wait {
+		_, err = a.authorizedTask(u, uuid, owner.TasksCancel)
+		if err != nil {
+			return nil, err
+		}
 		err := a.schd.Cancel(uuid)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
 			return nil, err
 		}
 		w.WriteHeader(http.StatusNoContent)
 		return nil, nil
 	}
 
+	// deleting cancels a running task, and removes it
+	if !u.Can(owner.TasksWrite) {
+		return nil, missingScope(owner.TasksWrite)
+	}
+	_, err = a.authorizedTask(u, uuid, owner.TasksWrite)
+	if err != nil {
+		return nil, err
+	}
 	go a.schd.Delete(uuid)
 	w.WriteHeader(http.StatusAccepted)
 
@@ -246,6 +400,16 @@ func (a *API) HandleGetVolumes(u *owner.Owner, w http.ResponseWriter, r *http.Re
 
 	}
 
+	id, err := uuid.Parse(jobID)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	_, err = a.authorizedTask(u, id, owner.TasksRead)
+	if err != nil {
+		return nil, err
+	}
+
 	// fetch authorized path from token
 	p, err := _path.FromCtx(r.Context())
 	if err != nil {
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/template"
+	"github.com/gorilla/mux"
+)
+
+// TEMPLATE is used as key in map of http vars
+const TEMPLATE = "template"
+
+// TemplateTask is the body of a task creation from a template
+type TemplateTask struct {
+	Parameters map[string]interface{} `json:"parameters"`
+	Labels     map[string]string      `json:"labels"`
+}
+
+// HandleGetTemplates lists the templates of my owners, all of them with tasks:read:any
+func (a *API) HandleGetTemplates(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	templates, err := a.templates.List()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	mine := make([]*template.Template, 0, len(templates))
+	for _, tmpl := range templates {
+		if u.Allowed(owner.TasksRead, tmpl.Owner) {
+			mine = append(mine, tmpl)
+		}
+	}
+	return mine, nil
+}
+
+// HandleGetTemplate returns a template
+func (a *API) HandleGetTemplate(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	return a.getTemplate(u, w, r, owner.TasksRead)
+}
+
+// getTemplate returns the template of the owner parameter, with this scope on it,
+// or else the first one of my owners.
+func (a *API) getTemplate(u *owner.Owner, w http.ResponseWriter, r *http.Request, scope string) (*template.Template, error) {
+	name := mux.Vars(r)[TEMPLATE]
+	owners := u.Owners()
+	if o := r.URL.Query().Get(owner.OWNER); o != "" {
+		if !u.Allowed(scope, o) {
+			return nil, forbiddenOwner(scope, o)
+		}
+		owners = []string{o}
+	}
+	for _, o := range owners {
+		tmpl, err := a.templates.Get(o, name)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return nil, err
+		}
+		if tmpl != nil {
+			if !u.Allowed(scope, tmpl.Owner) {
+				return nil, forbiddenOwner(scope, tmpl.Owner)
+			}
+			return tmpl, nil
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+	return nil, fmt.Errorf("Unknown template %s", name)
+}
+
+func readTemplate(w http.ResponseWriter, r *http.Request) (*template.Template, error) {
+	var tmpl template.Template
+	err := json.NewDecoder(r.Body).Decode(&tmpl)
+	r.Body.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	err = tmpl.Validate()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
+// HandlePostTemplates creates a template, for me or for an owner with tasks:write on it
+func (a *API) HandlePostTemplates(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	tmpl, err := readTemplate(w, r)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.Owner == "" {
+		tmpl.Owner = u.Name
+	}
+	if !u.Allowed(owner.TasksWrite, tmpl.Owner) {
+		return nil, forbiddenOwner(owner.TasksWrite, tmpl.Owner)
+	}
+	old, err := a.templates.Get(tmpl.Owner, tmpl.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	if old != nil {
+		w.WriteHeader(http.StatusConflict)
+		return nil, fmt.Errorf("Template %s of %s already exists", tmpl.Name, tmpl.Owner)
+	}
+	err = a.templates.Put(tmpl)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return tmpl, nil
+}
+
+// HandlePutTemplate replaces a template, with tasks:write on its owner
+func (a *API) HandlePutTemplate(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	old, err := a.getTemplate(u, w, r, owner.TasksWrite)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := readTemplate(w, r)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.Name != old.Name {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, fmt.Errorf("A template can't be renamed : %s", tmpl.Name)
+	}
+	tmpl.Owner = old.Owner
+	err = a.templates.Put(tmpl)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// HandleDeleteTemplate removes a template, with tasks:write on its owner
+func (a *API) HandleDeleteTemplate(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	tmpl, err := a.getTemplate(u, w, r, owner.TasksWrite)
+	if err != nil {
+		return nil, err
+	}
+	err = a.templates.Delete(tmpl.Owner, tmpl.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil, nil
+}
+
+// HandlePostTemplateTasks creates a task from a template and its parameters
+func (a *API) HandlePostTemplateTasks(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	tmpl, err := a.getTemplate(u, w, r, owner.TasksRead)
+	if err != nil {
+		return nil, err
+	}
+	var body TemplateTask
+	err = json.NewDecoder(r.Body).Decode(&body)
+	r.Body.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	content, err := tmpl.Render(body.Parameters)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	t, err := a.taskFromCompose(content)
+	if err != nil {
+		return nil, err
+	}
+	if len(body.Labels) >= 1 {
+		t.Labels = body.Labels
+	}
+	return a.addTask(u, w, r, t)
+}
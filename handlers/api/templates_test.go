@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/template"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplates(t *testing.T) {
+	_, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	bob, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+	alice, err := newClientWithClaims(ts.URL, "plop", jwt.MapClaims{
+		"owner": "alice",
+		"nbf":   time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC).Unix(),
+	})
+	assert.NoError(t, err)
+
+	h := make(http.Header)
+	h.Set("content-type", "application/json")
+	body := `{"name": "hello", "compose": "version: '3'"}`
+	var tmpl template.Template
+	res, err := bob.Do("POST", "/api/templates", h, bytes.NewReader([]byte(body)), &tmpl)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "bob", tmpl.Owner)
+	res, _ = bob.Do("POST", "/api/templates", h, bytes.NewReader([]byte(body)), nil)
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+
+	// the same name, for an other owner
+	res, err = alice.Do("POST", "/api/templates", h, bytes.NewReader([]byte(body)), &tmpl)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "alice", tmpl.Owner)
+	res, _ = alice.Do("POST", "/api/templates", h, bytes.NewReader([]byte(
+		`{"name": "other", "owner": "bob", "compose": "version: '3'"}`)), nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	var templates []template.Template
+	res, err = bob.Do("GET", "/api/templates", nil, nil, &templates)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, templates, 1)
+	assert.Equal(t, "bob", templates[0].Owner)
+
+	res, _ = bob.Do("PUT", "/api/templates/hello?owner=alice", h, bytes.NewReader([]byte(body)), nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, _ = bob.Do("DELETE", "/api/templates/hello?owner=alice", nil, nil, nil)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	res, err = bob.Do("PUT", "/api/templates/hello", h, bytes.NewReader([]byte(
+		`{"name": "hello", "compose": "version: '3.7'"}`)), &tmpl)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "bob", tmpl.Owner)
+
+	res, err = alice.Do("GET", "/api/templates/hello", nil, nil, &tmpl)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "version: '3'", tmpl.Compose)
+
+	res, _ = bob.Do("DELETE", "/api/templates/hello", nil, nil, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	res, _ = bob.Do("GET", "/api/templates/hello", nil, nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
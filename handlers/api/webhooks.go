@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/webhook"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// WEBHOOK is used as key in map of http vars
+const WEBHOOK = "webhook"
+
+// HandleGetWebhooks lists my webhooks and those of my groups, all of them with tasks:read:any. Secrets are hidden.
+func (a *API) HandleGetWebhooks(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	hooks, err := a.webhooks.List()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	mine := make([]*webhook.Webhook, 0)
+	for _, hook := range hooks {
+		if u.Allowed(owner.TasksRead, hook.Owner) {
+			hook.Secret = ""
+			mine = append(mine, hook)
+		}
+	}
+	return mine, nil
+}
+
+// HandlePostWebhooks registers a webhook for my tasks, or one of my groups.
+// With tasks:read:any, any owner is chosen, or every owner.
+// Without a secret, a random one is given, only in this response.
+func (a *API) HandlePostWebhooks(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	var hook webhook.Webhook
+	err := json.NewDecoder(r.Body).Decode(&hook)
+	r.Body.Close()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	if hook.Id != uuid.Nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, errors.New("don't choose your UUID, it's my job")
+	}
+	if !u.Can(owner.TasksReadAny) && (hook.Owner == "" || !u.Owns(hook.Owner)) {
+		hook.Owner = u.Name
+	}
+	if hook.Secret == "" {
+		hook.Secret, err = webhook.NewSecret()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return nil, err
+		}
+	}
+	err = hook.Validate()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	err = a.webhooks.Put(&hook)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	w.WriteHeader(http.StatusCreated)
+	return hook, nil
+}
+
+// HandleDeleteWebhook removes a webhook, with tasks:write on its owner
+func (a *API) HandleDeleteWebhook(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	id, err := uuid.Parse(mux.Vars(r)[WEBHOOK])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, err
+	}
+	hook, err := a.webhooks.Get(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	if hook == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return nil, webhook.ErrUnknownWebhook
+	}
+	if !u.Allowed(owner.TasksWrite, hook.Owner) {
+		return nil, forbiddenOwner(owner.TasksWrite, hook.Owner)
+	}
+	err = a.webhooks.Delete(id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil, nil
+}
+
+// HandleGetDeliveries lists deliveries of my webhooks, latest first, all of them with tasks:read:any.
+// The `state` parameter filters: pending, delivered or failed.
+func (a *API) HandleGetDeliveries(u *owner.Owner, w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	state := r.URL.Query().Get("state")
+	deliveries, err := a.deliveries.List(func(d *webhook.Delivery) bool {
+		if !u.Allowed(owner.TasksRead, d.Owner) {
+			return false
+		}
+		return state == "" || d.State == state
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	for _, delivery := range deliveries {
+		delivery.Secret = ""
+	}
+	return deliveries, nil
+}
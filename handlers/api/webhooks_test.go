@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/factorysh/density/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhooks(t *testing.T) {
+	_, ts, cleanup := newDummyAPI(t)
+	defer cleanup()
+	c, err := newClient(ts.URL, "plop")
+	assert.NoError(t, err)
+
+	h := make(http.Header)
+	h.Set("content-type", "application/json")
+	var hook webhook.Webhook
+	res, err := c.Do("POST", "/api/webhooks", h, bytes.NewReader([]byte(`{
+		"owner": "alice",
+		"url": "https://example.com/hook",
+		"events": ["done", "error"]
+	}`)), &hook)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "bob", hook.Owner)
+	assert.NotEqual(t, "", hook.Secret)
+
+	res, _ = c.Do("POST", "/api/webhooks", h, bytes.NewReader([]byte(`{
+		"url": "https://example.com/hook",
+		"events": ["finished"]
+	}`)), nil)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	var hooks []webhook.Webhook
+	res, err = c.Do("GET", "/api/webhooks", nil, nil, &hooks)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Len(t, hooks, 1)
+	assert.Equal(t, "", hooks[0].Secret)
+
+	var deliveries []webhook.Delivery
+	res, err = c.Do("GET", "/api/webhooks/deliveries", nil, nil, &deliveries)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Len(t, deliveries, 0)
+
+	res, _ = c.Do("DELETE", "/api/webhooks/"+hook.Id.String(), nil, nil, nil)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+}
@@ -55,9 +55,132 @@ func TaskFromCompose(com *cmps.Compose) (*task.Task, error) {
 		t.Cron = cron
 	}
 
+	catchUp, ok := cfg["catch_up"]
+	if ok {
+		cc, ok := catchUp.(bool)
+		if !ok {
+			return nil, fmt.Errorf("Bad catch_up type: %v", catchUp)
+		}
+		t.CatchUp = cc
+	}
+
+	priority, ok := cfg["priority"]
+	if ok {
+		pp, ok := priority.(int)
+		if !ok {
+			return nil, fmt.Errorf("Bad priority type: %v", priority)
+		}
+		t.Priority = pp
+	}
+
+	preemptible, ok := cfg["preemptible"]
+	if ok {
+		pp, ok := preemptible.(bool)
+		if !ok {
+			return nil, fmt.Errorf("Bad preemptible type: %v", preemptible)
+		}
+		t.Preemptible = pp
+	}
+
+	array, ok := cfg["array"]
+	if ok {
+		aa, err := arrayFromCompose(array)
+		if err != nil {
+			return nil, err
+		}
+		t.Array = aa
+	}
+
+	notify, ok := cfg["notify"]
+	if ok {
+		nn, err := notifyFromCompose(notify)
+		if err != nil {
+			return nil, err
+		}
+		t.Notify = nn
+	}
+
 	if t.Every != 0 && t.Cron != "" {
 		return nil, fmt.Errorf("cron and every options are mutually exclusive")
 	}
 
 	return t, nil
 }
+
+func arrayFromCompose(raw interface{}) (*task.Array, error) {
+	cfg, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Bad array type: %v", raw)
+	}
+	array := &task.Array{}
+	for k, v := range cfg {
+		switch k {
+		case "start":
+			array.Start, ok = v.(int)
+		case "end":
+			array.End, ok = v.(int)
+		case "parallelism":
+			array.Parallelism, ok = v.(int)
+		case "parameters":
+			parameters, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("Bad array parameters type: %v", v)
+			}
+			array.Parameters = make([]map[string]string, len(parameters))
+			for i, p := range parameters {
+				pp, ok := p.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("Bad array parameters type: %v", p)
+				}
+				array.Parameters[i] = make(map[string]string)
+				for key, value := range pp {
+					array.Parameters[i][key] = fmt.Sprint(value)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("Unknown array option: %s", k)
+		}
+		if !ok {
+			return nil, fmt.Errorf("Bad array %s type: %v", k, v)
+		}
+	}
+	return array, array.Validate()
+}
+
+func notifyFromCompose(raw interface{}) ([]task.Notify, error) {
+	hooks, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Bad notify type: %v", raw)
+	}
+	notify := make([]task.Notify, len(hooks))
+	for i, hook := range hooks {
+		cfg, ok := hook.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Bad notify type: %v", hook)
+		}
+		for k, v := range cfg {
+			switch k {
+			case "url":
+				notify[i].URL, ok = v.(string)
+			case "secret":
+				notify[i].Secret, ok = v.(string)
+			case "events":
+				var events []interface{}
+				events, ok = v.([]interface{})
+				for _, event := range events {
+					notify[i].Events = append(notify[i].Events, fmt.Sprint(event))
+				}
+			default:
+				return nil, fmt.Errorf("Unknown notify option: %s", k)
+			}
+			if !ok {
+				return nil, fmt.Errorf("Bad notify %s type: %v", k, v)
+			}
+		}
+		err := notify[i].Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return notify, nil
+}
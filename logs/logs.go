@@ -0,0 +1,251 @@
+package logs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	_run "github.com/factorysh/density/task/run"
+	"github.com/google/uuid"
+)
+
+// ErrBadService is returned when reading logs of a service with a bad name
+var ErrBadService = errors.New("Bad service name")
+
+// Store keeps the logs of the runs, a file per service, in root/<task>/<run>/<service>.log
+// A file is rotated when it's bigger than MaxSize, MaxFiles files are kept.
+type Store struct {
+	root     string
+	MaxSize  int64
+	MaxFiles int
+}
+
+// New Store, in a folder
+func New(root string) *Store {
+	return &Store{
+		root:     root,
+		MaxSize:  10 * 1024 * 1024,
+		MaxFiles: 2,
+	}
+}
+
+func (s *Store) runPath(task uuid.UUID, run int) string {
+	return path.Join(s.root, task.String(), strconv.Itoa(run))
+}
+
+// Capture the logs of a run
+func (s *Store) Capture(task uuid.UUID, run int) (*Capture, error) {
+	p := s.runPath(task, run)
+	err := os.MkdirAll(p, 0750)
+	if err != nil {
+		return nil, err
+	}
+	return &Capture{
+		store: s,
+		path:  p,
+		files: make(map[string]*rotating),
+	}, nil
+}
+
+// Delete all the logs of a task
+func (s *Store) Delete(task uuid.UUID) error {
+	return os.RemoveAll(path.Join(s.root, task.String()))
+}
+
+// Read the logs of a run, sorted by time, the tail latest lines if tail > 0,
+// for some services, or all of them.
+func (s *Store) Read(task uuid.UUID, run int, services []string, tail int) ([]_run.Line, error) {
+	p := s.runPath(task, run)
+	if len(services) == 0 {
+		infos, err := ioutil.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if strings.HasSuffix(info.Name(), ".log") {
+				services = append(services, strings.TrimSuffix(info.Name(), ".log"))
+			}
+		}
+	}
+	lines := make([]_run.Line, 0)
+	for _, service := range services {
+		if strings.Contains(service, "/") || strings.HasPrefix(service, ".") {
+			return nil, fmt.Errorf("%w: %s", ErrBadService, service)
+		}
+		for i := s.MaxFiles - 1; i >= 0; i-- {
+			l, err := readFile(logFile(p, service, i), service)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, l...)
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time.Before(lines[j].Time)
+	})
+	if tail > 0 && len(lines) > tail {
+		lines = lines[len(lines)-tail:]
+	}
+	return lines, nil
+}
+
+// Format a line, like docker-compose logs
+func Format(w io.Writer, line _run.Line, timestamps bool) error {
+	var err error
+	if timestamps {
+		_, err = fmt.Fprintf(w, "%s | %s %s\n", line.Service, line.Time.Format(time.RFC3339Nano), line.Text)
+	} else {
+		_, err = fmt.Fprintf(w, "%s | %s\n", line.Service, line.Text)
+	}
+	return err
+}
+
+func logFile(p, service string, i int) string {
+	name := path.Join(p, service+".log")
+	if i > 0 {
+		name = fmt.Sprintf("%s.%d", name, i)
+	}
+	return name
+}
+
+// readFile reads lines stored as `time stream text`
+func readFile(name, service string) ([]_run.Line, error) {
+	lines := make([]_run.Line, 0)
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lines, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, parts[0])
+		if err != nil {
+			continue
+		}
+		lines = append(lines, _run.Line{
+			Time:    t,
+			Service: service,
+			Stream:  parts[1],
+			Text:    parts[2],
+		})
+	}
+	return lines, scanner.Err()
+}
+
+// Capture writes the logs of a run
+type Capture struct {
+	store *Store
+	path  string
+	lock  sync.Mutex
+	files map[string]*rotating
+}
+
+// Write a line, it can be used concurrently
+func (c *Capture) Write(line _run.Line) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	f, ok := c.files[line.Service]
+	if !ok {
+		f = &rotating{
+			service:  line.Service,
+			path:     c.path,
+			maxSize:  c.store.MaxSize,
+			maxFiles: c.store.MaxFiles,
+		}
+		c.files[line.Service] = f
+	}
+	_, err := f.Write([]byte(fmt.Sprintf("%s %s %s\n", line.Time.Format(time.RFC3339Nano), line.Stream, line.Text)))
+	return err
+}
+
+// Close all the files
+func (c *Capture) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var err error
+	for _, f := range c.files {
+		e := f.Close()
+		if e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// rotating is a log file, rotated when it's too big
+type rotating struct {
+	service  string
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func (r *rotating) Write(p []byte) (int, error) {
+	if r.file != nil && r.size+int64(len(p)) > r.maxSize {
+		err := r.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if r.file == nil {
+		f, err := os.OpenFile(logFile(r.path, r.service, 0), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+		if err != nil {
+			return 0, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return 0, err
+		}
+		r.file = f
+		r.size = info.Size()
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate service.log to service.log.1, service.log.1 to service.log.2 …
+func (r *rotating) rotate() error {
+	err := r.Close()
+	if err != nil {
+		return err
+	}
+	os.Remove(logFile(r.path, r.service, r.maxFiles-1))
+	for i := r.maxFiles - 2; i >= 0; i-- {
+		err = os.Rename(logFile(r.path, r.service, i), logFile(r.path, r.service, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *rotating) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	r.size = 0
+	return err
+}
@@ -0,0 +1,98 @@
+package logs
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	_run "github.com/factorysh/density/task/run"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogs(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "logs-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s := New(dir)
+	id := uuid.New()
+
+	c, err := s.Capture(id, 1)
+	assert.NoError(t, err)
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		service := "web"
+		if i%2 == 0 {
+			service = "db"
+		}
+		err = c.Write(_run.Line{
+			Time:    start.Add(time.Duration(i) * time.Second),
+			Service: service,
+			Stream:  "stdout",
+			Text:    fmt.Sprintf("line %d", i),
+		})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, c.Close())
+
+	lines, err := s.Read(id, 1, nil, 0)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 10)
+	assert.Equal(t, "line 0", lines[0].Text)
+	assert.Equal(t, "db", lines[0].Service)
+
+	lines, err = s.Read(id, 1, []string{"web"}, 2)
+	assert.NoError(t, err)
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "line 7", lines[0].Text)
+	assert.Equal(t, "line 9", lines[1].Text)
+
+	buff := &bytes.Buffer{}
+	assert.NoError(t, Format(buff, lines[1], false))
+	assert.Equal(t, "web | line 9\n", buff.String())
+
+	_, err = s.Read(id, 1, []string{"../../etc"}, 0)
+	assert.Error(t, err)
+	_, err = s.Read(id, 2, nil, 0)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, s.Delete(id))
+	_, err = os.Stat(path.Join(dir, id.String()))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRotation(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "logs-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s := New(dir)
+	s.MaxSize = 200
+	id := uuid.New()
+
+	c, err := s.Capture(id, 1)
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		err = c.Write(_run.Line{
+			Time:    time.Now(),
+			Service: "web",
+			Stream:  "stdout",
+			Text:    fmt.Sprintf("line %d", i),
+		})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, c.Close())
+
+	for _, name := range []string{"web.log", "web.log.1"} {
+		info, err := os.Stat(path.Join(dir, id.String(), "1", name))
+		assert.NoError(t, err)
+		assert.True(t, info.Size() <= 200)
+	}
+	lines, err := s.Read(id, 1, nil, 0)
+	assert.NoError(t, err)
+	assert.True(t, len(lines) < 100)
+	assert.Equal(t, "line 99", lines[len(lines)-1].Text)
+}
@@ -7,38 +7,40 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
-	"github.com/factorysh/density/owner"
-	"github.com/factorysh/density/path"
+	"github.com/factorysh/density/apikey"
 	"github.com/getsentry/sentry-go"
+	log "github.com/sirupsen/logrus"
 )
 
-// Auth will ensure JWT token is valid
-func Auth(key string) func(next http.Handler) http.Handler {
+// Auth will ensure JWT token, or API key, is valid
+func Auth(verifier *Verifier) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			token, add, err := getToken(r)
 			if err != nil {
-				fmt.Println(err)
-				w.WriteHeader(http.StatusUnauthorized)
+				verifier.reject(w, r, http.StatusUnauthorized, err)
 				return
 			}
 
-			t, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+			if apikey.IsKey(token) && verifier.APIKeys != nil {
+				key, err := verifier.APIKeys.Authenticate(token)
+				if err != nil {
+					verifier.reject(w, r, http.StatusUnauthorized, err)
+					return
 				}
-
-				return []byte(key), nil
-			})
-			if err != nil || !t.Valid {
-				fmt.Println(err)
-				w.WriteHeader(http.StatusUnauthorized)
+				if hub := sentry.GetHubFromContext(r.Context()); hub != nil {
+					hub.WithScope(func(scope *sentry.Scope) {
+						scope.SetExtra("api_key", key.Id)
+					})
+				}
+				u, p := key.Identity()
+				next.ServeHTTP(w, r.WithContext(p.ToCtx(u.ToCtx(r.Context()))))
 				return
 			}
 
-			claims, ok := t.Claims.(jwt.MapClaims)
-			if !ok {
-				w.WriteHeader(http.StatusBadRequest)
+			claims, err := verifier.Verify(token)
+			if err != nil {
+				verifier.reject(w, r, http.StatusUnauthorized, err)
 				return
 			}
 			if hub := sentry.GetHubFromContext(r.Context()); hub != nil {
@@ -47,21 +49,16 @@ func Auth(key string) func(next http.Handler) http.Handler {
 				})
 			}
 
-			u, err := owner.FromJWT(claims)
+			u, p, err := verifier.Identify(claims, Shared(token))
 			if err != nil {
-				fmt.Println(err)
-				w.WriteHeader(http.StatusBadRequest)
+				verifier.reject(w, r, http.StatusBadRequest, err)
 				return
 			}
-			ctx := u.ToCtx(r.Context())
-
-			p, err := path.FromJWT(claims)
-			if err != nil {
-				fmt.Println(err)
-				w.WriteHeader(http.StatusBadRequest)
+			if verifier.Revocations != nil && verifier.Revocations.Revoked(u.Name, claims) {
+				verifier.reject(w, r, http.StatusUnauthorized, fmt.Errorf("Revoked token of %s", u.Name))
 				return
 			}
-			ctx = p.ToCtx(ctx)
+			ctx := p.ToCtx(u.ToCtx(r.Context()))
 
 			if add {
 				addCookie(w, token)
@@ -73,9 +70,24 @@ func Auth(key string) func(next http.Handler) http.Handler {
 	}
 }
 
+// reject a request, with the Rejected hook, or a plain text error
+func (v *Verifier) reject(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if v.Rejected != nil {
+		v.Rejected(w, r, status, err)
+		return
+	}
+	log.WithError(err).WithField("path", r.URL.Path).Info("Authentication refused")
+	http.Error(w, http.StatusText(status), status)
+}
+
+// Verify checks the HMAC signature of a token, and its time claims, exp, iat and nbf
+func Verify(key, token string) (jwt.MapClaims, error) {
+	return NewVerifier(key).Verify(token)
+}
+
 // getToken from Header or Cookie or Param
 func getToken(r *http.Request) (string, bool, error) {
-	getters := []func(*http.Request) (string, bool, error){getTokenFromHeader, getTokenFromParam, getTokenFromCookies}
+	getters := []func(*http.Request) (string, bool, error){getTokenFromHeader, getTokenFromAPIKeyHeader, getTokenFromParam, getTokenFromCookies}
 
 	for _, fun := range getters {
 		token, add, err := fun(r)
@@ -101,6 +113,13 @@ func getTokenFromHeader(r *http.Request) (string, bool, error) {
 	return bToken[1], false, nil
 }
 
+// APIKeyHeader is the HTTP header of an API key, for clients without bearer token
+const APIKeyHeader = "X-Api-Key"
+
+func getTokenFromAPIKeyHeader(r *http.Request) (string, bool, error) {
+	return r.Header.Get(APIKeyHeader), false, nil
+}
+
 func getTokenFromParam(r *http.Request) (string, bool, error) {
 	return r.URL.Query().Get("token"), true, nil
 }
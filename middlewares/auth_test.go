@@ -2,12 +2,17 @@ package middlewares
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/apikey"
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/revocation"
+	"github.com/factorysh/density/store"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
@@ -15,7 +20,7 @@ import (
 func TestAuth(t *testing.T) {
 	key := "plop"
 	router := mux.NewRouter()
-	router.Use(Auth(key))
+	router.Use(Auth(NewVerifier(key)))
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, "Hello, client")
 	})
@@ -69,3 +74,85 @@ func TestAuth(t *testing.T) {
 		assert.Equal(t, a.status, res.StatusCode)
 	}
 }
+
+func TestAuthAPIKey(t *testing.T) {
+	verifier := NewVerifier("plop")
+	verifier.APIKeys = apikey.NewKeys(store.NewMemoryStore())
+	key, err := verifier.APIKeys.Create(&owner.Owner{Name: "root", Admin: true}, &apikey.APIKey{Owner: "cron", Scopes: []string{owner.TasksWrite}})
+	assert.NoError(t, err)
+	router := mux.NewRouter()
+	router.Use(Auth(verifier))
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		u, err := owner.FromCtx(r.Context())
+		assert.NoError(t, err)
+		fmt.Fprint(w, u.Name, u.Scopes)
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	for _, fixture := range []struct {
+		header string
+		value  string
+		status int
+	}{
+		{"Authorization", "Bearer " + key, 200},
+		{APIKeyHeader, key, 200},
+		{APIKeyHeader, key + "0", 401},
+		{APIKeyHeader, "dk_plop", 401},
+	} {
+		r, err := http.NewRequest("GET", ts.URL, nil)
+		assert.NoError(t, err)
+		r.Header.Set(fixture.header, fixture.value)
+		res, err := http.DefaultClient.Do(r)
+		assert.NoError(t, err)
+		assert.Equal(t, fixture.status, res.StatusCode)
+		body, err := ioutil.ReadAll(res.Body)
+		assert.NoError(t, err)
+		res.Body.Close()
+		if fixture.status == 200 {
+			assert.Equal(t, "cron[tasks:write]", string(body))
+		}
+	}
+}
+
+func TestAuthRevoked(t *testing.T) {
+	verifier := NewVerifier("plop")
+	revocations, err := revocation.NewRevocations(store.NewMemoryStore())
+	assert.NoError(t, err)
+	verifier.Revocations = revocations
+	router := mux.NewRouter()
+	router.Use(Auth(verifier))
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello, client")
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"owner": "bob",
+		"jti":   "leaked",
+		"iat":   time.Now().Add(-time.Hour).Unix(),
+	}).SignedString([]byte("plop"))
+	assert.NoError(t, err)
+	// the token of the query string is kept as a cookie
+	res, err := http.Get(ts.URL + "?token=" + token)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	cookies := res.Cookies()
+	assert.Len(t, cookies, 1)
+	get := func() int {
+		r, err := http.NewRequest("GET", ts.URL, nil)
+		assert.NoError(t, err)
+		r.AddCookie(cookies[0])
+		res, err := http.DefaultClient.Do(r)
+		assert.NoError(t, err)
+		return res.StatusCode
+	}
+	assert.Equal(t, 200, get())
+
+	assert.NoError(t, verifier.Revocations.Revoke(&revocation.Revocation{JTI: "leaked"}))
+	assert.Equal(t, 401, get())
+	res, err = http.Get(ts.URL + "?token=" + token)
+	assert.NoError(t, err)
+	assert.Equal(t, 401, res.StatusCode)
+}
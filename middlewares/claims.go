@@ -0,0 +1,188 @@
+package middlewares
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/path"
+)
+
+// ownerName encodes a claim as an owner name, with letters, digits, _ and -.
+// The encoding is one-to-one: / is -, - is _-, _ is __, and other bytes are _ and their hex code,
+// group/my-project is group-my_-project, and group/my.project is group-my_2eproject.
+func ownerName(claim string) string {
+	name := &strings.Builder{}
+	for _, c := range []byte(claim) {
+		switch {
+		case c == '/':
+			name.WriteByte('-')
+		case c == '-' || c == '_':
+			name.WriteByte('_')
+			name.WriteByte(c)
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+			name.WriteByte(c)
+		default:
+			fmt.Fprintf(name, "_%02x", c)
+		}
+	}
+	return name.String()
+}
+
+// unsafePath are the glob characters of go-zglob, and the environment variables it expands
+const unsafePath = "*?[]{}\\$~"
+
+// safePath is true for a claim value without glob characters nor .. in a path template
+func safePath(value string) bool {
+	if strings.ContainsAny(value, unsafePath) {
+		return false
+	}
+	for _, part := range strings.Split(value, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// ClaimMapping derives the owner, groups, admin and path of tokens without an `owner` claim,
+// like GitLab CI job tokens, with `project_path` and `namespace_path` claims.
+type ClaimMapping struct {
+	// Owner claims, the first one found is the owner, encoded by ownerName
+	Owner []string
+	// AdminClaim is a claim with a group, or a list of groups
+	AdminClaim string
+	// AdminValues of AdminClaim which are admins
+	AdminValues []string
+	// Groups claims, their values are the groups of the owner, like namespace_path
+	Groups []string
+	// Path is a template of the path glob, with the claims, like /data/wd/*/volumes/{{.project_path}}/**.
+	// Claims with glob characters or .. can't be used.
+	Path *template.Template
+}
+
+// NewPathTemplate parses a path template, a missing claim is an error
+func NewPathTemplate(raw string) (*template.Template, error) {
+	return template.New("path").Option("missingkey=error").Parse(raw)
+}
+
+func (m *ClaimMapping) owner(claims map[string]interface{}) (*owner.Owner, error) {
+	u := &owner.Owner{}
+	for _, claim := range m.Owner {
+		name, ok := claims[claim].(string)
+		if ok && name != "" {
+			u.Name = ownerName(name)
+			break
+		}
+	}
+	if u.Name == "" {
+		return nil, fmt.Errorf("Missing owner in JWT claims, %s", strings.Join(m.Owner, ", "))
+	}
+	for _, claim := range m.Groups {
+		for _, group := range values(claims, claim) {
+			name, ok := group.(string)
+			if ok && name != "" {
+				u.Groups = append(u.Groups, ownerName(name))
+			}
+		}
+	}
+	if m.AdminClaim == "" {
+		return u, nil
+	}
+	for _, group := range values(claims, m.AdminClaim) {
+		for _, admin := range m.AdminValues {
+			if group == admin {
+				u.Admin = true
+			}
+		}
+	}
+	return u, nil
+}
+
+// values of a claim, a string or a list
+func values(claims map[string]interface{}, claim string) []interface{} {
+	switch value := claims[claim].(type) {
+	case string:
+		return []interface{}{value}
+	case []interface{}:
+		return value
+	}
+	return nil
+}
+
+func (m *ClaimMapping) path(claims map[string]interface{}) (path.Path, error) {
+	if m.Path == nil {
+		return "", nil
+	}
+	// only safe strings, numbers and booleans are given to the template
+	safe := make(map[string]interface{})
+	unsafe := make([]string, 0)
+	for k, v := range claims {
+		switch value := v.(type) {
+		case string:
+			if !safePath(value) {
+				unsafe = append(unsafe, k)
+				continue
+			}
+		case float64, bool:
+		default:
+			continue
+		}
+		safe[k] = v
+	}
+	buff := &bytes.Buffer{}
+	err := m.Path.Execute(buff, safe)
+	if err != nil {
+		if len(unsafe) > 0 {
+			sort.Strings(unsafe)
+			return "", fmt.Errorf("Unsafe claims for the path, %s: %v", strings.Join(unsafe, ", "), err)
+		}
+		return "", err
+	}
+	return path.Path(buff.String()), nil
+}
+
+// Shared is true for a token signed with the HMAC key, like the ones of `density token create`
+func Shared(token string) bool {
+	unverified, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return false
+	}
+	_, ok := unverified.Method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// Identify the owner and the path of a verified token.
+// With a mapping, only a shared token, signed with the HMAC key, can have its own
+// owner, admin and path claims, the claims of the other tokens are always mapped.
+func (v *Verifier) Identify(claims map[string]interface{}, shared bool) (*owner.Owner, path.Path, error) {
+	_, explicit := claims[owner.OWNER]
+	if v.Mapping == nil || (explicit && shared) {
+		u, err := owner.FromJWT(claims)
+		if err != nil {
+			return nil, "", err
+		}
+		p, err := path.FromJWT(claims)
+		if err != nil {
+			return nil, "", err
+		}
+		return u, p, nil
+	}
+	if len(v.Mapping.Owner) == 0 {
+		return nil, "", errors.New("No owner claim is mapped")
+	}
+	u, err := v.Mapping.owner(claims)
+	if err != nil {
+		return nil, "", err
+	}
+	p, err := v.Mapping.path(claims)
+	if err != nil {
+		return nil, "", err
+	}
+	return u, p, nil
+}
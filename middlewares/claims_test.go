@@ -0,0 +1,197 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/owner"
+	"github.com/factorysh/density/path"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// gitlabClaims are the claims of a GitLab CI_JOB_JWT
+func gitlabClaims(namespace, project string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            "gitlab.example.com",
+		"sub":            "job_1212",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"namespace_id":   "1",
+		"namespace_path": namespace,
+		"project_id":     "22",
+		"project_path":   project,
+		"user_login":     "bob",
+		"pipeline_id":    "1212",
+		"job_id":         "1212",
+		"ref":            "main",
+		"ref_type":       "branch",
+		"ref_protected":  "true",
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	tmpl, err := NewPathTemplate("/data/wd/*/volumes/{{.project_path}}/**")
+	assert.NoError(t, err)
+	v := NewVerifier("plop")
+	v.Mapping = &ClaimMapping{
+		Owner:       []string{"project_path", "namespace_path"},
+		AdminClaim:  "namespace_path",
+		AdminValues: []string{"ops"},
+		Path:        tmpl,
+	}
+
+	u, p, err := v.Identify(gitlabClaims("factory", "factory/batch.scheduler"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, &owner.Owner{Name: "factory-batch_2escheduler"}, u)
+	assert.Equal(t, path.Path("/data/wd/*/volumes/factory/batch.scheduler/**"), p)
+
+	u, _, err = v.Identify(gitlabClaims("ops", "ops/deploy"), false)
+	assert.NoError(t, err)
+	assert.True(t, u.Admin)
+
+	// the namespace is a group, sharing its tasks
+	v.Mapping.Groups = []string{"namespace_path"}
+	u, _, err = v.Identify(gitlabClaims("factory/dev", "factory/dev/api"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"factory-dev"}, u.Groups)
+	v.Mapping.Groups = nil
+
+	// the second claim is used
+	claims := gitlabClaims("ops", "")
+	delete(claims, "project_path")
+	tmpl, err = NewPathTemplate("/data/{{.namespace_path}}/**")
+	assert.NoError(t, err)
+	v.Mapping.Path = tmpl
+	u, p, err = v.Identify(claims, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "ops", u.Name)
+	assert.Equal(t, path.Path("/data/ops/**"), p)
+
+	// admin groups can be a list
+	v.Mapping.AdminClaim = "groups"
+	claims["groups"] = []interface{}{"dev", "ops"}
+	u, _, err = v.Identify(claims, false)
+	assert.NoError(t, err)
+	assert.True(t, u.Admin)
+
+	// a missing claim of the template is an error
+	v.Mapping.Path, err = NewPathTemplate("/data/{{.environment}}/**")
+	assert.NoError(t, err)
+	_, _, err = v.Identify(claims, false)
+	assert.Error(t, err)
+
+	// claims can't escape the volume glob
+	v.Mapping.Path, err = NewPathTemplate("/data/{{.namespace_path}}/**")
+	assert.NoError(t, err)
+	for _, namespace := range []string{"../etc", "ops/..", "*", "ops/{a,b}", "$HOME"} {
+		claims["namespace_path"] = namespace
+		_, _, err = v.Identify(claims, false)
+		assert.Error(t, err, namespace)
+	}
+	claims["namespace_path"] = "ops..prod"
+	_, p, err = v.Identify(claims, false)
+	assert.NoError(t, err)
+	assert.Equal(t, path.Path("/data/ops..prod/**"), p)
+
+	_, _, err = v.Identify(jwt.MapClaims{"sub": "nobody"}, false)
+	assert.Error(t, err)
+
+	// the owner claim of a shared token wins
+	u, p, err = v.Identify(jwt.MapClaims{"owner": "alice", "admin": true, "path": "/tmp/*"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, &owner.Owner{Name: "alice", Admin: true}, u)
+	assert.Equal(t, path.Path("/tmp/*"), p)
+	// not the one of a token of an identity provider
+	_, _, err = v.Identify(jwt.MapClaims{"owner": "alice", "admin": true, "path": "/tmp/*"}, false)
+	assert.Error(t, err)
+}
+
+func TestOwnerName(t *testing.T) {
+	names := make(map[string]string)
+	for _, claim := range []string{
+		"a-b/c", "a/b-c", "a/b/c", "a_b/c", "a/b_c", "a_-b", "a__b",
+		"grp/x", "grp.x", "grp-x", "grp_2ex", "grp_x", "-grp", "grp/",
+	} {
+		name := ownerName(claim)
+		assert.Regexp(t, `^[a-zA-Z0-9_-]+$`, name)
+		other, ok := names[name]
+		assert.False(t, ok, "%s and %s are both %s", claim, other, name)
+		names[name] = claim
+	}
+	assert.Equal(t, "factory-density", ownerName("factory/density"))
+	assert.Equal(t, "factory-my_-project", ownerName("factory/my-project"))
+}
+
+// withClaims adds claims
+func withClaims(claims, more jwt.MapClaims) jwt.MapClaims {
+	for k, v := range more {
+		claims[k] = v
+	}
+	return claims
+}
+
+func TestAuthGitLab(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	dir, err := ioutil.TempDir(os.TempDir(), "jwks-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	jwksPath := filepath.Join(dir, "jwks.json")
+	assert.NoError(t, ioutil.WriteFile(jwksPath, jwks(map[string]*ecdsa.PrivateKey{"gitlab": key}), 0600))
+
+	v := NewVerifier("")
+	assert.NoError(t, v.UseJWKS(context.Background(), jwksPath))
+	v.Issuer = "gitlab.example.com"
+	v.Mapping = &ClaimMapping{Owner: []string{"project_path"}}
+
+	router := mux.NewRouter()
+	router.Use(Auth(v))
+	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		u, err := owner.FromCtx(r.Context())
+		assert.NoError(t, err)
+		fmt.Fprint(w, u.Name)
+		if u.Admin {
+			fmt.Fprint(w, " admin")
+		}
+	})
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	for _, fixture := range []struct {
+		claims jwt.MapClaims
+		status int
+		owner  string
+	}{
+		{gitlabClaims("factory", "factory/density"), 200, "factory-density"},
+		// the owner and admin claims of a JWKS token are not trusted
+		{withClaims(gitlabClaims("factory", "factory/density"), jwt.MapClaims{"owner": "root", "admin": true}), 200, "factory-density"},
+		{jwt.MapClaims{"iss": "gitlab.example.com", "owner": "root", "admin": true}, 400, ""},
+		{jwt.MapClaims{"iss": "gitlab.example.com", "sub": "job_1"}, 400, ""},
+		{jwt.MapClaims{"iss": "github.com", "project_path": "factory/density"}, 401, ""},
+	} {
+		r, err := http.NewRequest("GET", ts.URL, nil)
+		assert.NoError(t, err)
+		r.Header.Set("Authorization", "Bearer "+sign(t, jwt.SigningMethodES256, "gitlab", key, fixture.claims))
+		res, err := http.DefaultClient.Do(r)
+		assert.NoError(t, err)
+		assert.Equal(t, fixture.status, res.StatusCode)
+		body, err := ioutil.ReadAll(res.Body)
+		assert.NoError(t, err)
+		res.Body.Close()
+		if fixture.status == 200 {
+			assert.Equal(t, fixture.owner, string(body))
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/factorysh/density/apikey"
+	"github.com/factorysh/density/revocation"
+	log "github.com/sirupsen/logrus"
+)
+
+// minRefresh is the minimum delay between two JWKS loads, for unknown kid
+const minRefresh = time.Minute
+
+// Verifier checks the signature of the tokens, with a shared HMAC key, or public keys,
+// and their registered claims.
+// Public keys are read from PEM files, or a JWKS, file or URL, reloaded from time to time.
+// Several keys are valid at once, selected by the `kid` header, for key rotation.
+type Verifier struct {
+	hmac   []byte
+	lock   sync.RWMutex
+	static map[string]interface{} // PEM keys, by kid
+	jwks   map[string]interface{} // JWKS keys, by kid, replaced by each load
+	source string                 // JWKS file or URL
+	loaded time.Time
+	// Issuer is the expected `iss` claim, if not empty
+	Issuer string
+	// Audience is expected in the `aud` claim, if not empty
+	Audience string
+	// RequireExpiry rejects tokens without `exp` claim
+	RequireExpiry bool
+	// Leeway tolerates clock skew, for `exp`, `nbf` and `iat`
+	Leeway time.Duration
+	// HTTP client, for JWKS URL
+	HTTP *http.Client
+	// Mapping of the claims of tokens without owner claim, or not signed with the HMAC key
+	Mapping *ClaimMapping
+	// APIKeys are static keys of service accounts, accepted next to tokens, if not nil
+	APIKeys *apikey.Keys
+	// Revocations block tokens before their expiry, if not nil
+	Revocations *revocation.Revocations
+	// Rejected answers the requests refused by Auth, if not nil
+	Rejected func(w http.ResponseWriter, r *http.Request, status int, err error)
+}
+
+// NewVerifier with an HMAC key, HS256 tokens are rejected if key is empty
+func NewVerifier(key string) *Verifier {
+	return &Verifier{
+		hmac:   []byte(key),
+		static: make(map[string]interface{}),
+		jwks:   make(map[string]interface{}),
+		HTTP:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AddPEM adds an RSA or ECDSA public key, in PEM format, kid may be empty
+func (v *Verifier) AddPEM(kid string, raw []byte) error {
+	var key interface{}
+	key, err := jwt.ParseRSAPublicKeyFromPEM(raw)
+	if err != nil {
+		key, err = jwt.ParseECPublicKeyFromPEM(raw)
+		if err != nil {
+			return errors.New("Not an RSA or ECDSA public key")
+		}
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.static[kid] = key
+	return nil
+}
+
+// LoadPEMFile adds a public key, its kid is the file name, without extension
+func (v *Verifier) LoadPEMFile(path string) error {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(path)
+	return v.AddPEM(strings.TrimSuffix(name, filepath.Ext(name)), raw)
+}
+
+// UseJWKS loads the keys of a JWKS, from a file or an http(s) URL
+func (v *Verifier) UseJWKS(ctx context.Context, source string) error {
+	v.lock.Lock()
+	v.source = source
+	v.lock.Unlock()
+	return v.Refresh(ctx)
+}
+
+// Refresh reloads the JWKS, keys missing from the new set are not valid anymore
+func (v *Verifier) Refresh(ctx context.Context) error {
+	v.lock.RLock()
+	source := v.source
+	v.lock.RUnlock()
+	if source == "" {
+		return nil
+	}
+	raw, err := v.read(ctx, source)
+	if err != nil {
+		return err
+	}
+	keys, err := ParseJWKS(raw)
+	if err != nil {
+		return fmt.Errorf("Bad JWKS %s: %v", source, err)
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.jwks = keys
+	v.loaded = time.Now()
+	return nil
+}
+
+func (v *Verifier) read(ctx context.Context, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		// a file can be replaced too
+		return ioutil.ReadFile(source)
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := v.HTTP.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS %s answers %s", source, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// Start reloading the JWKS, periodically, until the context is done
+func (v *Verifier) Start(ctx context.Context, period time.Duration) {
+	go func() {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := v.Refresh(ctx)
+				if err != nil {
+					// the previous keys are kept
+					log.WithError(err).Error("JWKS refresh")
+				}
+			}
+		}
+	}()
+}
+
+// candidates are the keys which may have signed the token
+func (v *Verifier) candidates(kid string, method jwt.SigningMethod) []interface{} {
+	if _, ok := method.(*jwt.SigningMethodHMAC); ok {
+		if len(v.hmac) == 0 {
+			return nil
+		}
+		return []interface{}{v.hmac}
+	}
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	keys := make([]interface{}, 0)
+	for _, set := range []map[string]interface{}{v.static, v.jwks} {
+		if kid != "" {
+			if key, ok := set[kid]; ok {
+				keys = append(keys, key)
+			}
+			continue
+		}
+		for _, key := range set {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Verify the signature of a token, and its registered claims
+func (v *Verifier) Verify(token string) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	unverified, _, err := parser.ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := unverified.Header["kid"].(string)
+	keys := v.candidates(kid, unverified.Method)
+	if len(keys) == 0 && kid != "" && v.stale() {
+		// a new key, after a rotation
+		err = v.Refresh(context.Background())
+		if err != nil {
+			log.WithError(err).WithField("kid", kid).Error("JWKS refresh")
+		}
+		keys = v.candidates(kid, unverified.Method)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("No key for %v token, kid: %#v", unverified.Header["alg"], kid)
+	}
+	var claims jwt.MapClaims
+	for _, key := range keys {
+		claims = jwt.MapClaims{}
+		_, err = parser.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+			return key, nil
+		})
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = v.validate(claims)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// stale is true when the JWKS can be reloaded, for an unknown kid
+func (v *Verifier) stale() bool {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return v.source != "" && time.Since(v.loaded) > minRefresh
+}
+
+func numericDate(claims jwt.MapClaims, name string) (time.Time, bool, error) {
+	raw, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	value, ok := raw.(float64)
+	if !ok {
+		return time.Time{}, true, fmt.Errorf("%s claim is not a number", name)
+	}
+	return time.Unix(int64(value), 0), true, nil
+}
+
+// validate the registered claims
+func (v *Verifier) validate(claims jwt.MapClaims) error {
+	now := time.Now()
+	exp, ok, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if ok && now.After(exp.Add(v.Leeway)) {
+		return errors.New("Token is expired")
+	}
+	if !ok && v.RequireExpiry {
+		return errors.New("Token without expiry")
+	}
+	for _, name := range []string{"nbf", "iat"} {
+		t, ok, err := numericDate(claims, name)
+		if err != nil {
+			return err
+		}
+		if ok && now.Add(v.Leeway).Before(t) {
+			return fmt.Errorf("Token is not valid yet, %s claim", name)
+		}
+	}
+	if v.Issuer != "" && claims["iss"] != v.Issuer {
+		return fmt.Errorf("Unexpected issuer: %v", claims["iss"])
+	}
+	if v.Audience != "" && !hasAudience(claims["aud"], v.Audience) {
+		return fmt.Errorf("Unexpected audience: %v", claims["aud"])
+	}
+	return nil
+}
+
+// hasAudience, aud is a string, or a list of strings
+func hasAudience(aud interface{}, audience string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == audience
+	case []interface{}:
+		for _, a := range value {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jwk is a JSON Web Key, only public RSA and EC keys are used
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeInt(raw string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(raw, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("RSA exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("Unknown curve: %s", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("The point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("Unsupported key type: %s", k.Kty)
+}
+
+// ParseJWKS reads the signature keys of a JSON Web Key Set, by kid.
+// Symmetric keys, and keys for encryption, are ignored.
+func ParseJWKS(raw []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := json.Unmarshal(raw, &set)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{})
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" || k.Kty == "oct" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key #%d %s: %v", i, k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
@@ -0,0 +1,197 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	blob, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return blob
+}
+
+func publicPEM(t *testing.T, key interface{}) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func b64(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+// jwks of EC P-256 keys
+func jwks(keys map[string]*ecdsa.PrivateKey) []byte {
+	set := []map[string]string{}
+	for kid, key := range keys {
+		set = append(set, map[string]string{
+			"kty": "EC", "kid": kid, "use": "sig", "crv": "P-256",
+			"x": b64(key.X), "y": b64(key.Y),
+		})
+	}
+	// symmetric keys are ignored
+	set = append(set, map[string]string{"kty": "oct", "kid": "secret", "k": "cGxvcA"})
+	raw, _ := json.Marshal(map[string]interface{}{"keys": set})
+	return raw
+}
+
+func TestVerifierPEM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	v := NewVerifier("")
+	assert.NoError(t, v.AddPEM("rsa1", publicPEM(t, &rsaKey.PublicKey)))
+	assert.Error(t, v.AddPEM("bad", []byte("not a key")))
+
+	claims, err := v.Verify(sign(t, jwt.SigningMethodRS256, "rsa1", rsaKey, jwt.MapClaims{"owner": "bob"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", claims["owner"])
+
+	// without kid, every key is tried
+	_, err = v.Verify(sign(t, jwt.SigningMethodRS256, "", rsaKey, jwt.MapClaims{"owner": "bob"}))
+	assert.NoError(t, err)
+
+	_, err = v.Verify(sign(t, jwt.SigningMethodRS256, "rsa1", other, jwt.MapClaims{"owner": "bob"}))
+	assert.Error(t, err)
+	_, err = v.Verify(sign(t, jwt.SigningMethodRS256, "unknown", rsaKey, jwt.MapClaims{"owner": "bob"}))
+	assert.Error(t, err)
+
+	// without AUTH_KEY, HMAC tokens are rejected, even signed with the public key
+	_, err = v.Verify(sign(t, jwt.SigningMethodHS256, "rsa1", publicPEM(t, &rsaKey.PublicKey), jwt.MapClaims{"owner": "bob"}))
+	assert.Error(t, err)
+	_, err = v.Verify(sign(t, jwt.SigningMethodHS256, "", []byte(""), jwt.MapClaims{"owner": "bob"}))
+	assert.Error(t, err)
+}
+
+func TestVerifierJWKS(t *testing.T) {
+	keys := make(map[string]*ecdsa.PrivateKey)
+	for _, kid := range []string{"ec1", "ec2", "ec3"} {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		keys[kid] = key
+	}
+	var lock sync.Mutex
+	published := map[string]*ecdsa.PrivateKey{"ec1": keys["ec1"]}
+	loads := 0
+	broken := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		loads++
+		if broken {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write(jwks(published))
+	}))
+	defer ts.Close()
+	publish := func(kids ...string) {
+		lock.Lock()
+		defer lock.Unlock()
+		published = make(map[string]*ecdsa.PrivateKey)
+		for _, kid := range kids {
+			published[kid] = keys[kid]
+		}
+	}
+
+	v := NewVerifier("plop")
+	assert.NoError(t, v.UseJWKS(context.Background(), ts.URL))
+	token1 := sign(t, jwt.SigningMethodES256, "ec1", keys["ec1"], jwt.MapClaims{"owner": "bob"})
+	token2 := sign(t, jwt.SigningMethodES256, "ec2", keys["ec2"], jwt.MapClaims{"owner": "bob"})
+	_, err := v.Verify(token1)
+	assert.NoError(t, err)
+	// the HMAC key is still used
+	_, err = v.Verify(sign(t, jwt.SigningMethodHS256, "", []byte("plop"), jwt.MapClaims{"owner": "bob"}))
+	assert.NoError(t, err)
+
+	// rotation, both keys are valid, then only the new one
+	publish("ec1", "ec2")
+	assert.NoError(t, v.Refresh(context.Background()))
+	_, err = v.Verify(token1)
+	assert.NoError(t, err)
+	_, err = v.Verify(token2)
+	assert.NoError(t, err)
+	publish("ec2")
+	assert.NoError(t, v.Refresh(context.Background()))
+	_, err = v.Verify(token1)
+	assert.Error(t, err)
+
+	// an unknown kid reloads the JWKS, not too often
+	publish("ec2", "ec3")
+	token3 := sign(t, jwt.SigningMethodES256, "ec3", keys["ec3"], jwt.MapClaims{"owner": "bob"})
+	lock.Lock()
+	before := loads
+	lock.Unlock()
+	_, err = v.Verify(token3)
+	assert.Error(t, err, "the JWKS is fresh")
+	assert.Equal(t, before, loads)
+	v.lock.Lock()
+	v.loaded = time.Now().Add(-2 * minRefresh)
+	v.lock.Unlock()
+	_, err = v.Verify(token3)
+	assert.NoError(t, err)
+	assert.Equal(t, before+1, loads)
+
+	// a broken JWKS keeps the previous keys
+	lock.Lock()
+	broken = true
+	lock.Unlock()
+	assert.Error(t, v.Refresh(context.Background()))
+	_, err = v.Verify(token3)
+	assert.NoError(t, err)
+}
+
+func TestVerifierClaims(t *testing.T) {
+	v := NewVerifier("plop")
+	v.Issuer = "https://gitlab.example.com"
+	v.Audience = "density"
+	v.RequireExpiry = true
+	v.Leeway = 30 * time.Second
+	now := time.Now()
+	for _, fixture := range []struct {
+		claims jwt.MapClaims
+		valid  bool
+	}{
+		{jwt.MapClaims{"iss": "https://gitlab.example.com", "aud": "density", "exp": now.Add(time.Hour).Unix()}, true},
+		{jwt.MapClaims{"iss": "https://gitlab.example.com", "aud": []string{"vault", "density"}, "exp": now.Add(time.Hour).Unix()}, true},
+		// leeway
+		{jwt.MapClaims{"iss": "https://gitlab.example.com", "aud": "density", "exp": now.Add(-10 * time.Second).Unix()}, true},
+		{jwt.MapClaims{"iss": "https://gitlab.example.com", "aud": "density", "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(10 * time.Second).Unix()}, true},
+		{jwt.MapClaims{"iss": "https://gitlab.example.com", "aud": "density", "exp": now.Add(-time.Minute).Unix()}, false},
+		{jwt.MapClaims{"iss": "https://gitlab.example.com", "aud": "density", "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(time.Minute).Unix()}, false},
+		{jwt.MapClaims{"iss": "https://gitlab.example.com", "aud": "density"}, false},
+		{jwt.MapClaims{"iss": "https://evil.example.com", "aud": "density", "exp": now.Add(time.Hour).Unix()}, false},
+		{jwt.MapClaims{"iss": "https://gitlab.example.com", "aud": "vault", "exp": now.Add(time.Hour).Unix()}, false},
+		{jwt.MapClaims{"iss": "https://gitlab.example.com", "aud": "density", "exp": "tomorrow"}, false},
+	} {
+		_, err := v.Verify(sign(t, jwt.SigningMethodHS256, "", []byte("plop"), fixture.claims))
+		if fixture.valid {
+			assert.NoError(t, err, fixture.claims)
+		} else {
+			assert.Error(t, err, fixture.claims)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package openapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPath(t *testing.T) {
+	assert.True(t, matchPath("/task/{uuid}", "/task/42"))
+	assert.True(t, matchPath("/task/{uuid}/runs/{run}/logs", "/task/42/runs/1/logs"))
+	assert.True(t, matchPath("/tasks:{operation}", "/tasks:cancel"))
+	assert.False(t, matchPath("/task/{uuid}", "/task/42/logs"))
+	assert.False(t, matchPath("/task/{uuid}", "/task/"))
+	assert.False(t, matchPath("/tasks/{owner}", "/tasks:cancel"))
+
+	doc := &Document{Paths: map[string]*PathItem{
+		"/webhooks/{webhook}":  {Get: &Operation{OperationID: "webhook"}},
+		"/webhooks/deliveries": {Get: &Operation{OperationID: "deliveries"}},
+	}}
+	operation, template := doc.Operation("GET", "/webhooks/deliveries")
+	assert.Equal(t, "deliveries", operation.OperationID)
+	assert.Equal(t, "/webhooks/deliveries", template)
+	operation, _ = doc.Operation("DELETE", "/webhooks/deliveries")
+	assert.Nil(t, operation)
+}
+
+func TestValidate(t *testing.T) {
+	doc := &Document{Components: Components{Schemas: map[string]*Schema{
+		"Duration": {OneOf: []*Schema{{Type: "integer"}, {Type: "string"}}},
+		"Thing": Object(map[string]*Schema{
+			"id":     {Type: "string", Format: "uuid"},
+			"time":   {Type: "string", Format: "date-time"},
+			"wait":   Ref("Duration"),
+			"labels": MapOf(&Schema{Type: "string"}),
+			"tags":   {Type: "array", Items: &Schema{Type: "string"}, Nullable: true},
+			"kind":   {Type: "string", Enum: []interface{}{"a", "b"}},
+		}, "id"),
+	}}}
+	for _, tc := range []struct {
+		json string
+		err  string
+	}{
+		{`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "wait": 42, "tags": null}`, ""},
+		{`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "wait": "1s", "time": "2021-01-01T00:00:00Z"}`, ""},
+		{`{}`, "$: id is required"},
+		{`{"id": "plop"}`, "$.id: plop is not a uuid"},
+		{`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "wait": 4.2}`, "$.wait: 0 schemas of oneOf match"},
+		{`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "labels": {"a": 1}}`, "$.labels.a: 1 is not a string"},
+		{`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "kind": "c"}`, "$.kind: c is not in [a b]"},
+		{`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "other": true}`, "$: other is not an allowed property"},
+		{`{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "labels": null}`, "$.labels: null is not allowed"},
+	} {
+		err := doc.ValidateJSON(Ref("Thing"), []byte(tc.json))
+		if tc.err == "" {
+			assert.NoError(t, err, tc.json)
+		} else if assert.Error(t, err, tc.json) {
+			assert.True(t, strings.HasPrefix(err.Error(), tc.err), err.Error())
+		}
+	}
+}
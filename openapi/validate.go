@@ -0,0 +1,244 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ValidationError is a value which doesn't match its schema, at a JSON path
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+func invalid(path, format string, args ...interface{}) error {
+	return &ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}
+}
+
+// Schema resolves a reference
+func (d *Document) Schema(s *Schema) (*Schema, error) {
+	for s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/components/schemas/")
+		resolved, ok := d.Components.Schemas[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown schema: %s", s.Ref)
+		}
+		s = resolved
+	}
+	return s, nil
+}
+
+// Validate a JSON decoded value
+func (d *Document) Validate(s *Schema, value interface{}) error {
+	return d.validate("$", s, value)
+}
+
+// ValidateJSON validates a JSON document
+func (d *Document) ValidateJSON(s *Schema, raw []byte) error {
+	var value interface{}
+	err := json.Unmarshal(raw, &value)
+	if err != nil {
+		return err
+	}
+	return d.Validate(s, value)
+}
+
+func (d *Document) validate(path string, s *Schema, value interface{}) error {
+	s, err := d.Schema(s)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		if s.Nullable {
+			return nil
+		}
+		return invalid(path, "null is not allowed")
+	}
+	if len(s.OneOf) > 0 {
+		matches := 0
+		for _, one := range s.OneOf {
+			if d.validate(path, one, value) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return invalid(path, "%d schemas of oneOf match", matches)
+		}
+		return nil
+	}
+	if len(s.AnyOf) > 0 {
+		for _, one := range s.AnyOf {
+			if d.validate(path, one, value) == nil {
+				return nil
+			}
+		}
+		return invalid(path, "no schema of anyOf matches")
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if e == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return invalid(path, "%v is not in %v", value, s.Enum)
+		}
+	}
+	switch s.Type {
+	case "":
+		return nil
+	case "string":
+		v, ok := value.(string)
+		if !ok {
+			return invalid(path, "%v is not a string", value)
+		}
+		return validateFormat(path, s.Format, v)
+	case "integer":
+		v, ok := value.(float64)
+		if !ok || v != math.Trunc(v) {
+			return invalid(path, "%v is not an integer", value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return invalid(path, "%v is not a number", value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return invalid(path, "%v is not a boolean", value)
+		}
+	case "array":
+		v, ok := value.([]interface{})
+		if !ok {
+			return invalid(path, "%v is not an array", value)
+		}
+		if s.Items == nil {
+			return nil
+		}
+		for i, item := range v {
+			err = d.validate(path+"["+strconv.Itoa(i)+"]", s.Items, item)
+			if err != nil {
+				return err
+			}
+		}
+	case "object":
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			return invalid(path, "%v is not an object", value)
+		}
+		return d.validateObject(path, s, v)
+	default:
+		return fmt.Errorf("Unknown type: %s", s.Type)
+	}
+	return nil
+}
+
+func (d *Document) validateObject(path string, s *Schema, value map[string]interface{}) error {
+	for _, name := range s.Required {
+		if _, ok := value[name]; !ok {
+			return invalid(path, "%s is required", name)
+		}
+	}
+	// sorted, for stable errors
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		property, ok := s.Properties[name]
+		if !ok {
+			switch additional := s.AdditionalProperties.(type) {
+			case bool:
+				if !additional {
+					return invalid(path, "%s is not an allowed property", name)
+				}
+				continue
+			case *Schema:
+				property = additional
+			default:
+				continue
+			}
+		}
+		err := d.validate(path+"."+name, property, value[name])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateFormat(path, format, value string) error {
+	var err error
+	switch format {
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, value)
+	case "uuid":
+		_, err = uuid.Parse(value)
+	}
+	if err != nil {
+		return invalid(path, "%s is not a %s: %v", value, format, err)
+	}
+	return nil
+}
+
+func isJSON(contentType string) bool {
+	media, _, err := mime.ParseMediaType(contentType)
+	return err == nil && media == "application/json"
+}
+
+// ValidateRequest validates the JSON body of a request
+func (d *Document) ValidateRequest(method, path, contentType string, body []byte) error {
+	operation, _ := d.Operation(method, path)
+	if operation == nil {
+		return fmt.Errorf("Undocumented operation: %s %s", method, path)
+	}
+	if operation.RequestBody == nil || !isJSON(contentType) {
+		return nil
+	}
+	media, ok := operation.RequestBody.Content["application/json"]
+	if !ok {
+		return fmt.Errorf("%s %s doesn't accept JSON", method, path)
+	}
+	return d.ValidateJSON(media.Schema, body)
+}
+
+// ValidateResponse validates the status and the JSON body of a response
+func (d *Document) ValidateResponse(method, path string, status int, contentType string, body []byte) error {
+	operation, template := d.Operation(method, path)
+	if operation == nil {
+		return fmt.Errorf("Undocumented operation: %s %s", method, path)
+	}
+	response, ok := operation.Responses[strconv.Itoa(status)]
+	if !ok {
+		response, ok = operation.Responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("Undocumented status %d for %s %s", status, method, template)
+	}
+	if !isJSON(contentType) || len(body) == 0 {
+		return nil
+	}
+	media, ok := response.Content["application/json"]
+	if !ok {
+		return fmt.Errorf("Undocumented JSON response %d for %s %s", status, method, template)
+	}
+	err := d.ValidateJSON(media.Schema, body)
+	if err != nil {
+		return fmt.Errorf("%s %s %d: %v", method, template, status, err)
+	}
+	return nil
+}
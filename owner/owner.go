@@ -19,8 +19,10 @@ const ADMIN = "admin"
 
 // Owner represents an authenticated user info
 type Owner struct {
-	Name  string
-	Admin bool
+	Name   string   `json:"name"`
+	Admin  bool     `json:"admin"`
+	Groups []string `json:"groups,omitempty"` // Teams sharing their tasks
+	Scopes []string `json:"scopes,omitempty"` // The scopes of the user role if nil
 }
 
 // ToCtx creates a context containing a user key
@@ -50,11 +52,15 @@ func FromJWT(claims map[string]interface{}) (*Owner, error) {
 		}
 	}
 
-	return &Owner{
+	u := &Owner{
 		Name:  name,
 		Admin: isAdmin,
-	}, nil
-
+	}
+	err := u.scopesFromJWT(claims)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
 }
 
 // FromCtx extract a user from a context
@@ -0,0 +1,160 @@
+package owner
+
+import (
+	"errors"
+	"strings"
+)
+
+// Scopes of the API. A scope is granted on the tasks of the owner and its groups,
+// the `:any` variant grants it on every task.
+const (
+	TasksRead      = "tasks:read"
+	TasksReadAny   = "tasks:read:any"
+	TasksWrite     = "tasks:write"
+	TasksWriteAny  = "tasks:write:any"
+	TasksCancel    = "tasks:cancel"
+	TasksCancelAny = "tasks:cancel:any"
+	VolumesRead    = "volumes:read"
+	AdminResources = "admin:resources"
+	AdminKeys      = "admin:keys"
+	AdminTokens    = "admin:tokens"
+	AdminAudit     = "admin:audit"
+)
+
+// scopes are all the known scopes
+var scopes = []string{
+	TasksRead, TasksReadAny, TasksWrite, TasksWriteAny, TasksCancel, TasksCancelAny,
+	VolumesRead, AdminResources, AdminKeys, AdminTokens, AdminAudit,
+}
+
+// Any is the suffix of a scope granted on every owner
+const Any = ":any"
+
+// SCOPE, SCOPES, ROLES and GROUPS identifiers in map
+const (
+	SCOPE  = "scope"
+	SCOPES = "scopes"
+	ROLES  = "roles"
+	GROUPS = "groups"
+)
+
+// RoleAdmin has every scope
+const RoleAdmin = "admin"
+
+// RoleUser is the role of a token without roles nor scopes
+const RoleUser = "user"
+
+// Roles are sets of scopes
+var Roles = map[string][]string{
+	RoleAdmin:  {TasksReadAny, TasksWriteAny, TasksCancelAny, VolumesRead, AdminResources, AdminKeys, AdminTokens, AdminAudit},
+	RoleUser:   {TasksRead, TasksWrite, TasksCancel, VolumesRead},
+	"viewer":   {TasksRead, VolumesRead},
+	"operator": {TasksReadAny, TasksCancelAny, VolumesRead},
+}
+
+// IsScope returns true for a known scope
+func IsScope(scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Can returns true if the owner has this scope, for its own tasks at least.
+// Without scopes, an owner has the scopes of the user role.
+func (u *Owner) Can(scope string) bool {
+	if u.Admin {
+		return true
+	}
+	scopes := u.Scopes
+	if scopes == nil {
+		scopes = Roles[RoleUser]
+	}
+	for _, s := range scopes {
+		if s == scope || s == scope+Any {
+			return true
+		}
+	}
+	return false
+}
+
+// Owns returns true for its own name, and the name of its groups
+func (u *Owner) Owns(name string) bool {
+	if name == u.Name {
+		return true
+	}
+	for _, group := range u.Groups {
+		if group == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Owners are the owners whose tasks are shared with this owner, its name and its groups
+func (u *Owner) Owners() []string {
+	return append([]string{u.Name}, u.Groups...)
+}
+
+// Allowed returns true if the owner has the scope on the tasks of this owner
+func (u *Owner) Allowed(scope, owner string) bool {
+	return u.Can(scope+Any) || (u.Can(scope) && u.Owns(owner))
+}
+
+// strings of a claim, a list, or a string separated by spaces
+func claimStrings(claims map[string]interface{}, key string) ([]string, bool, error) {
+	val, ok := claims[key]
+	if !ok {
+		return nil, false, nil
+	}
+	switch v := val.(type) {
+	case string:
+		return strings.Fields(v), true, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, value := range v {
+			s, ok := value.(string)
+			if !ok {
+				return nil, false, errors.New("JWT " + key + " claim is not a list of strings")
+			}
+			values = append(values, s)
+		}
+		return values, true, nil
+	case []string:
+		return v, true, nil
+	}
+	return nil, false, errors.New("JWT " + key + " claim is not a list of strings")
+}
+
+// scopesFromJWT reads the `scope`, `scopes` and `roles` claims.
+// Scopes are nil without these claims, unknown scopes and roles are ignored.
+func (u *Owner) scopesFromJWT(claims map[string]interface{}) error {
+	found := false
+	scopes := make([]string, 0)
+	for _, key := range []string{SCOPE, SCOPES} {
+		values, ok, err := claimStrings(claims, key)
+		if err != nil {
+			return err
+		}
+		found = found || ok
+		scopes = append(scopes, values...)
+	}
+	roles, ok, err := claimStrings(claims, ROLES)
+	if err != nil {
+		return err
+	}
+	found = found || ok
+	for _, role := range roles {
+		if role == RoleAdmin {
+			u.Admin = true
+		}
+		scopes = append(scopes, Roles[role]...)
+	}
+	if found {
+		u.Scopes = scopes
+	}
+	u.Groups, _, err = claimStrings(claims, GROUPS)
+	return err
+}
@@ -0,0 +1,56 @@
+package owner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopes(t *testing.T) {
+	// without scopes, the user role
+	u, err := FromJWT(map[string]interface{}{"owner": "bob"})
+	assert.NoError(t, err)
+	assert.Nil(t, u.Scopes)
+	assert.True(t, u.Can(TasksWrite))
+	assert.False(t, u.Can(TasksReadAny))
+	assert.True(t, u.Allowed(TasksCancel, "bob"))
+	assert.False(t, u.Allowed(TasksCancel, "alice"))
+
+	u, err = FromJWT(map[string]interface{}{
+		"owner":  "bob",
+		"scope":  "tasks:read tasks:cancel:any openid",
+		"groups": []interface{}{"team"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, u.Can(TasksRead))
+	assert.False(t, u.Can(TasksWrite))
+	assert.True(t, u.Allowed(TasksRead, "team"))
+	assert.False(t, u.Allowed(TasksRead, "alice"))
+	assert.True(t, u.Allowed(TasksCancel, "alice"))
+	assert.Equal(t, []string{"bob", "team"}, u.Owners())
+
+	u, err = FromJWT(map[string]interface{}{
+		"owner":  "bob",
+		"roles":  []interface{}{"viewer"},
+		"scopes": []interface{}{AdminResources},
+	})
+	assert.NoError(t, err)
+	assert.True(t, u.Can(VolumesRead))
+	assert.True(t, u.Can(AdminResources))
+	assert.False(t, u.Can(TasksCancel))
+
+	u, err = FromJWT(map[string]interface{}{"owner": "bob", "roles": "admin"})
+	assert.NoError(t, err)
+	assert.True(t, u.Admin)
+	assert.True(t, u.Allowed(TasksWrite, "alice"))
+
+	// an unknown role has no scope
+	u, err = FromJWT(map[string]interface{}{"owner": "bob", "roles": []interface{}{"plop"}})
+	assert.NoError(t, err)
+	assert.False(t, u.Can(TasksRead))
+
+	_, err = FromJWT(map[string]interface{}{"owner": "bob", "groups": 42})
+	assert.Error(t, err)
+	_, err = FromJWT(map[string]interface{}{"owner": "bob", "scopes": []interface{}{42}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,105 @@
+package pubsub
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sort"
+
+	"github.com/factorysh/density/store"
+)
+
+// DefaultJournalSize is the number of events kept by a Journal
+const DefaultJournalSize = 10000
+
+// Journal is an append only list of events, stored with their sequence number.
+// Only the size latest events are kept.
+type Journal struct {
+	store   store.Store
+	size    int
+	last    uint64
+	appends int
+}
+
+// NewJournal loads a journal from a store
+func NewJournal(s store.Store, size int) (*Journal, error) {
+	j := &Journal{
+		store: s,
+		size:  size,
+	}
+	err := s.ForEach(func(k, v []byte) error {
+		seq := binary.BigEndian.Uint64(k)
+		if seq > j.last {
+			j.last = seq
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// Last sequence number
+func (j *Journal) Last() uint64 {
+	return j.last
+}
+
+func key(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
+
+// Append an event, its sequence number must be greater than the last one
+func (j *Journal) Append(evt Event) error {
+	value, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	err = j.store.Put(key(evt.Seq), value)
+	if err != nil {
+		return err
+	}
+	j.last = evt.Seq
+	j.appends++
+	// trim from time to time, not at each append
+	if j.appends >= j.size/10 && j.last > uint64(j.size) {
+		j.appends = 0
+		oldest := j.last - uint64(j.size)
+		return j.store.DeleteWithClause(func(k, v []byte) bool {
+			return binary.BigEndian.Uint64(k) <= oldest
+		})
+	}
+	return nil
+}
+
+// Since returns events after the seq sequence number, sorted.
+// A store with a cursor seeks to the seq.
+func (j *Journal) Since(seq uint64) ([]Event, error) {
+	events := make([]Event, 0)
+	each := j.store.ForEach
+	if seeker, ok := j.store.(store.Seeker); ok {
+		each = func(fn func(k, v []byte) error) error {
+			return seeker.ForEachFrom(key(seq+1), fn)
+		}
+	}
+	err := each(func(k, v []byte) error {
+		if binary.BigEndian.Uint64(k) <= seq {
+			return nil
+		}
+		var evt Event
+		err := json.Unmarshal(v, &evt)
+		if err != nil {
+			return err
+		}
+		events = append(events, evt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(events, func(i, k int) bool {
+		return events[i].Seq < events[k].Seq
+	})
+	return events, nil
+}
@@ -0,0 +1,60 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/factorysh/density/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournal(t *testing.T) {
+	s := store.NewMemoryStore()
+	j, err := NewJournal(s, 10)
+	assert.NoError(t, err)
+	for i := 1; i <= 25; i++ {
+		err = j.Append(Event{Seq: uint64(i), Action: "plop"})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, uint64(25), j.Last())
+	events, err := j.Since(20)
+	assert.NoError(t, err)
+	assert.Len(t, events, 5)
+	assert.Equal(t, uint64(21), events[0].Seq)
+	// old events are trimmed
+	events, err = j.Since(0)
+	assert.NoError(t, err)
+	assert.True(t, len(events) < 25)
+	assert.Equal(t, uint64(25), events[len(events)-1].Seq)
+
+	j, err = NewJournal(s, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(25), j.Last())
+}
+
+func TestResume(t *testing.T) {
+	s := store.NewMemoryStore()
+	j, err := NewJournal(s, DefaultJournalSize)
+	assert.NoError(t, err)
+	ps := NewPubSub()
+	ps.UseJournal(j)
+	for i := 0; i < 5; i++ {
+		ps.Publish(Event{Action: "plop"})
+	}
+
+	// a restarted pubsub continues the sequence
+	j, err = NewJournal(s, DefaultJournalSize)
+	assert.NoError(t, err)
+	ps = NewPubSub()
+	ps.UseJournal(j)
+	assert.Equal(t, uint64(5), ps.Last())
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	events, err := ps.SubscribeSince(ctx, 3)
+	assert.NoError(t, err)
+	ps.Publish(Event{Action: "plop"})
+	for _, seq := range []uint64{4, 5, 6} {
+		assert.Equal(t, seq, (<-events).Seq)
+	}
+}
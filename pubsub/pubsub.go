@@ -2,6 +2,7 @@ package pubsub
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -10,33 +11,143 @@ import (
 )
 
 type Event struct {
-	Action string    `json:"action"`
-	Id     uuid.UUID `json:"id"`
+	Seq      uint64            `json:"seq"` // Sequence number, monotonic
+	Action   string            `json:"action"`
+	Id       uuid.UUID         `json:"id"`
+	From     string            `json:"from,omitempty"` // Previous status
+	To       string            `json:"to,omitempty"`   // New status
+	Owner    string            `json:"owner,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	RunId    int               `json:"run_id,omitempty"`
+	ExitCode *int              `json:"exit_code,omitempty"` // Only for a finished run
+	Time     time.Time         `json:"time"`
+	Reason   string            `json:"reason,omitempty"`
 }
 
+// Policy for a subscriber with a full chan
+type Policy int
+
+const (
+	// Block the publisher until the subscriber reads, for trusted subscribers
+	Block Policy = iota
+	// Drop the events the subscriber can't read
+	Drop
+	// Disconnect the subscriber, its chan is closed
+	Disconnect
+)
+
+// ParsePolicy reads a policy name
+func ParsePolicy(name string) (Policy, error) {
+	switch name {
+	case "block":
+		return Block, nil
+	case "drop":
+		return Drop, nil
+	case "disconnect":
+		return Disconnect, nil
+	default:
+		return Block, fmt.Errorf("Unknown policy: %s", name)
+	}
+}
+
+const defaultBuffer = 100
+
+type subscriber struct {
+	c       chan Event
+	policy  Policy
+	after   uint64 // events already replayed
+	lock    sync.Mutex
+	dropped uint64
+	closed  bool
+}
+
+// PubSub fans out events to its subscribers. The sequence and the journal have their own lock,
+// a slow journal doesn't block the subscriptions. Publishers are serialized,
+// subscribers read the events in the seq order.
 type PubSub struct {
-	lock        *sync.RWMutex
+	lock        *sync.RWMutex // subscribers
+	seqLock     sync.Mutex    // seq and Journal
+	publishLock sync.Mutex    // numbering and fan-out, in the same order
 	cpt         uint64
-	subscribers map[uint64]chan Event
+	seq         uint64
+	subscribers map[uint64]*subscriber
 	wg          *sync.WaitGroup
+	Journal     *Journal
+	// SlowPolicy is the policy of subscriptions with a cursor, remote clients that can resume
+	SlowPolicy Policy
+	// Buffer is the size of the subscribers chan
+	Buffer int
 }
 
 func NewPubSub() *PubSub {
 	return &PubSub{
 		lock:        &sync.RWMutex{},
 		cpt:         0,
-		subscribers: make(map[uint64]chan Event),
+		subscribers: make(map[uint64]*subscriber),
 		wg:          &sync.WaitGroup{},
+		SlowPolicy:  Disconnect,
+		Buffer:      defaultBuffer,
+	}
+}
+
+// UseJournal persists events, sequence continues after the last journaled event
+func (p *PubSub) UseJournal(j *Journal) {
+	p.seqLock.Lock()
+	defer p.seqLock.Unlock()
+	p.Journal = j
+	if j.Last() > p.seq {
+		p.seq = j.Last()
 	}
 }
 
-// Subscribe
+// Subscribe, events are dropped when the chan is full
 func (p *PubSub) Subscribe(ctx context.Context) chan Event {
+	return p.SubscribeWithPolicy(ctx, Drop)
+}
+
+// SubscribeWithPolicy chooses what happens when the chan is full.
+// Block is only for subscribers reading fast, it blocks every publisher.
+func (p *PubSub) SubscribeWithPolicy(ctx context.Context, policy Policy) chan Event {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.subscribe(ctx, make(chan Event, p.Buffer), policy, 0)
+}
+
+// SubscribeSince replays journaled events after the seq cursor, then live events.
+// The SlowPolicy is used, with Disconnect, the chan is closed.
+func (p *PubSub) SubscribeSince(ctx context.Context, seq uint64) (chan Event, error) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
+	// an event may be journaled, and not yet published, it's sent once
+	last := p.Last()
+	if seq > last { // only the next events
+		seq = last
+	}
+	replay := []Event{}
+	if p.Journal != nil && seq < last {
+		var err error
+		replay, err = p.Journal.Since(seq)
+		if err != nil {
+			return nil, err
+		}
+	}
+	c := make(chan Event, len(replay)+p.Buffer)
+	after := seq
+	for _, evt := range replay {
+		c <- evt
+		after = evt.Seq
+	}
+	return p.subscribe(ctx, c, p.SlowPolicy, after), nil
+}
+
+func (p *PubSub) subscribe(ctx context.Context, c chan Event, policy Policy, after uint64) chan Event {
 	id := p.cpt
 	p.cpt++
-	p.subscribers[id] = make(chan Event, 100)
+	p.subscribers[id] = &subscriber{
+		c:      c,
+		policy: policy,
+		after:  after,
+	}
 	p.wg.Add(1)
 	go func(id uint64) {
 		<-ctx.Done() // closing the subscription
@@ -47,18 +158,48 @@ func (p *PubSub) Subscribe(ctx context.Context) chan Event {
 		log.WithField("id", id).Info("Closing subscribtion")
 	}(id)
 	log.WithField("id", id).WithField("subscribers", len(p.subscribers)).Info("Opening subscribtion")
-	return p.subscribers[id]
+	return c
+}
+
+// Last sequence number
+func (p *PubSub) Last() uint64 {
+	p.seqLock.Lock()
+	defer p.seqLock.Unlock()
+	return p.seq
 }
 
-// Publish an event
+// Publish an event, it's journaled, then sent to the subscribers
 func (p *PubSub) Publish(evt Event) {
+	p.publishLock.Lock()
+	defer p.publishLock.Unlock()
+	p.seqLock.Lock()
+	p.seq++
+	evt.Seq = p.seq
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	if p.Journal != nil {
+		err := p.Journal.Append(evt)
+		if err != nil {
+			log.WithError(err).WithField("event", evt).Error("Journal append")
+		}
+	}
+	p.seqLock.Unlock()
+
 	p.lock.RLock()
 	defer p.lock.RUnlock()
 	var worst time.Duration = 0
-	// Warning, chans are blocking
-	for _, c := range p.subscribers {
+	for id, s := range p.subscribers {
+		if evt.Seq <= s.after {
+			continue
+		}
 		now := time.Now()
-		c <- evt
+		if s.policy == Block {
+			// Warning, chans are blocking
+			s.c <- evt
+		} else {
+			s.send(id, evt)
+		}
 		delta := time.Since(now)
 		if delta > worst {
 			worst = delta
@@ -67,6 +208,27 @@ func (p *PubSub) Publish(evt Event) {
 	log.WithField("event", evt).WithField("subscribers", len(p.subscribers)).WithField("worst duration", worst).Info("publish")
 }
 
+// send an event without blocking, publishers share the subscriber
+func (s *subscriber) send(id uint64, evt Event) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.c <- evt:
+	default:
+		if s.policy == Drop {
+			s.dropped++
+			log.WithField("id", id).WithField("dropped", s.dropped).Warning("Slow subscriber, event dropped")
+		} else {
+			s.closed = true
+			close(s.c)
+			log.WithField("id", id).Warning("Slow subscriber, disconnected")
+		}
+	}
+}
+
 // Wait for all subscribers closing
 func (p *PubSub) Wait() {
 	p.wg.Wait()
@@ -3,6 +3,7 @@ package pubsub
 import (
 	"context"
 	"fmt"
+	"math"
 	"math/rand"
 	"sync"
 	"testing"
@@ -53,7 +54,7 @@ func TestPubSubFlood(t *testing.T) {
 		go func() {
 			ctx, cancel := context.WithCancel(context.TODO())
 			defer cancel()
-			events := ps.Subscribe(ctx)
+			events := ps.SubscribeWithPolicy(ctx, Block)
 			ready.Done()
 			for {
 				event := <-events
@@ -71,3 +72,73 @@ func TestPubSubFlood(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestPublishOrder(t *testing.T) {
+	subscribers := 10
+	publishers := 100
+	events := 10
+	ps := NewPubSub()
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	wg := sync.WaitGroup{}
+	wg.Add(subscribers)
+	for i := 0; i < subscribers; i++ {
+		c := ps.SubscribeWithPolicy(ctx, Block)
+		go func() {
+			defer wg.Done()
+			var last uint64
+			for i := 0; i < publishers*events; i++ {
+				evt := <-c
+				assert.Greater(t, evt.Seq, last)
+				last = evt.Seq
+			}
+		}()
+	}
+	for i := 0; i < publishers; i++ {
+		go func() {
+			for j := 0; j < events; j++ {
+				ps.Publish(Event{Action: "plop"})
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(publishers*events), ps.Last())
+}
+
+func TestSlowPolicy(t *testing.T) {
+	ps := NewPubSub()
+	ps.Buffer = 2
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	ps.SlowPolicy = Drop
+	dropped, err := ps.SubscribeSince(ctx, math.MaxUint64)
+	assert.NoError(t, err)
+	ps.SlowPolicy = Disconnect
+	disconnected, err := ps.SubscribeSince(ctx, math.MaxUint64)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		ps.Publish(Event{Action: "plop"}) // never blocks
+	}
+	assert.Equal(t, uint64(1), (<-dropped).Seq)
+	assert.Equal(t, uint64(2), (<-dropped).Seq)
+	assert.Len(t, dropped, 0)
+
+	assert.Equal(t, uint64(1), (<-disconnected).Seq)
+	assert.Equal(t, uint64(2), (<-disconnected).Seq)
+	_, ok := <-disconnected
+	assert.False(t, ok)
+}
+
+func TestSubscribeSinceNow(t *testing.T) {
+	ps := NewPubSub()
+	ps.Publish(Event{Action: "before"})
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	events, err := ps.SubscribeSince(ctx, math.MaxUint64)
+	assert.NoError(t, err)
+	ps.Publish(Event{Action: "after"})
+	evt := <-events
+	assert.Equal(t, "after", evt.Action)
+	assert.Equal(t, uint64(2), evt.Seq)
+}
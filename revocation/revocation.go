@@ -0,0 +1,205 @@
+package revocation
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/factorysh/density/store"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Bucket of the store
+const Bucket = "revocations"
+
+// DefaultTTL is the lifetime of an entry without expiry
+const DefaultTTL = 30 * 24 * time.Hour
+
+// ErrUnknownRevocation is returned when deleting an entry that doesn't exist
+var ErrUnknownRevocation = errors.New("Unknown revocation")
+
+// Revocation blocks a token, by its `jti`, or every token of an owner issued before a time
+type Revocation struct {
+	Id           uuid.UUID  `json:"id"`
+	JTI          string     `json:"jti,omitempty"`
+	Owner        string     `json:"owner,omitempty"`
+	IssuedBefore *time.Time `json:"issued_before,omitempty"` // For an owner, now by default
+	Reason       string     `json:"reason,omitempty"`
+	Created      time.Time  `json:"created"`
+	// Expires is when the entry is removed, after the expiry of the revoked tokens
+	Expires time.Time `json:"expires"`
+}
+
+// Validate a new entry, and set its defaults
+func (r *Revocation) Validate(now time.Time) error {
+	if (r.JTI == "") == (r.Owner == "") {
+		return errors.New("A jti or an owner is mandatory, not both")
+	}
+	if r.JTI != "" && r.IssuedBefore != nil {
+		return errors.New("issued_before is only for an owner")
+	}
+	if r.Owner != "" && r.IssuedBefore == nil {
+		r.IssuedBefore = &now
+	}
+	if r.Expires.IsZero() {
+		r.Expires = now.Add(DefaultTTL)
+	}
+	if !r.Expires.After(now) {
+		return errors.New("The revocation is already expired")
+	}
+	return nil
+}
+
+// Revocations stores Revocation, with an index in memory.
+// Expired entries are ignored, and removed by the next write.
+type Revocations struct {
+	store  store.Store
+	lock   sync.RWMutex
+	jtis   map[string]time.Time // expiry, by jti
+	owners map[string][]*Revocation
+}
+
+// NewRevocations uses a store, and loads its index.
+// Without its index, revoked tokens would be accepted.
+func NewRevocations(s store.Store) (*Revocations, error) {
+	r := &Revocations{store: s}
+	err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load the index, broken entries are skipped
+func (r *Revocations) load() error {
+	r.jtis = make(map[string]time.Time)
+	r.owners = make(map[string][]*Revocation)
+	return r.store.ForEach(func(k, v []byte) error {
+		var revocation Revocation
+		err := json.Unmarshal(v, &revocation)
+		if err != nil {
+			log.WithError(err).WithField("id", string(k)).Error("Broken revocation")
+			return nil
+		}
+		r.index(&revocation)
+		return nil
+	})
+}
+
+func (r *Revocations) index(revocation *Revocation) {
+	if revocation.JTI != "" {
+		if revocation.Expires.After(r.jtis[revocation.JTI]) {
+			r.jtis[revocation.JTI] = revocation.Expires
+		}
+		return
+	}
+	r.owners[revocation.Owner] = append(r.owners[revocation.Owner], revocation)
+}
+
+// purge expired entries, with the lock
+func (r *Revocations) purge(now time.Time) error {
+	err := r.store.DeleteWithClause(func(_, v []byte) bool {
+		var revocation Revocation
+		if json.Unmarshal(v, &revocation) != nil {
+			return false
+		}
+		return !revocation.Expires.After(now)
+	})
+	if err != nil {
+		return err
+	}
+	return r.load()
+}
+
+// Revoke tokens, an id is given to the entry
+func (r *Revocations) Revoke(revocation *Revocation) error {
+	now := time.Now()
+	err := revocation.Validate(now)
+	if err != nil {
+		return err
+	}
+	revocation.Id, err = uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+	revocation.Created = now
+	value, err := json.Marshal(revocation)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	err = r.store.Put([]byte(revocation.Id.String()), value)
+	if err != nil {
+		return err
+	}
+	return r.purge(now)
+}
+
+// Delete an entry, its tokens are accepted again
+func (r *Revocations) Delete(id uuid.UUID) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	v, err := r.store.Get([]byte(id.String()))
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return ErrUnknownRevocation
+	}
+	err = r.store.Delete([]byte(id.String()))
+	if err != nil {
+		return err
+	}
+	return r.purge(time.Now())
+}
+
+// List the entries which are not expired, latest first, broken entries are skipped
+func (r *Revocations) List() ([]*Revocation, error) {
+	now := time.Now()
+	revocations := make([]*Revocation, 0)
+	err := r.store.ForEach(func(_, v []byte) error {
+		var revocation Revocation
+		if json.Unmarshal(v, &revocation) != nil {
+			return nil // logged by load
+		}
+		if revocation.Expires.After(now) {
+			revocations = append(revocations, &revocation)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(revocations, func(i, j int) bool {
+		return revocations[i].Created.After(revocations[j].Created)
+	})
+	return revocations, nil
+}
+
+// Revoked is true for a revoked token, by its `jti`, or its owner and `iat`.
+// A token without `iat` is revoked with its owner.
+// `iat` is in seconds, a token issued in the same second as issued_before is revoked.
+func (r *Revocations) Revoked(owner string, claims map[string]interface{}) bool {
+	now := time.Now()
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if jti, ok := claims["jti"].(string); ok && jti != "" {
+		if expires, ok := r.jtis[jti]; ok && expires.After(now) {
+			return true
+		}
+	}
+	var issued time.Time
+	if iat, ok := claims["iat"].(float64); ok {
+		issued = time.Unix(int64(iat), 0)
+	}
+	for _, revocation := range r.owners[owner] {
+		if revocation.Expires.After(now) && !issued.After(revocation.IssuedBefore.Truncate(time.Second)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package revocation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func claims(jti string, iat time.Time) map[string]interface{} {
+	return map[string]interface{}{"jti": jti, "iat": float64(iat.Unix())}
+}
+
+func TestRevocations(t *testing.T) {
+	s := store.NewMemoryStore()
+	r, err := NewRevocations(s)
+	assert.NoError(t, err)
+	now := time.Now()
+	hourAgo := now.Add(-time.Hour)
+
+	assert.False(t, r.Revoked("bob", claims("leaked", hourAgo)))
+	err = r.Revoke(&Revocation{JTI: "leaked", Reason: "pasted in a chat"})
+	assert.NoError(t, err)
+	assert.True(t, r.Revoked("bob", claims("leaked", hourAgo)))
+	assert.False(t, r.Revoked("bob", claims("other", hourAgo)))
+
+	before := now.Add(-time.Minute)
+	assert.NoError(t, r.Revoke(&Revocation{Owner: "alice", IssuedBefore: &before}))
+	assert.True(t, r.Revoked("alice", claims("", hourAgo)))
+	assert.True(t, r.Revoked("alice", map[string]interface{}{}), "without iat")
+	assert.False(t, r.Revoked("alice", claims("", now)))
+	assert.False(t, r.Revoked("bob", claims("", hourAgo)))
+
+	assert.Error(t, r.Revoke(&Revocation{}))
+	assert.Error(t, r.Revoke(&Revocation{JTI: "a", Owner: "bob"}))
+	assert.Error(t, r.Revoke(&Revocation{JTI: "a", Expires: hourAgo}))
+
+	// the index is loaded from the store
+	assert.NoError(t, s.Put([]byte("broken"), []byte("{")))
+	r, err = NewRevocations(s)
+	assert.NoError(t, err)
+	assert.True(t, r.Revoked("bob", claims("leaked", hourAgo)))
+	list, err := r.List()
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "alice", list[0].Owner)
+	assert.Nil(t, list[1].IssuedBefore)
+
+	// expired entries are ignored, then removed
+	soon := &Revocation{JTI: "soon", Expires: now.Add(50 * time.Millisecond)}
+	assert.NoError(t, r.Revoke(soon))
+	assert.True(t, r.Revoked("bob", claims("soon", hourAgo)))
+	time.Sleep(60 * time.Millisecond)
+	assert.False(t, r.Revoked("bob", claims("soon", hourAgo)))
+	list, err = r.List()
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.NoError(t, r.Delete(list[1].Id))
+	assert.Equal(t, 2, s.Length(), "the broken entry is kept")
+
+	assert.Equal(t, ErrUnknownRevocation, r.Delete(list[1].Id))
+	assert.False(t, r.Revoked("bob", claims("leaked", hourAgo)))
+}
+
+func TestRevokedSameSecond(t *testing.T) {
+	r, err := NewRevocations(store.NewMemoryStore())
+	assert.NoError(t, err)
+	assert.NoError(t, r.Revoke(&Revocation{Owner: "carol"}))
+	now := time.Now()
+	assert.True(t, r.Revoked("carol", claims("", now)), "iat has no fraction of second")
+	assert.False(t, r.Revoked("carol", claims("", now.Add(time.Second))))
+}
+
+func TestRevocationsLoadError(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "revocations-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := store.NewBoltStore(filepath.Join(dir, "store.bolt"))
+	assert.NoError(t, err)
+	bucket, err := s.Bucket(Bucket)
+	assert.NoError(t, err)
+	s.Db.Close()
+	_, err = NewRevocations(bucket)
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"errors"
+
+	"github.com/factorysh/density/task"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// addChildren expands an array task, already stored, in children tasks.
+// Nothing is left if a child can't be stored.
+func (s *Scheduler) addChildren(parent *task.Task) error {
+	children, err := parent.Children()
+	if err != nil {
+		return err
+	}
+	for i, child := range children {
+		child.Id, err = uuid.NewRandom()
+		if err == nil {
+			child.Status = _status.Waiting
+			err = s.tasks.Put(child)
+		}
+		if err != nil {
+			for _, added := range children[:i] {
+				if err := s.tasks.Delete(added.Id); err != nil {
+					log.WithError(err).WithField("id", added.Id).Error("Can't remove array child")
+				}
+			}
+			return err
+		}
+	}
+	for _, child := range children {
+		s.publish("added", child, "")
+	}
+	return nil
+}
+
+// Children of an array task
+func (s *Scheduler) Children(parent uuid.UUID) []*task.Task {
+	children := make([]*task.Task, 0)
+	s.tasks.ForEach(func(t *task.Task) error {
+		if t.Parent == parent {
+			children = append(children, t)
+		}
+		return nil
+	})
+	return children
+}
+
+// errUnchanged stops a modification without error
+var errUnchanged = errors.New("unchanged")
+
+// aggregate the status of an array task from its children, with the scheduler lock,
+// children finishing together can't overwrite a newer status
+func (s *Scheduler) aggregate(id uuid.UUID) {
+	var from _status.Status
+	parent, err := s.modify(id, func(parent *task.Task) error {
+		if parent.Status == _status.Canceled {
+			return errUnchanged
+		}
+		status := task.AggregateStatus(s.Children(id))
+		if status == parent.Status {
+			return errUnchanged
+		}
+		from = parent.Status
+		parent.SetStatus(status, "array children")
+		return nil
+	})
+	if errors.Is(err, errUnchanged) || errors.Is(err, ErrUnknownTask) {
+		return
+	}
+	if err != nil {
+		log.WithError(err).WithField("id", id).Error("Can't aggregate array task")
+		return
+	}
+	s.publishTransition(parent, from, "array children")
+}
+
+// arrayRunning counts running children of each array task
+func (s *Scheduler) arrayRunning() (map[uuid.UUID]int, map[uuid.UUID]int) {
+	running := make(map[uuid.UUID]int)
+	parallelism := make(map[uuid.UUID]int)
+	s.tasks.ForEach(func(t *task.Task) error {
+		if t.Array != nil {
+			parallelism[t.Id] = t.Array.Parallelism
+		}
+		if t.Parent != uuid.Nil && t.Status == _status.Running {
+			running[t.Parent]++
+		}
+		return nil
+	})
+	return running, parallelism
+}
+
+// arrayFull is true for a child of an array with as many running children as its parallelism
+func arrayFull(t *task.Task, running, parallelism map[uuid.UUID]int) bool {
+	return t.Parent != uuid.Nil && parallelism[t.Parent] > 0 && running[t.Parent] >= parallelism[t.Parent]
+}
@@ -0,0 +1,166 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/runner"
+	"github.com/factorysh/density/store"
+	_task "github.com/factorysh/density/task"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArray(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	size := 4
+	wait := waitFor(s.Pubsub, size+1, func(event pubsub.Event) bool {
+		return event.Action == "Done"
+	})
+	parent := &_task.Task{
+		Start:           time.Now(),
+		MaxExectionTime: 5 * time.Second,
+		Action: &_task.DummyAction{
+			Name: "Array",
+			Wait: 50 * time.Millisecond,
+		},
+		Array: &_task.Array{
+			Start:       1,
+			End:         size,
+			Parallelism: 1,
+		},
+		CPU: 1,
+		RAM: 64,
+	}
+	id, err := s.Add(parent)
+	assert.NoError(t, err)
+	assert.Equal(t, size+1, s.Length())
+
+	// never more running children than parallelism
+	for i := 0; i < 10; i++ {
+		running := 0
+		for _, child := range s.Children(id) {
+			if child.Status == _status.Running {
+				running++
+			}
+		}
+		assert.True(t, running <= 1)
+		time.Sleep(20 * time.Millisecond)
+	}
+	wait.Wait()
+
+	indexes := make(map[string]bool)
+	for _, child := range s.Children(id) {
+		assert.Equal(t, _status.Done, child.Status)
+		indexes[child.Environments["DENSITY_ARRAY_INDEX"]] = true
+	}
+	assert.Equal(t, map[string]bool{"1": true, "2": true, "3": true, "4": true}, indexes)
+	fromStorage, err := s.GetTask(id)
+	assert.NoError(t, err)
+	assert.Equal(t, _status.Done, fromStorage.Status)
+
+	err = s.Delete(id)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, s.Length())
+}
+
+// failingStore fails to put after some writes
+type failingStore struct {
+	*store.MemoryStore
+	puts int
+}
+
+func (f *failingStore) Put(k, v []byte) error {
+	if f.puts == 0 {
+		return errors.New("disk full")
+	}
+	f.puts--
+	return f.MemoryStore.Put(k, v)
+}
+
+func laterArray(size int) *_task.Task {
+	return &_task.Task{
+		Start:           time.Now().Add(time.Hour),
+		MaxExectionTime: 5 * time.Second,
+		Action:          &_task.DummyAction{Name: "Array"},
+		Array:           &_task.Array{Start: 1, End: size},
+		CPU:             1,
+		RAM:             64,
+	}
+}
+
+func TestArrayAggregate(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	// children finishing together, like their goroutines of execTask
+	size := 16
+	id, err := s.Add(laterArray(size))
+	assert.NoError(t, err)
+	wg := &sync.WaitGroup{}
+	for _, child := range s.Children(id) {
+		wg.Add(1)
+		go func(child *_task.Task) {
+			defer wg.Done()
+			child.SetStatus(_status.Done, "done")
+			assert.NoError(t, s.tasks.Put(child))
+			s.aggregate(id)
+		}(child)
+	}
+	wg.Wait()
+	parent, err := s.GetTask(id)
+	assert.NoError(t, err)
+	assert.Equal(t, _status.Done, parent.Status)
+
+	// deleting the last waiting child finishes the array
+	id, err = s.Add(laterArray(2))
+	assert.NoError(t, err)
+	children := s.Children(id)
+	children[0].SetStatus(_status.Done, "done")
+	assert.NoError(t, s.tasks.Put(children[0]))
+	s.aggregate(id)
+	parent, err = s.GetTask(id)
+	assert.NoError(t, err)
+	assert.Equal(t, _status.Running, parent.Status)
+	assert.NoError(t, s.Delete(children[1].Id))
+	parent, err = s.GetTask(id)
+	assert.NoError(t, err)
+	assert.Equal(t, _status.Done, parent.Status)
+}
+
+func TestArrayPartial(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	// the parent and 2 children are stored, not the third one
+	failing := &failingStore{MemoryStore: store.NewMemoryStore(), puts: 3}
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), failing)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	_, err = s.Add(laterArray(4))
+	assert.Error(t, err)
+	assert.Equal(t, 0, s.Length())
+}
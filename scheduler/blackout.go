@@ -0,0 +1,223 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/factorysh/density/selector"
+	"github.com/factorysh/density/store"
+	"github.com/factorysh/density/task"
+	"github.com/google/uuid"
+)
+
+// Blackout is a period when no new task may start.
+// A blackout with a Cron is a maintenance calendar : a window of Duration opens at each occurrence,
+// between Start and End if they are set.
+type Blackout struct {
+	Id       uuid.UUID         `json:"id"`
+	Name     string            `json:"name"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Cron     string            `json:"cron,omitempty"`     // Recurring window, opened at each occurrence
+	Duration task.Duration     `json:"duration,omitempty"` // Length of a recurring window
+	Owner    string            `json:"owner,omitempty"`    // Only tasks of this owner, everybody if empty
+	Labels   map[string]string `json:"labels,omitempty"`   // Only tasks with all these labels
+	Selector string            `json:"selector,omitempty"` // Only tasks matching this label selector
+	selector selector.Selector // Parsed by Validate
+}
+
+// Validate a blackout, and parse its selector
+func (b *Blackout) Validate() error {
+	var err error
+	b.selector, err = selector.Parse(b.Selector)
+	if err != nil {
+		return err
+	}
+	if b.Cron == "" {
+		if b.Start.IsZero() || b.End.IsZero() {
+			return errors.New("A blackout without cron needs a start and an end")
+		}
+		if !b.End.After(b.Start) {
+			return errors.New("Blackout end must be after its start")
+		}
+		return nil
+	}
+	_, err = task.Parser.Parse(b.Cron)
+	if err != nil {
+		return err
+	}
+	if b.Duration <= 0 {
+		return errors.New("A recurring blackout needs a duration > 0")
+	}
+	if !b.Start.IsZero() && !b.End.IsZero() && !b.End.After(b.Start) {
+		return errors.New("Blackout end must be after its start")
+	}
+	return nil
+}
+
+// Matches returns true if the task is concerned by this blackout
+func (b *Blackout) Matches(t *task.Task) bool {
+	if b.Owner != "" && b.Owner != t.Owner {
+		return false
+	}
+	for key, value := range b.Labels {
+		taskValue, found := t.Labels[key]
+		if !found || taskValue != value {
+			return false
+		}
+	}
+	return b.selector.Matches(t.Labels)
+}
+
+// Window returns the end of the window containing at, or false
+func (b *Blackout) Window(at time.Time) (time.Time, bool) {
+	if b.Cron == "" {
+		if !at.Before(b.Start) && at.Before(b.End) {
+			return b.End, true
+		}
+		return time.Time{}, false
+	}
+	if !b.Start.IsZero() && at.Before(b.Start) {
+		return time.Time{}, false
+	}
+	if !b.End.IsZero() && !at.Before(b.End) {
+		return time.Time{}, false
+	}
+	sched, err := task.Parser.Parse(b.Cron)
+	if err != nil {
+		return time.Time{}, false
+	}
+	duration := time.Duration(b.Duration)
+	// first occurrence after at - duration, its window is still open if it starts before at
+	start := sched.Next(at.Add(-duration))
+	if start.After(at) {
+		return time.Time{}, false
+	}
+	end := start.Add(duration)
+	if !b.End.IsZero() && end.After(b.End) {
+		end = b.End
+	}
+	return end, true
+}
+
+// Blackouts stores Blackout
+type Blackouts struct {
+	store     store.Store
+	lock      sync.RWMutex
+	blackouts map[uuid.UUID]*Blackout
+}
+
+// NewBlackouts loads blackouts from a store
+func NewBlackouts(s store.Store) (*Blackouts, error) {
+	b := &Blackouts{
+		store:     s,
+		blackouts: make(map[uuid.UUID]*Blackout),
+	}
+	err := s.ForEach(func(k, v []byte) error {
+		var blackout Blackout
+		err := json.Unmarshal(v, &blackout)
+		if err != nil {
+			return err
+		}
+		blackout.selector, err = selector.Parse(blackout.Selector)
+		if err != nil {
+			return err
+		}
+		b.blackouts[blackout.Id] = &blackout
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Put a Blackout, an Id is chosen if it's missing
+func (b *Blackouts) Put(blackout *Blackout) error {
+	err := blackout.Validate()
+	if err != nil {
+		return err
+	}
+	if blackout.Id == uuid.Nil {
+		blackout.Id, err = uuid.NewRandom()
+		if err != nil {
+			return err
+		}
+	}
+	value, err := json.Marshal(blackout)
+	if err != nil {
+		return err
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	err = b.store.Put([]byte(blackout.Id.String()), value)
+	if err != nil {
+		return err
+	}
+	b.blackouts[blackout.Id] = blackout
+	return nil
+}
+
+// Delete a Blackout
+func (b *Blackouts) Delete(id uuid.UUID) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, ok := b.blackouts[id]; !ok {
+		return ErrUnknownBlackout
+	}
+	err := b.store.Delete([]byte(id.String()))
+	if err != nil {
+		return err
+	}
+	delete(b.blackouts, id)
+	return nil
+}
+
+// ErrUnknownBlackout is returned when deleting an unknown blackout
+var ErrUnknownBlackout = errors.New("Unknown blackout")
+
+// List all the Blackouts, sorted by start
+func (b *Blackouts) List() []*Blackout {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	blackouts := make([]*Blackout, 0, len(b.blackouts))
+	for _, blackout := range b.blackouts {
+		blackouts = append(blackouts, blackout)
+	}
+	sort.Slice(blackouts, func(i, j int) bool {
+		return blackouts[i].Start.Before(blackouts[j].Start)
+	})
+	return blackouts
+}
+
+// maxChainedWindows avoid looping forever with a misconfigured calendar
+const maxChainedWindows = 100
+
+// Until returns when the task t, blocked at time at, may start. Zero time means not blocked.
+// Overlapping and adjacent windows are chained.
+func (b *Blackouts) Until(t *task.Task, at time.Time) time.Time {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	var until time.Time
+	for i := 0; i < maxChainedWindows; i++ {
+		blocked := false
+		for _, blackout := range b.blackouts {
+			if !blackout.Matches(t) {
+				continue
+			}
+			end, ok := blackout.Window(at)
+			if ok && end.After(at) {
+				at = end
+				until = end
+				blocked = true
+			}
+		}
+		if !blocked {
+			break
+		}
+	}
+	return until
+}
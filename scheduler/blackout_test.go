@@ -0,0 +1,206 @@
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/runner"
+	"github.com/factorysh/density/store"
+	_task "github.com/factorysh/density/task"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlackoutWindow(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 30, 0, 0, time.Local)
+	fixed := &Blackout{
+		Start: now.Add(-time.Hour),
+		End:   now.Add(time.Hour),
+	}
+	assert.NoError(t, fixed.Validate())
+	end, ok := fixed.Window(now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Hour), end)
+	_, ok = fixed.Window(now.Add(2 * time.Hour))
+	assert.False(t, ok)
+
+	// every day, from noon to 2pm
+	daily := &Blackout{
+		Cron:     "0 12 * * *",
+		Duration: _task.Duration(2 * time.Hour),
+	}
+	assert.NoError(t, daily.Validate())
+	end, ok = daily.Window(now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2021, 6, 1, 14, 0, 0, 0, time.Local), end)
+	_, ok = daily.Window(now.Add(-time.Hour))
+	assert.False(t, ok)
+	_, ok = daily.Window(now.Add(2 * time.Hour))
+	assert.False(t, ok)
+
+	assert.Error(t, (&Blackout{Cron: "0 12 * * *"}).Validate())
+	assert.Error(t, (&Blackout{Start: now, End: now}).Validate())
+}
+
+func TestBlackoutsUntil(t *testing.T) {
+	now := time.Now()
+	blackouts, err := NewBlackouts(store.NewMemoryStore())
+	assert.NoError(t, err)
+	for _, b := range []*Blackout{
+		{
+			Start: now.Add(-time.Hour),
+			End:   now.Add(time.Hour),
+			Owner: "bob",
+		},
+		{ // chained with the first one
+			Start: now.Add(time.Hour),
+			End:   now.Add(2 * time.Hour),
+			Owner: "bob",
+		},
+		{
+			Start:  now.Add(-time.Hour),
+			End:    now.Add(time.Hour),
+			Labels: map[string]string{"env": "prod"},
+		},
+		{
+			Start:    now.Add(-time.Hour),
+			End:      now.Add(time.Hour),
+			Selector: "tier in (db,cache), !temporary",
+		},
+	} {
+		assert.NoError(t, blackouts.Put(b))
+	}
+	assert.Len(t, blackouts.List(), 4)
+	assert.Error(t, blackouts.Put(&Blackout{Cron: "0 12 * * *", Duration: _task.Duration(time.Hour), Selector: "tier in ()"}))
+
+	assert.Equal(t, now.Add(2*time.Hour), blackouts.Until(&_task.Task{Owner: "bob"}, now))
+	assert.True(t, blackouts.Until(&_task.Task{Owner: "alice"}, now).IsZero())
+	assert.Equal(t, now.Add(time.Hour), blackouts.Until(&_task.Task{
+		Owner:  "alice",
+		Labels: map[string]string{"env": "prod"},
+	}, now))
+	assert.Equal(t, now.Add(time.Hour), blackouts.Until(&_task.Task{
+		Owner:  "alice",
+		Labels: map[string]string{"tier": "db"},
+	}, now))
+	assert.True(t, blackouts.Until(&_task.Task{
+		Owner:  "alice",
+		Labels: map[string]string{"tier": "db", "temporary": "yes"},
+	}, now).IsZero())
+
+	// the selector is parsed again when loading
+	loaded, err := NewBlackouts(blackouts.store)
+	assert.NoError(t, err)
+	assert.True(t, loaded.Until(&_task.Task{
+		Owner:  "alice",
+		Labels: map[string]string{"tier": "web"},
+	}, now).IsZero())
+	assert.True(t, now.Add(time.Hour).Equal(loaded.Until(&_task.Task{
+		Owner:  "alice",
+		Labels: map[string]string{"tier": "cache"},
+	}, now)))
+}
+
+func TestSchedulerBlackout(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	blackout := &Blackout{
+		Start: time.Now().Add(-time.Minute),
+		End:   time.Now().Add(500 * time.Millisecond),
+		Owner: "bob",
+	}
+	err = s.AddBlackout(blackout)
+	assert.NoError(t, err)
+
+	wait := waitFor(s.Pubsub, 1, func(event pubsub.Event) bool {
+		return event.Action == "Done"
+	})
+	task := &_task.Task{
+		Owner:           "bob",
+		Start:           time.Now(),
+		MaxExectionTime: 5 * time.Second,
+		Action: &_task.DummyAction{
+			Name: "Blacked out",
+			Wait: 10 * time.Millisecond,
+		},
+		CPU: 1,
+		RAM: 64,
+	}
+	_, err = s.Add(task)
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	fromStorage, err := s.tasks.Get(task.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, _status.Waiting, fromStorage.Status)
+	// the loop wakes up when the blackout ends
+	wait.Wait()
+	fromStorage, err = s.tasks.Get(task.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, _status.Done, fromStorage.Status)
+	assert.False(t, fromStorage.Start.Before(blackout.End))
+}
+
+func TestBlackoutSkipCron(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	end := time.Now().Add(time.Hour)
+	err = s.AddBlackout(&Blackout{
+		Start: time.Now().Add(-time.Minute),
+		End:   end,
+	})
+	assert.NoError(t, err)
+
+	for _, catchUp := range []bool{false, true} {
+		start := time.Now().Add(-time.Second)
+		task := &_task.Task{
+			Start:           start,
+			Every:           time.Minute,
+			CatchUp:         catchUp,
+			MaxExectionTime: 5 * time.Second,
+			Action: &_task.DummyAction{
+				Name: "Periodic",
+			},
+			CPU: 1,
+			RAM: 64,
+		}
+		_, err = s.Add(task)
+		assert.NoError(t, err)
+		time.Sleep(100 * time.Millisecond)
+		fromStorage, err := s.tasks.Get(task.Id)
+		assert.NoError(t, err)
+		assert.Equal(t, _status.Waiting, fromStorage.Status)
+		if catchUp {
+			assert.True(t, fromStorage.Start.Before(end))
+		} else {
+			assert.False(t, fromStorage.Start.Before(end))
+		}
+	}
+}
+
+func TestBrokenBlackouts(t *testing.T) {
+	s := store.NewMemoryStore()
+	bucket, err := s.Bucket("blackouts")
+	assert.NoError(t, err)
+	err = bucket.Put([]byte("broken"), []byte("{"))
+	assert.NoError(t, err)
+	_, err = New(NewResources(4, 16*1024), nil, s)
+	assert.Error(t, err)
+}
@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"fmt"
+
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/task"
+	_run "github.com/factorysh/density/task/run"
+	_status "github.com/factorysh/density/task/status"
+)
+
+func event(action string, t *task.Task, reason string) pubsub.Event {
+	evt := pubsub.Event{
+		Action: action,
+		Id:     t.Id,
+		To:     t.Status.String(),
+		Owner:  t.Owner,
+		Labels: t.Labels,
+		Reason: reason,
+	}
+	if t.Run != nil {
+		data := t.Run.Data()
+		evt.RunId = data.ID
+		switch t.Status {
+		case _status.Done, _status.Error, _status.Timeout:
+			evt.ExitCode = &data.ExitCode
+		}
+	}
+	return evt
+}
+
+// publish an event about a task, without status change
+func (s *Scheduler) publish(action string, t *task.Task, reason string) {
+	s.Pubsub.Publish(event(action, t, reason))
+}
+
+// publishTransition publishes the status change of a task, already saved
+func (s *Scheduler) publishTransition(t *task.Task, from _status.Status, reason string) {
+	evt := event(t.Status.String(), t, reason)
+	evt.From = from.String()
+	s.Pubsub.Publish(evt)
+}
+
+// finished explains the end of a run
+func finished(status _status.Status, run _run.Run) string {
+	switch status {
+	case _status.Timeout:
+		return "max execution time exceeded"
+	case _status.Canceled:
+		return "canceled"
+	default:
+		return fmt.Sprintf("exit code %d", run.Data().ExitCode)
+	}
+}
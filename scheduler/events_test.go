@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/runner"
+	"github.com/factorysh/density/store"
+	_task "github.com/factorysh/density/task"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransitions(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	var done pubsub.Event
+	wait := waitFor(s.Pubsub, 1, func(event pubsub.Event) bool {
+		if event.Action == "Done" {
+			done = event
+			return true
+		}
+		return false
+	})
+	task := &_task.Task{
+		Owner:           "bob",
+		Start:           time.Now(),
+		MaxExectionTime: 5 * time.Second,
+		Labels: map[string]string{
+			"key": "value",
+		},
+		Action: &_task.DummyAction{
+			Name: "Transitions",
+			Wait: 10 * time.Millisecond,
+		},
+		CPU: 1,
+		RAM: 64,
+	}
+	_, err = s.Add(task)
+	assert.NoError(t, err)
+	wait.Wait()
+
+	assert.Equal(t, task.Id, done.Id)
+	assert.Equal(t, "Running", done.From)
+	assert.Equal(t, "Done", done.To)
+	assert.Equal(t, "bob", done.Owner)
+	assert.Equal(t, "value", done.Labels["key"])
+	assert.NotNil(t, done.ExitCode)
+	assert.Equal(t, "exit code 0", done.Reason)
+	assert.False(t, done.Time.IsZero())
+
+	fromStorage, err := s.tasks.Get(task.Id)
+	assert.NoError(t, err)
+	assert.Len(t, fromStorage.History, 2)
+	assert.Equal(t, _status.Waiting, fromStorage.History[0].From)
+	assert.Equal(t, _status.Running, fromStorage.History[0].To)
+	assert.Equal(t, "started", fromStorage.History[0].Reason)
+	assert.Equal(t, _status.Done, fromStorage.History[1].To)
+}
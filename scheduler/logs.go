@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/factorysh/density/task"
+	_run "github.com/factorysh/density/task/run"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// captureLogs of a finished run, if the scheduler stores logs
+func (s *Scheduler) captureLogs(t *task.Task, run _run.Run) {
+	logger, ok := run.(_run.Logger)
+	if s.Logs == nil || !ok {
+		return
+	}
+	l := log.WithField("id", t.Id).WithField("run", run.Data().ID)
+	capture, err := s.Logs.Capture(t.Id, run.Data().ID)
+	if err != nil {
+		l.WithError(err).Error("Can't capture logs")
+		return
+	}
+	defer capture.Close()
+	err = logger.Logs(context.TODO(), false, capture.Write)
+	if err != nil {
+		l.WithError(err).Error("Can't capture logs")
+	}
+}
+
+// deleteLogs of a task
+func (s *Scheduler) deleteLogs(t *task.Task) {
+	if s.Logs == nil {
+		return
+	}
+	err := s.Logs.Delete(t.Id)
+	if err != nil {
+		log.WithError(err).WithField("id", t.Id).Error("Can't delete logs")
+	}
+}
+
+// ErrNotRunning is returned when following the logs of a task which is not running
+var ErrNotRunning = errors.New("Task is not running")
+
+// followGrace is the delay to read the last lines after the end of a run
+const followGrace = time.Second
+
+// FollowLogs streams the logs of the current run of a task, from its start, until the end of the run
+func (s *Scheduler) FollowLogs(ctx context.Context, id uuid.UUID, sink func(_run.Line) error) error {
+	s.runningLock.Lock()
+	r, ok := s.running[id]
+	s.runningLock.Unlock()
+	if !ok {
+		return ErrNotRunning
+	}
+	logger, ok := r.task.Run.(_run.Logger)
+	if !ok {
+		return errors.New("This run has no logs")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-r.finished:
+			select {
+			case <-time.After(followGrace):
+			case <-ctx.Done():
+			}
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return logger.Logs(ctx, true, sink)
+}
@@ -0,0 +1,90 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/factorysh/density/task"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/google/uuid"
+)
+
+// ErrNotFinished is returned when retrying a task which is not finished
+var ErrNotFinished = errors.New("Only a failed, timed out or canceled task can be retried")
+
+// modify a task with the scheduler lock, and save it
+func (s *Scheduler) modify(id uuid.UUID, fn func(t *task.Task) error) (*task.Task, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	t, err := s.tasks.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTask, id.String())
+	}
+	err = fn(t)
+	if err != nil {
+		return nil, err
+	}
+	return t, s.tasks.Put(t)
+}
+
+// Pause a waiting task, it will not start until it's resumed
+func (s *Scheduler) Pause(id uuid.UUID) error {
+	t, err := s.modify(id, func(t *task.Task) error {
+		if t.Status != _status.Waiting || t.Array != nil {
+			return ErrNotWaiting
+		}
+		t.Paused = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.publish("paused", t, "")
+	return nil
+}
+
+// Resume a paused task
+func (s *Scheduler) Resume(id uuid.UUID) error {
+	t, err := s.modify(id, func(t *task.Task) error {
+		t.Paused = false
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.somethingNewHappened.Ping()
+	s.publish("resumed", t, "")
+	return nil
+}
+
+// Retry a failed, timed out or canceled task, it's back in the queue, now
+func (s *Scheduler) Retry(id uuid.UUID) error {
+	var from _status.Status
+	t, err := s.modify(id, func(t *task.Task) error {
+		from = t.Status
+		switch t.Status {
+		case _status.Error, _status.Timeout, _status.Canceled:
+		default:
+			return ErrNotFinished
+		}
+		if t.Array != nil {
+			return &InvalidTaskError{Field: "array", Message: "Retry the children of an array task"}
+		}
+		t.SetStatus(_status.Waiting, "retried")
+		t.Start = time.Now()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.somethingNewHappened.Ping()
+	s.publishTransition(t, from, "retried")
+	if t.Parent != uuid.Nil {
+		s.aggregate(t.Parent)
+	}
+	return nil
+}
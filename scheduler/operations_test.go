@@ -0,0 +1,82 @@
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/runner"
+	"github.com/factorysh/density/store"
+	_task "github.com/factorysh/density/task"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperations(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	// a paused task doesn't start
+	id, err := s.Add(&_task.Task{
+		Owner:           "bob",
+		Start:           time.Now(),
+		MaxExectionTime: time.Minute,
+		Action:          &_task.DummyAction{Name: "Paused"},
+		CPU:             1,
+		RAM:             64,
+		Paused:          true,
+	})
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	task, err := s.GetTask(id)
+	assert.NoError(t, err)
+	assert.Equal(t, _status.Waiting, task.Status)
+
+	wait := waitFor(s.Pubsub, 1, func(event pubsub.Event) bool {
+		return event.Id == id && event.Action == "Done"
+	})
+	assert.NoError(t, s.Resume(id))
+	wait.Wait()
+	assert.Equal(t, ErrNotWaiting, s.Pause(id))
+	assert.Equal(t, ErrNotFinished, s.Retry(id))
+
+	id, err = s.Add(&_task.Task{
+		Owner:           "bob",
+		Start:           time.Now().Add(time.Hour),
+		MaxExectionTime: time.Minute,
+		Action:          &_task.DummyAction{Name: "Later"},
+		CPU:             1,
+		RAM:             64,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Pause(id))
+	task, err = s.GetTask(id)
+	assert.NoError(t, err)
+	assert.True(t, task.Paused)
+	assert.Equal(t, ErrNotFinished, s.Retry(id))
+
+	assert.NoError(t, s.Cancel(id))
+	wait = waitFor(s.Pubsub, 1, func(event pubsub.Event) bool {
+		return event.Id == id && event.Action == "Done"
+	})
+	assert.NoError(t, s.Resume(id))
+	// retried now
+	assert.NoError(t, s.Retry(id))
+	wait.Wait()
+	task, err = s.GetTask(id)
+	assert.NoError(t, err)
+	reasons := make([]string, 0)
+	for _, transition := range task.History {
+		reasons = append(reasons, transition.Reason)
+	}
+	assert.Contains(t, reasons, "retried")
+}
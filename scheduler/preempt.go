@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/factorysh/density/task"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// running is a task watched by execTask
+type running struct {
+	task      *task.Task
+	cancel    context.CancelFunc
+	preempted bool
+	finished  chan interface{} // closed when the run is over
+}
+
+func (s *Scheduler) watch(t *task.Task, cancel context.CancelFunc) {
+	s.runningLock.Lock()
+	defer s.runningLock.Unlock()
+	s.running[t.Id] = &running{
+		task:     t,
+		cancel:   cancel,
+		finished: make(chan interface{}),
+	}
+}
+
+// finish tells the followers of a running task that its run is over
+func (s *Scheduler) finish(id uuid.UUID) {
+	s.runningLock.Lock()
+	defer s.runningLock.Unlock()
+	r, ok := s.running[id]
+	if ok {
+		close(r.finished)
+	}
+}
+
+// unwatch forgets a running task, and tells if it was preempted
+func (s *Scheduler) unwatch(id uuid.UUID) bool {
+	s.runningLock.Lock()
+	defer s.runningLock.Unlock()
+	r, ok := s.running[id]
+	if !ok {
+		return false
+	}
+	delete(s.running, id)
+	return r.preempted
+}
+
+// preempt stops preemptible running tasks with a lower priority,
+// to make room for the most urgent waiting task. It returns true if some tasks are stopped.
+// A child of an array which can't start more children is not a candidate.
+// The waiting tasks are read before locking the running ones, execTask locks in this order.
+func (s *Scheduler) preempt() bool {
+	now := time.Now()
+	waiting := make([]*task.Task, 0)
+	// running children and parallelism of arrays, counted in the same pass
+	arrays := make(map[uuid.UUID]int)
+	parallelism := make(map[uuid.UUID]int)
+	s.lock.RLock()
+	free, freeRAM := s.resources.Free()
+	s.tasks.ForEach(func(t *task.Task) error {
+		if t.Array != nil {
+			parallelism[t.Id] = t.Array.Parallelism
+			return nil
+		}
+		if t.Parent != uuid.Nil && t.Status == _status.Running {
+			arrays[t.Parent]++
+		}
+		if t.Status == _status.Waiting && !t.Paused && t.Start.Before(now) && (t.CPU > free || t.RAM > freeRAM) &&
+			s.Blackouts.Until(t, now).IsZero() {
+			waiting = append(waiting, t)
+		}
+		return nil
+	})
+	s.lock.RUnlock()
+	candidates := make(task.TaskByKarma, 0, len(waiting))
+	for _, t := range waiting {
+		if !arrayFull(t, arrays, parallelism) {
+			candidates = append(candidates, t)
+		}
+	}
+	sort.Sort(candidates)
+
+	s.runningLock.Lock()
+	defer s.runningLock.Unlock()
+	for _, r := range s.running {
+		if r.preempted { // wait for the room already asked
+			return false
+		}
+	}
+
+	for _, candidate := range candidates {
+		victims := make([]*running, 0)
+		for _, r := range s.running {
+			if r.task.Preemptible && r.task.Priority < candidate.Priority {
+				victims = append(victims, r)
+			}
+		}
+		// lowest priority first, then the youngest, less work is lost
+		sort.Slice(victims, func(i, j int) bool {
+			if victims[i].task.Priority != victims[j].task.Priority {
+				return victims[i].task.Priority < victims[j].task.Priority
+			}
+			return victims[i].task.Start.After(victims[j].task.Start)
+		})
+		cpu, ram := s.resources.Free()
+		chosen := make([]*running, 0)
+		for _, victim := range victims {
+			if cpu >= candidate.CPU && ram >= candidate.RAM {
+				break
+			}
+			chosen = append(chosen, victim)
+			cpu += victim.task.CPU
+			ram += victim.task.RAM
+		}
+		if len(chosen) == 0 || cpu < candidate.CPU || ram < candidate.RAM {
+			continue
+		}
+		for _, victim := range chosen {
+			log.WithFields(log.Fields{
+				"id":       victim.task.Id,
+				"priority": victim.task.Priority,
+				"for":      candidate.Id,
+			}).Info("Preempted")
+			victim.preempted = true
+			// Wait stops the run, execTask captures its logs and removes it
+			victim.cancel()
+		}
+		return true
+	}
+	return false
+}
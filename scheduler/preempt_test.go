@@ -0,0 +1,295 @@
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/logs"
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/runner"
+	"github.com/factorysh/density/store"
+	_task "github.com/factorysh/density/task"
+	_run "github.com/factorysh/density/task/run"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreempt(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	running := waitFor(s.Pubsub, 1, func(event pubsub.Event) bool {
+		return event.Action == "Running"
+	})
+	low := &_task.Task{
+		Start:           time.Now(),
+		MaxExectionTime: 30 * time.Second,
+		Preemptible:     true,
+		Action: &_task.DummyAction{
+			Name: "Low priority",
+			Wait: 20 * time.Second,
+		},
+		CPU: 4,
+		RAM: 256,
+	}
+	_, err = s.Add(low)
+	assert.NoError(t, err)
+	running.Wait()
+
+	notPreemptible := &_task.Task{
+		Start:           time.Now(),
+		MaxExectionTime: 30 * time.Second,
+		Priority:        -1,
+		Action: &_task.DummyAction{
+			Name: "Same priority",
+			Wait: 10 * time.Millisecond,
+		},
+		CPU: 4,
+		RAM: 256,
+	}
+	_, err = s.Add(notPreemptible)
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	fromStorage, err := s.tasks.Get(low.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, _status.Running, fromStorage.Status)
+
+	done := waitFor(s.Pubsub, 1, func(event pubsub.Event) bool {
+		return event.Action == "Done"
+	})
+	urgent := &_task.Task{
+		Start:           time.Now(),
+		MaxExectionTime: 30 * time.Second,
+		Priority:        10,
+		Action: &_task.DummyAction{
+			Name: "Urgent",
+			Wait: 10 * time.Millisecond,
+		},
+		CPU: 4,
+		RAM: 256,
+	}
+	_, err = s.Add(urgent)
+	assert.NoError(t, err)
+	done.Wait()
+
+	fromStorage, err = s.tasks.Get(urgent.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, _status.Done, fromStorage.Status)
+	fromStorage, err = s.tasks.Get(notPreemptible.Id)
+	assert.NoError(t, err)
+	assert.Equal(t, _status.Waiting, fromStorage.Status)
+
+	fromStorage, err = s.tasks.Get(low.Id)
+	assert.NoError(t, err)
+	assert.NotEqual(t, _status.Canceled, fromStorage.Status)
+	assert.True(t, len(fromStorage.Runs) >= 1)
+	preempted := 0
+	for _, run := range fromStorage.Runs {
+		if run.Preempted {
+			preempted++
+		}
+	}
+	assert.Equal(t, 1, preempted)
+}
+
+// orderRun records the calls of the scheduler on a run
+type orderRun struct {
+	task  *_task.Task
+	lock  *sync.Mutex
+	calls *[]string
+}
+
+func (r *orderRun) record(call string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	*r.calls = append(*r.calls, r.task.Action.(*_task.DummyAction).Name+" "+call)
+}
+
+func (r *orderRun) Down() error {
+	r.record("down")
+	return nil
+}
+
+func (r *orderRun) Wait(ctx context.Context) (_status.Status, error) {
+	if r.task.Preemptible {
+		<-ctx.Done()
+		r.record("killed")
+		return _status.Canceled, nil
+	}
+	return _status.Done, nil
+}
+
+func (r *orderRun) Logs(ctx context.Context, follow bool, sink func(_run.Line) error) error {
+	r.record("logs")
+	return nil
+}
+
+func (r *orderRun) RunnerID() (string, error)         { return "", nil }
+func (r *orderRun) RegisteredName() string            { return "order" }
+func (r *orderRun) Status() (_run.Status, int, error) { return _run.Running, 0, nil }
+func (r *orderRun) Data() _run.Data                   { return _run.Data{} }
+
+func init() {
+	_task.RunRegistry["order"] = func() _run.Run {
+		return &orderRun{}
+	}
+}
+
+type orderRunner struct {
+	lock  sync.Mutex
+	calls []string
+}
+
+func (o *orderRunner) Up(t *_task.Task) (_run.Run, error) {
+	return &orderRun{task: t, lock: &o.lock, calls: &o.calls}, nil
+}
+
+func (o *orderRunner) GetHome() string { return "" }
+
+func TestPreemptLogs(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	runner := &orderRunner{}
+	s, err := New(NewResources(1, 1024), runner, store.NewMemoryStore())
+	assert.NoError(t, err)
+	s.Logs = logs.New(dir)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	running := waitFor(s.Pubsub, 1, func(event pubsub.Event) bool {
+		return event.Action == "Running"
+	})
+	low := &_task.Task{
+		Start:           time.Now(),
+		MaxExectionTime: 30 * time.Second,
+		Preemptible:     true,
+		Action:          &_task.DummyAction{Name: "low"},
+		CPU:             1,
+		RAM:             64,
+	}
+	_, err = s.Add(low)
+	assert.NoError(t, err)
+	running.Wait()
+
+	preempted := waitFor(s.Pubsub, 1, func(event pubsub.Event) bool {
+		return event.Id == low.Id && event.Action == "Waiting"
+	})
+	_, err = s.Add(&_task.Task{
+		Start:           time.Now(),
+		MaxExectionTime: 30 * time.Second,
+		Priority:        10,
+		Action:          &_task.DummyAction{Name: "urgent"},
+		CPU:             1,
+		RAM:             64,
+	})
+	assert.NoError(t, err)
+	preempted.Wait()
+
+	runner.lock.Lock()
+	defer runner.lock.Unlock()
+	calls := make([]string, 0)
+	for _, call := range runner.calls {
+		if strings.HasPrefix(call, "low") {
+			calls = append(calls, call)
+		}
+	}
+	// the logs are captured before the run is removed
+	assert.Equal(t, []string{"low killed", "low logs", "low down"}, calls[:3])
+}
+
+// preempt and execTask lock in the same order, they don't deadlock outside the loop
+func TestPreemptConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := New(NewResources(1, 1024), &orderRunner{}, store.NewMemoryStore())
+	assert.NoError(t, err)
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 200; i++ {
+			tsk := &_task.Task{
+				Id:              uuid.New(),
+				Start:           time.Now(),
+				MaxExectionTime: time.Second,
+				Action:          &_task.DummyAction{Name: "quick"},
+				CPU:             1,
+				RAM:             64,
+				Status:          _status.Running,
+			}
+			s.execTask(tsk)
+		}
+		done <- true
+	}()
+	go func() {
+		for i := 0; i < 200; i++ {
+			s.preempt()
+		}
+		done <- true
+	}()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("deadlock")
+		}
+	}
+}
+
+func TestPreemptArrayFull(t *testing.T) {
+	s, err := New(NewResources(4, 16*1024), nil, store.NewMemoryStore())
+	assert.NoError(t, err)
+	release := s.resources.Consume(4, 256)
+	defer release()
+
+	parent := &_task.Task{
+		Id:     uuid.New(),
+		Status: _status.Running,
+		Array:  &_task.Array{Start: 1, End: 2, Parallelism: 1},
+	}
+	assert.NoError(t, s.tasks.Put(parent))
+	for _, st := range []_status.Status{_status.Running, _status.Waiting} {
+		assert.NoError(t, s.tasks.Put(&_task.Task{
+			Id:       uuid.New(),
+			Start:    time.Now().Add(-time.Second),
+			Status:   st,
+			Parent:   parent.Id,
+			Priority: 10,
+			Action:   &_task.DummyAction{Name: "Child"},
+			CPU:      4,
+			RAM:      256,
+		}))
+	}
+	low := &_task.Task{
+		Id:          uuid.New(),
+		Status:      _status.Running,
+		Preemptible: true,
+		Action:      &_task.DummyAction{Name: "Low priority"},
+		CPU:         4,
+		RAM:         256,
+	}
+	canceled := false
+	s.watch(low, func() { canceled = true })
+
+	// the waiting child can't start, its array is full
+	assert.False(t, s.preempt())
+	assert.False(t, canceled)
+
+	parent.Array.Parallelism = 2
+	assert.NoError(t, s.tasks.Put(parent))
+	assert.True(t, s.preempt())
+	assert.True(t, canceled)
+}
@@ -0,0 +1,174 @@
+package scheduler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/factorysh/density/selector"
+	"github.com/factorysh/density/task"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/google/uuid"
+)
+
+// Sort keys of a Query
+var sortKeys = map[string]func(t *task.Task) int64{
+	"start":  func(t *task.Task) int64 { return timeKey(t.Start) },
+	"mtime":  func(t *task.Task) int64 { return timeKey(t.Mtime) },
+	"status": func(t *task.Task) int64 { return int64(t.Status) },
+}
+
+func timeKey(t time.Time) int64 {
+	if t.IsZero() {
+		return math.MinInt64
+	}
+	return t.UnixNano()
+}
+
+// Query selects a page of tasks
+type Query struct {
+	Owner       string   // All owners if empty
+	Owners      []string // One of these owners, all owners if empty
+	Labels      map[string]string
+	Selector    selector.Selector
+	Statuses    map[_status.Status]bool // All statuses if empty
+	StartAfter  time.Time
+	StartBefore time.Time
+	Sort        string // start, mtime or status, with a `-` prefix for descending order
+	Limit       int    // No limit if 0
+	Cursor      string // From the previous page
+}
+
+// cursor is the position after the last task of a page
+type cursor struct {
+	Key int64     `json:"k"`
+	Id  uuid.UUID `json:"id"`
+}
+
+func (c *cursor) String() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func parseCursor(raw string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errors.New("Bad cursor")
+	}
+	var c cursor
+	err = json.Unmarshal(b, &c)
+	if err != nil {
+		return nil, errors.New("Bad cursor")
+	}
+	return &c, nil
+}
+
+// Match returns true if the task is selected, regardless of pagination
+func (q *Query) Match(t *task.Task) bool {
+	if q.Owner != "" && t.Owner != q.Owner {
+		return false
+	}
+	if len(q.Owners) > 0 && !contains(q.Owners, t.Owner) {
+		return false
+	}
+	for key, value := range q.Labels {
+		taskValue, found := t.Labels[key]
+		if !found || taskValue != value {
+			return false
+		}
+	}
+	if !q.Selector.Matches(t.Labels) {
+		return false
+	}
+	if len(q.Statuses) > 0 && !q.Statuses[t.Status] {
+		return false
+	}
+	if !q.StartAfter.IsZero() && !t.Start.After(q.StartAfter) {
+		return false
+	}
+	if !q.StartBefore.IsZero() && !t.Start.Before(q.StartBefore) {
+		return false
+	}
+	return true
+}
+
+// Query tasks, sorted, and paginated. The cursor of the next page is empty for the last page.
+// Tasks are sorted with the index of the store, they are read until the page is full.
+func (s *Scheduler) Query(q *Query) ([]*task.Task, string, error) {
+	name := strings.TrimPrefix(q.Sort, "-")
+	if name == "" {
+		name = "start"
+	}
+	if _, ok := sortKeys[name]; !ok {
+		return nil, "", fmt.Errorf("Unknown sort: %s", q.Sort)
+	}
+	desc := strings.HasPrefix(q.Sort, "-")
+	// before returns true if a is before b, in the chosen order
+	before := func(a, b *cursor) bool {
+		if a.Key != b.Key {
+			return (a.Key < b.Key) != desc
+		}
+		if a.Id == b.Id {
+			return false
+		}
+		return (a.Id.String() < b.Id.String()) != desc
+	}
+	var after *cursor
+	if q.Cursor != "" {
+		var err error
+		after, err = parseCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	positions, err := s.tasks.positions(name)
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return before(positions[i], positions[j])
+	})
+	start := 0
+	if after != nil {
+		start = sort.Search(len(positions), func(i int) bool {
+			return before(after, positions[i])
+		})
+	}
+	tasks := make([]*task.Task, 0)
+	var last *cursor
+	next := ""
+	for _, position := range positions[start:] {
+		t, err := s.tasks.Get(position.Id)
+		if err != nil {
+			return nil, "", err
+		}
+		if t == nil || !q.Match(t) {
+			continue
+		}
+		if q.Limit > 0 && len(tasks) == q.Limit {
+			// another task matches, after the page
+			next = last.String()
+			break
+		}
+		tasks = append(tasks, t)
+		last = position
+	}
+	return tasks, next, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
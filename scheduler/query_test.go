@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/runner"
+	"github.com/factorysh/density/store"
+	_task "github.com/factorysh/density/task"
+	_status "github.com/factorysh/density/task/status"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuery(t *testing.T) {
+	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	later := time.Now().Add(time.Hour)
+	for i := 0; i < 5; i++ {
+		owner := "bob"
+		if i == 4 {
+			owner = "alice"
+		}
+		_, err = s.Add(&_task.Task{
+			Owner:           owner,
+			Start:           later.Add(time.Duration(i) * time.Minute),
+			MaxExectionTime: time.Minute,
+			Action:          &_task.DummyAction{Name: "Later"},
+			CPU:             1,
+			RAM:             64,
+		})
+		assert.NoError(t, err)
+	}
+
+	q := &Query{Owner: "bob", Limit: 3}
+	page, next, err := s.Query(q)
+	assert.NoError(t, err)
+	assert.Len(t, page, 3)
+	assert.NotEqual(t, "", next)
+	assert.True(t, page[0].Start.Before(page[1].Start))
+
+	q.Cursor = next
+	page2, next, err := s.Query(q)
+	assert.NoError(t, err)
+	assert.Len(t, page2, 1)
+	assert.Equal(t, "", next)
+	assert.True(t, page2[0].Start.After(page[2].Start))
+
+	page, _, err = s.Query(&Query{Sort: "-start", StartAfter: later.Add(90 * time.Second)})
+	assert.NoError(t, err)
+	assert.Len(t, page, 3)
+	assert.Equal(t, "alice", page[0].Owner)
+
+	page, _, err = s.Query(&Query{Owners: []string{"alice", "carol"}})
+	assert.NoError(t, err)
+	assert.Len(t, page, 1)
+
+	page, _, err = s.Query(&Query{Statuses: map[_status.Status]bool{_status.Running: true}})
+	assert.NoError(t, err)
+	assert.Len(t, page, 0)
+
+	_, _, err = s.Query(&Query{Sort: "plop"})
+	assert.Error(t, err)
+	_, _, err = s.Query(&Query{Cursor: "plop"})
+	assert.Error(t, err)
+}
+
+// countingStore counts the tasks read
+type countingStore struct {
+	store.Store
+	gets int
+}
+
+func (c *countingStore) Get(k []byte) ([]byte, error) {
+	c.gets++
+	return c.Store.Get(k)
+}
+
+func TestQueryIndex(t *testing.T) {
+	counting := &countingStore{Store: store.NewMemoryStore()}
+	s := &Scheduler{tasks: &JSONStore{store: counting}}
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		err := s.tasks.Put(&_task.Task{
+			Id:    uuid.New(),
+			Owner: "bob",
+			Start: start.Add(time.Duration(i) * time.Minute),
+		})
+		assert.NoError(t, err)
+	}
+	pages := 0
+	q := &Query{Limit: 10}
+	var previous *_task.Task
+	for {
+		page, next, err := s.Query(q)
+		assert.NoError(t, err)
+		for _, task := range page {
+			if previous != nil {
+				assert.True(t, previous.Start.Before(task.Start))
+			}
+			previous = task
+		}
+		pages++
+		if next == "" {
+			break
+		}
+		q.Cursor = next
+	}
+	assert.Equal(t, 10, pages)
+	assert.Equal(t, 100+9, counting.gets, "only the pages, and the next task, are read")
+
+	// the index follows the writes
+	first, _, err := s.Query(&Query{Limit: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, s.tasks.Delete(first[0].Id))
+	second, _, err := s.Query(&Query{Limit: 1})
+	assert.NoError(t, err)
+	assert.True(t, second[0].Start.After(first[0].Start))
+	second[0].Start = start.Add(-time.Hour)
+	assert.NoError(t, s.tasks.Put(second[0]))
+	page, _, err := s.Query(&Query{Limit: 1, Sort: "-start"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, second[0].Id, page[0].Id)
+	page, _, err = s.Query(&Query{Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, second[0].Id, page[0].Id)
+}
@@ -1,8 +1,6 @@
 package scheduler
 
 import (
-	"context"
-	"errors"
 	"sync"
 )
 
@@ -28,36 +26,37 @@ func NewResources(cpu, ram int) *Resources {
 
 func (r *Resources) Check(cpu, ram int) error {
 	if cpu <= 0 {
-		return errors.New("CPU must be > 0")
+		return &InvalidTaskError{Field: "cpu", Message: "CPU must be > 0"}
 	}
 	if cpu > r.TotalCPU {
-		return errors.New("Too much CPU is required")
+		return &InvalidTaskError{Field: "cpu", Message: "Too much CPU is required"}
 	}
 	if ram <= 0 {
-		return errors.New("RAM must be > 0")
+		return &InvalidTaskError{Field: "ram", Message: "RAM must be > 0"}
 	}
 	if ram > r.TotalRAM {
-		return errors.New("Too much RAM is required")
+		return &InvalidTaskError{Field: "ram", Message: "Too much RAM is required"}
 	}
 	return nil
 }
 
-func (r *Resources) Consume(ctx context.Context, cpu, ram int) {
+// Consume resources, until the returned release function is called
+func (r *Resources) Consume(cpu, ram int) func() {
 	r.lock.Lock()
 	r.cpu -= cpu
 	r.ram -= ram
 	r.processes++
 	r.lock.Unlock()
-	go func() {
-		select {
-		case <-ctx.Done():
+	once := &sync.Once{}
+	return func() {
+		once.Do(func() {
 			r.lock.Lock()
 			r.cpu += cpu
 			r.ram += ram
 			r.processes--
 			r.lock.Unlock()
-		}
-	}()
+		})
+	}
 }
 
 func (r *Resources) IsDoable(cpu, ram int) bool {
@@ -65,3 +64,17 @@ func (r *Resources) IsDoable(cpu, ram int) bool {
 	defer r.lock.RUnlock()
 	return cpu <= r.cpu && ram <= r.ram
 }
+
+// Free returns available CPU and RAM
+func (r *Resources) Free() (int, int) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cpu, r.ram
+}
+
+// Processes returns the number of running processes
+func (r *Resources) Processes() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.processes
+}
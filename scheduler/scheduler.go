@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/factorysh/density/logs"
 	"github.com/factorysh/density/pubsub"
 	_store "github.com/factorysh/density/store"
 	"github.com/factorysh/density/task"
@@ -28,6 +29,10 @@ type Scheduler struct {
 	Pubsub               *pubsub.PubSub
 	stopping             *sync.WaitGroup
 	started              bool
+	Blackouts            *Blackouts
+	Logs                 *logs.Store // Logs of the runs are captured, if not nil
+	running              map[uuid.UUID]*running
+	runningLock          sync.Mutex
 }
 
 type Runner interface {
@@ -35,17 +40,38 @@ type Runner interface {
 	GetHome() string
 }
 
-func New(resources *Resources, runner Runner, store _store.Store) *Scheduler {
+// New scheduler, with its tasks, blackouts and events journal in the store
+func New(resources *Resources, runner Runner, store _store.Store) (*Scheduler, error) {
+	bucket, err := store.Bucket("blackouts")
+	if err != nil {
+		return nil, err
+	}
+	blackouts, err := NewBlackouts(bucket)
+	if err != nil {
+		return nil, fmt.Errorf("Can't load blackouts: %w", err)
+	}
+	bucket, err = store.Bucket("journal")
+	if err != nil {
+		return nil, err
+	}
+	journal, err := pubsub.NewJournal(bucket, pubsub.DefaultJournalSize)
+	if err != nil {
+		return nil, fmt.Errorf("Can't load the events journal: %w", err)
+	}
+	ps := pubsub.NewPubSub()
+	ps.UseJournal(journal)
 	return &Scheduler{
 		resources:            resources,
-		tasks:                &JSONStore{store},
+		tasks:                &JSONStore{store: store},
 		somethingNewHappened: todo.New(),
 		stop:                 make(chan bool),
 		runner:               runner,
-		Pubsub:               pubsub.NewPubSub(),
+		Pubsub:               ps,
 		stopping:             &sync.WaitGroup{},
 		started:              false,
-	}
+		Blackouts:            blackouts,
+		running:              make(map[uuid.UUID]*running),
+	}, nil
 }
 
 // Add a new task
@@ -54,14 +80,23 @@ func (s *Scheduler) Add(task *task.Task) (uuid.UUID, error) {
 		return uuid.Nil, errors.New("Scheduler is not started")
 	}
 	if task.Id != uuid.Nil {
-		return uuid.Nil, errors.New("don't choose your UUID, it's my job")
+		return uuid.Nil, &InvalidTaskError{Field: "id", Message: "don't choose your UUID, it's my job"}
 	}
 	err := s.resources.Check(task.CPU, task.RAM)
 	if err != nil {
 		return uuid.Nil, err
 	}
 	if task.MaxExectionTime <= 0 {
-		return uuid.Nil, errors.New("MaxExectionTime must be > 0")
+		return uuid.Nil, &InvalidTaskError{Field: "max_execution_time", Message: "MaxExectionTime must be > 0"}
+	}
+	if task.Array != nil {
+		err = task.Array.Validate()
+		if err != nil {
+			return uuid.Nil, &InvalidTaskError{Field: "array", Message: err.Error()}
+		}
+		if task.HasCron() {
+			return uuid.Nil, &InvalidTaskError{Field: "array", Message: "An array task can't be periodic"}
+		}
 	}
 	id, err := uuid.NewRandom()
 	if err != nil {
@@ -75,13 +110,19 @@ func (s *Scheduler) Add(task *task.Task) (uuid.UUID, error) {
 		return uuid.Nil, err
 	}
 	task.Cancel = func() {
-		task.Status = _status.Canceled
+		task.SetStatus(_status.Canceled, "canceled")
 	}
+	if task.Array != nil {
+		err = s.addChildren(task)
+		if err != nil {
+			if err := s.tasks.Delete(task.Id); err != nil {
+				log.WithError(err).WithField("id", task.Id).Error("Can't remove array task")
+			}
+			return uuid.Nil, err
+		}
+	}
+	s.publish("added", task, "")
 	s.somethingNewHappened.Ping()
-	s.Pubsub.Publish(pubsub.Event{
-		Action: "added",
-		Id:     id,
-	})
 	return id, nil
 }
 
@@ -96,6 +137,10 @@ func (s *Scheduler) Load() error {
 	update := make([]*task.Task, 0)
 
 	err := s.tasks.ForEach(func(t *task.Task) error {
+		// array tasks never run, their status comes from their children
+		if t.Array != nil {
+			return nil
+		}
 		// remember old status
 		old := t.Status
 		// fresh status
@@ -139,10 +184,10 @@ func (s *Scheduler) Load() error {
 
 		// if status mismatch, update
 		if old != fresh {
-			t.Status = fresh
+			t.SetStatus(fresh, "reloaded")
 			update = append(update, t)
 		} else if t.HasCron() && t.Status != _status.Running {
-			t.Status = _status.Waiting
+			t.SetStatus(_status.Waiting, "rescheduled")
 			t.PrepareReschedule()
 			update = append(update, t)
 		}
@@ -211,17 +256,20 @@ func (s *Scheduler) Start(ctx context.Context) {
 
 func (s *Scheduler) oneLoop() {
 	s.somethingNewHappened.Done()
+	s.skipBlackedOut()
 	todos := s.readyToGo()
 	if len(todos) > 0 { // Something todo
 		s.execTask(todos[0])
 		s.somethingNewHappened.Ping() // is there any // tasks waiting?
 		return
 	}
+	// no room, an urgent task can stop less important ones
+	s.preempt()
 	// nothing is ready just wait
 	now := time.Now()
 	n := s.next()
-	if n != nil {
-		sleep := n.Start.Sub(now)
+	if !n.IsZero() {
+		sleep := n.Sub(now)
 		time.AfterFunc(sleep, func() {
 			s.somethingNewHappened.Ping()
 		})
@@ -231,58 +279,86 @@ func (s *Scheduler) oneLoop() {
 // Exec chosen task
 func (s *Scheduler) execTask(chosen *task.Task) {
 	s.lock.Lock()
-	ctxResources, cancelResources := context.WithCancel(context.TODO())
-	s.resources.Consume(ctxResources, chosen.CPU, chosen.RAM)
+	// the task may have been updated or canceled since it was chosen
+	if chosen.Status == _status.Waiting {
+		fresh, err := s.tasks.Get(chosen.Id)
+		if err != nil || fresh == nil || fresh.Revision != chosen.Revision || fresh.Status != _status.Waiting {
+			s.lock.Unlock()
+			return
+		}
+	}
+	release := s.resources.Consume(chosen.CPU, chosen.RAM)
+	cpu, ram := s.resources.Free()
 	log.WithFields(log.Fields{
-		"cpu":     s.resources.cpu,
-		"ram":     s.resources.ram,
-		"process": s.resources.processes,
+		"cpu":     cpu,
+		"ram":     ram,
+		"process": s.resources.Processes(),
 	}).Info()
 	run, err := s.runner.Up(chosen)
 	// save the run to task runs history (latest first)
 	chosen.AddRunToHistory(run)
+	from := chosen.Status
 	if err != nil {
-		chosen.Status = _status.Error
-		cancelResources()
+		chosen.SetStatus(_status.Error, err.Error())
+		release()
 		log.WithError(err).Error()
 		s.tasks.Put(chosen)
+		s.publishTransition(chosen, from, err.Error())
 		s.lock.Unlock()
 		return
 	}
-	chosen.Status = _status.Running
+	chosen.SetStatus(_status.Running, "started")
 	chosen.Start = time.Now()
 	chosen.Run = run
 	s.tasks.Put(chosen)
 
 	ctx, cancel := context.WithTimeout(context.TODO(), chosen.MaxExectionTime)
 
-	cleanup := func() {
-		cancel()
-		cancelResources()
-	}
-	s.Pubsub.Publish(pubsub.Event{
-		Action: chosen.Status.String(),
-		Id:     chosen.Id,
-	})
+	s.watch(chosen, cancel)
+	s.publishTransition(chosen, from, "started")
 	s.lock.Unlock()
-	go func(ctx context.Context, task *task.Task, run _run.Run, cleanup func()) {
-		defer cleanup()
+	if chosen.Parent != uuid.Nil {
+		s.aggregate(chosen.Parent)
+	}
+	go func(ctx context.Context, task *task.Task, run _run.Run) {
 		status, err := run.Wait(ctx)
 		if err != nil {
 			log.WithError(err).Error()
 		}
-		task.Status = status
-		if task.HasCron() {
-			task.Status = _status.Waiting
-			task.PrepareReschedule()
+		s.finish(task.Id)
+		cancel()
+		s.captureLogs(task, run)
+		// released once the logs are captured, a preempted task is then quickly back in the queue
+		release()
+		if s.unwatch(task.Id) {
+			// the run is removed after its logs are captured
+			err = run.Down()
+			if err != nil {
+				log.WithError(err).WithField("id", task.Id).Error("Down")
+			}
+			// back in the queue, this run is not a failure
+			task.SetStatus(_status.Waiting, "preempted")
+			task.Preempted()
+			s.tasks.Put(task)
+			s.publishTransition(task, _status.Running, "preempted")
+		} else {
+			reason := finished(status, run)
+			task.SetStatus(status, reason)
+			s.tasks.Put(task)
+			s.publishTransition(task, _status.Running, reason)
+			if task.HasCron() {
+				from := task.Status
+				task.SetStatus(_status.Waiting, "rescheduled")
+				task.PrepareReschedule()
+				s.tasks.Put(task)
+				s.publishTransition(task, from, "rescheduled")
+			}
+		}
+		if task.Parent != uuid.Nil {
+			s.aggregate(task.Parent)
 		}
-		s.tasks.Put(task)
-		s.Pubsub.Publish(pubsub.Event{
-			Action: task.Status.String(),
-			Id:     task.Id,
-		})
 		s.somethingNewHappened.Ping() // a slot is now free, let's try to full it
-	}(ctx, chosen, run, cleanup)
+	}(ctx, chosen, run)
 }
 
 // List all the tasks associated with this scheduler
@@ -297,64 +373,107 @@ func (s *Scheduler) List() []*task.Task {
 	return tasks
 }
 
-// Filter tasks for a specific owner
-func (s *Scheduler) Filter(owner string, labels map[string]string) []*task.Task {
-	tasks := make([]*task.Task, 0)
-
+func (s *Scheduler) readyToGo() []*task.Task {
+	now := time.Now()
+	tasks := make(task.TaskByKarma, 0)
 	s.lock.RLock()
 	defer s.lock.RUnlock()
-
-	s.tasks.ForEach(func(t *task.Task) error {
-		if owner != "" && t.Owner != owner {
+	running, parallelism := s.arrayRunning()
+	// the same free resources for every task, a release during the loop doesn't favor the last ones
+	cpu, ram := s.resources.Free()
+	s.tasks.ForEach(func(task *task.Task) error {
+		if task.Array != nil {
 			return nil
 		}
-		for key, value := range labels {
-			taskValue, found := t.Labels[key]
-			if !found || taskValue != value {
-				return nil
-			}
+		// not too many running children for an array
+		if arrayFull(task, running, parallelism) {
+			return nil
+		}
+		// enough CPU, enough RAM, Start date is okay, no blackout
+		if task.Start.Before(now) && task.Status == _status.Waiting && !task.Paused && task.CPU <= cpu && task.RAM <= ram &&
+			s.Blackouts.Until(task, now).IsZero() {
+			tasks = append(tasks, task)
 		}
-		tasks = append(tasks, t)
 		return nil
 	})
-
+	sort.Sort(tasks)
 	return tasks
 }
 
-func (s *Scheduler) readyToGo() []*task.Task {
+// next returns when the next waiting task may start, blackouts included. Zero time means no future.
+func (s *Scheduler) next() time.Time {
+	var next time.Time
+	if s.tasks.Length() == 0 {
+		return next
+	}
 	now := time.Now()
-	tasks := make(task.TaskByKarma, 0)
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 	s.tasks.ForEach(func(task *task.Task) error {
-		// enough CPU, enough RAM, Start date is okay
-		if task.Start.Before(now) && task.Status == _status.Waiting && s.resources.IsDoable(task.CPU, task.RAM) {
-			tasks = append(tasks, task)
+		if task.Status != _status.Waiting || task.Array != nil || task.Paused {
+			return nil
+		}
+		start := task.Start
+		if start.Before(now) {
+			start = now
+		}
+		until := s.Blackouts.Until(task, start)
+		if !until.IsZero() {
+			start = until
+		}
+		if next.IsZero() || start.Before(next) {
+			next = start
 		}
 		return nil
 	})
-	sort.Sort(tasks)
-	return tasks
+	return next
 }
 
-func (s *Scheduler) next() *task.Task {
-	if s.tasks.Length() == 0 {
-		return nil
-	}
+// skipBlackedOut reschedules periodic tasks whose occurrence falls inside a blackout,
+// unless they want to catch up when it ends
+func (s *Scheduler) skipBlackedOut() {
+	now := time.Now()
+	skipped := make([]*task.Task, 0)
 	s.lock.RLock()
-	defer s.lock.RUnlock()
-	tasks := make(task.TaskByStart, 0)
 	s.tasks.ForEach(func(task *task.Task) error {
-		if task.Status == _status.Waiting {
-			tasks = append(tasks, task)
+		if task.Status != _status.Waiting || !task.HasCron() || task.CatchUp || task.Start.After(now) {
+			return nil
+		}
+		until := s.Blackouts.Until(task, now)
+		if !until.IsZero() {
+			task.SkipUntil(until)
+			skipped = append(skipped, task)
 		}
 		return nil
 	})
-	if len(tasks) == 0 {
-		return nil
+	s.lock.RUnlock()
+	for _, task := range skipped {
+		log.WithField("id", task.Id).WithField("start", task.Start).Info("Occurrence skipped by a blackout")
+		err := s.tasks.Put(task)
+		if err != nil {
+			log.WithError(err).Error()
+		}
 	}
-	sort.Sort(tasks)
-	return tasks[0]
+}
+
+// AddBlackout declares a new blackout
+func (s *Scheduler) AddBlackout(blackout *Blackout) error {
+	err := s.Blackouts.Put(blackout)
+	if err != nil {
+		return err
+	}
+	s.somethingNewHappened.Ping()
+	return nil
+}
+
+// DeleteBlackout removes a blackout, waiting tasks may start now
+func (s *Scheduler) DeleteBlackout(id uuid.UUID) error {
+	err := s.Blackouts.Delete(id)
+	if err != nil {
+		return err
+	}
+	s.somethingNewHappened.Ping()
+	return nil
 }
 
 func (s *Scheduler) GetTask(id uuid.UUID) (*task.Task, error) {
@@ -369,7 +488,7 @@ func (s *Scheduler) Cancel(id uuid.UUID) error {
 	}
 
 	if task == nil {
-		return errors.New("Unknown id")
+		return fmt.Errorf("%w: %s", ErrUnknownTask, id.String())
 	}
 
 	if task.Status == _status.Canceled {
@@ -382,17 +501,113 @@ func (s *Scheduler) Cancel(id uuid.UUID) error {
 		if task.Run != nil {
 			task.Run.Down()
 		}
-		task.Status = _status.Canceled
+		task.SetStatus(_status.Canceled, "canceled")
 	}
 
+	from := task.Status
 	if task.Status == _status.Running {
 		task.Cancel()
+	} else if task.Status == _status.Waiting {
+		task.SetStatus(_status.Canceled, "canceled")
 	}
 	task.Mtime = time.Now()
-	return s.tasks.Put(task)
+	err = s.tasks.Put(task)
+	if err != nil {
+		return err
+	}
+	if from != task.Status {
+		s.publishTransition(task, from, "canceled")
+	}
+	if task.Array != nil {
+		for _, child := range s.Children(id) {
+			err = s.Cancel(child.Id)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if task.Parent != uuid.Nil {
+		s.aggregate(task.Parent)
+	}
+	return nil
+}
+
+// ErrUnknownTask is returned when a task id doesn't exist
+var ErrUnknownTask = errors.New("Unknown task")
+
+// InvalidTaskError is a task rejected by the scheduler, Field is its JSON name
+type InvalidTaskError struct {
+	Field   string
+	Message string
+}
+
+func (e *InvalidTaskError) Error() string {
+	return e.Message
 }
 
-// Delete a task
+// ErrConflict is returned when updating a task modified since it was read
+var ErrConflict = errors.New("Task has been modified")
+
+// ErrNotWaiting is returned when updating a task already started
+var ErrNotWaiting = errors.New("Only a waiting task can be updated")
+
+// Update a waiting task, read at this revision.
+// Identity, owner, status and history of the task are kept.
+func (s *Scheduler) Update(id uuid.UUID, revision int, t *task.Task) error {
+	err := s.resources.Check(t.CPU, t.RAM)
+	if err != nil {
+		return err
+	}
+	if t.MaxExectionTime <= 0 {
+		return &InvalidTaskError{Field: "max_execution_time", Message: "MaxExectionTime must be > 0"}
+	}
+	if t.Every != 0 && t.Cron != "" {
+		return &InvalidTaskError{Field: "cron", Message: "cron and every options are mutually exclusive"}
+	}
+	if t.Array != nil {
+		return &InvalidTaskError{Field: "array", Message: "An array spec can't be updated"}
+	}
+	s.lock.Lock()
+	old, err := s.tasks.Get(id)
+	if err != nil {
+		s.lock.Unlock()
+		return err
+	}
+	if old == nil {
+		s.lock.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownTask, id.String())
+	}
+	if old.Revision != revision {
+		s.lock.Unlock()
+		return ErrConflict
+	}
+	if old.Status != _status.Waiting || old.Array != nil {
+		s.lock.Unlock()
+		return ErrNotWaiting
+	}
+	t.Id = old.Id
+	t.Owner = old.Owner
+	t.Status = old.Status
+	t.Revision = old.Revision
+	t.Parent = old.Parent
+	t.ArrayIndex = old.ArrayIndex
+	t.Parameters = old.Parameters
+	t.Run = old.Run
+	t.RunCounter = old.RunCounter
+	t.Runs = old.Runs
+	t.History = old.History
+	t.Paused = old.Paused
+	err = s.tasks.Put(t)
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+	s.somethingNewHappened.Ping()
+	s.publish("updated", t, "")
+	return nil
+}
+
+// Delete a task, the status of its array is aggregated again
 func (s *Scheduler) Delete(id uuid.UUID) error {
 	task, err := s.tasks.Get(id)
 	if err != nil {
@@ -400,14 +615,36 @@ func (s *Scheduler) Delete(id uuid.UUID) error {
 	}
 
 	if task == nil {
-		return fmt.Errorf("unknown id %s", id.String())
+		return fmt.Errorf("%w: %s", ErrUnknownTask, id.String())
 	}
 
+	err = s.delete(task)
+	if err != nil {
+		return err
+	}
+	if task.Parent != uuid.Nil {
+		s.aggregate(task.Parent)
+	}
+	return nil
+}
+
+// delete a task, with the children of an array
+func (s *Scheduler) delete(task *task.Task) error {
 	if task.Status == _status.Running && task.Run != nil {
 		task.Run.Down()
 	}
 
-	return s.tasks.Delete(id)
+	if task.Array != nil {
+		for _, child := range s.Children(task.Id) {
+			err := s.delete(child)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	s.deleteLogs(task)
+	return s.tasks.Delete(task.Id)
 }
 
 // Length returns the number of Task
@@ -421,6 +658,7 @@ func (s *Scheduler) Flush(age time.Duration) int {
 	i := 0
 	s.tasks.DeleteWithClause(func(task *task.Task) bool {
 		if task.Status != _status.Running && task.Status != _status.Waiting && now.Sub(task.Mtime) > age {
+			s.deleteLogs(task)
 			i++
 			return true
 		}
@@ -430,6 +668,11 @@ func (s *Scheduler) Flush(age time.Duration) int {
 	return i
 }
 
+// Bucket is a namespace in the store of this scheduler
+func (s *Scheduler) Bucket(name string) (_store.Store, error) {
+	return s.tasks.store.Bucket(name)
+}
+
 // GetDataDir will return data dir for current runner
 func (s *Scheduler) GetDataDir() string {
 	return s.runner.GetHome()
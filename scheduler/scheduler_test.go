@@ -26,10 +26,11 @@ func waitFor(ps *pubsub.PubSub, size int, clause func(evt pubsub.Event) bool) *s
 	wait := &sync.WaitGroup{}
 	wait.Add(size)
 
-	go func(ps *pubsub.PubSub, size int, clause func(evt pubsub.Event) bool) {
-		ctx, cancel := context.WithCancel(context.TODO())
+	// subscribe now, a fast task may be done before the goroutine starts
+	ctx, cancel := context.WithCancel(context.TODO())
+	events := ps.SubscribeWithPolicy(ctx, pubsub.Block)
+	go func(size int, clause func(evt pubsub.Event) bool) {
 		defer cancel()
-		events := ps.Subscribe(ctx)
 		for {
 			event := <-events
 			if clause(event) {
@@ -43,7 +44,7 @@ func waitFor(ps *pubsub.PubSub, size int, clause func(evt pubsub.Event) bool) *s
 				fmt.Println("Just an event ", event)
 			}
 		}
-	}(ps, size, clause)
+	}(size, clause)
 	return wait
 }
 
@@ -58,7 +59,7 @@ func TestWaitFor(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		go func() {
 			ctx, cancel := context.WithCancel(context.TODO())
-			s := ps.Subscribe(ctx)
+			s := ps.SubscribeWithPolicy(ctx, pubsub.Block)
 			wgSub.Done()
 			for j := 0; j < n; j++ {
 				time.Sleep(time.Duration(rand.Float64()*10) * time.Millisecond)
@@ -83,7 +84,8 @@ func TestSchedulerStartStop(t *testing.T) {
 	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
 	assert.NoError(t, err)
 	defer os.RemoveAll(dir)
-	s := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
 	ctx, cancel := context.WithCancel(context.Background())
 	s.Start(ctx)
 	assert.True(t, s.started)
@@ -96,7 +98,8 @@ func TestScheduler(t *testing.T) {
 	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
 	assert.NoError(t, err)
 	defer os.RemoveAll(dir)
-	s := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	s.Start(ctx)
@@ -123,15 +126,18 @@ func TestScheduler(t *testing.T) {
 	assert.NotEqual(t, uuid.Nil, id)
 	list := s.List()
 	assert.Len(t, list, 1)
-	filtered := s.Filter("test", nil)
+	filtered, _, err := s.Query(&Query{Owner: "test"})
+	assert.NoError(t, err)
 	assert.Len(t, filtered, 1)
 	wait.Wait()
 	assert.Len(t, s.readyToGo(), 0)
-	filtered = s.Filter("test", nil)
+	filtered, _, err = s.Query(&Query{Owner: "test"})
+	assert.NoError(t, err)
 	assert.Len(t, filtered, 1)
-	filtered = s.Filter("test", map[string]string{
+	filtered, _, err = s.Query(&Query{Owner: "test", Labels: map[string]string{
 		"key": "value",
-	})
+	}})
+	assert.NoError(t, err)
 	assert.Len(t, filtered, 1)
 
 	assert.Equal(t, _status.Done, filtered[0].Status)
@@ -180,7 +186,8 @@ func TestFlood(t *testing.T) {
 	dir, err := ioutil.TempDir(os.TempDir(), "scheduler-")
 	assert.NoError(t, err)
 	defer os.RemoveAll(dir)
-	s := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	s.Start(ctx)
@@ -208,7 +215,8 @@ func TestRunsHistory(t *testing.T) {
 	dir, err := ioutil.TempDir(os.TempDir(), "scheduler")
 	assert.NoError(t, err)
 	defer os.RemoveAll(dir)
-	s := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	s.Start(ctx)
@@ -241,7 +249,8 @@ func TestTimeout(t *testing.T) {
 	dir, err := ioutil.TempDir(os.TempDir(), "scheduler")
 	assert.NoError(t, err)
 	defer os.RemoveAll(dir)
-	s := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store.NewMemoryStore())
+	assert.NoError(t, err)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	s.Start(ctx)
@@ -320,7 +329,8 @@ x-batch:
 	defer os.RemoveAll(dir)
 	store, err := store.NewBoltStore(fmt.Sprintf("%s/bbolt.store", dir))
 	assert.NoError(t, err)
-	s := New(NewResources(4, 16*1024), runner.New(dir, nil), store)
+	s, err := New(NewResources(4, 16*1024), runner.New(dir, nil), store)
+	assert.NoError(t, err)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	s.Start(ctx)
@@ -361,7 +371,8 @@ x-batch:
 	cancel()
 	s.WaitStop()
 
-	s = New(NewResources(4, 16*1024), runner.New(dir, nil), store)
+	s, err = New(NewResources(4, 16*1024), runner.New(dir, nil), store)
+	assert.NoError(t, err)
 	// on restart, load is called to refresh state
 	err = s.Load()
 	assert.NoError(t, err)
@@ -399,7 +410,8 @@ func TestCancel(t *testing.T) {
 	dir, err := ioutil.TempDir(os.TempDir(), "scheduler")
 	assert.NoError(t, err)
 	defer os.RemoveAll(dir)
-	s := New(NewResources(4, 16*1024), runner.New(dir), store.NewMemoryStore())
+	s, err := New(NewResources(4, 16*1024), runner.New(dir), store.NewMemoryStore())
+	assert.NoError(t, err)
 	ctx, cancel := context.WithCancel(context.Background())
 	go s.Start(ctx)
 	defer cancel()
@@ -3,6 +3,7 @@ package scheduler
 import (
 	"encoding/json"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/factorysh/density/store"
@@ -10,9 +11,54 @@ import (
 	"github.com/google/uuid"
 )
 
-// JSONStore stores task.Task
+// JSONStore stores task.Task, with an index of the sort keys of Query
 type JSONStore struct {
-	store store.Store
+	store     store.Store
+	indexLock sync.Mutex
+	index     map[uuid.UUID]map[string]int64 // built by the first Query
+}
+
+func keysOf(t *task.Task) map[string]int64 {
+	keys := make(map[string]int64, len(sortKeys))
+	for name, key := range sortKeys {
+		keys[name] = key(t)
+	}
+	return keys
+}
+
+// positions of all the tasks, for a sort key, unsorted
+func (j *JSONStore) positions(name string) ([]*cursor, error) {
+	j.indexLock.Lock()
+	defer j.indexLock.Unlock()
+	if j.index == nil {
+		index := make(map[uuid.UUID]map[string]int64)
+		err := j.ForEach(func(t *task.Task) error {
+			index[t.Id] = keysOf(t)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		j.index = index
+	}
+	positions := make([]*cursor, 0, len(j.index))
+	for id, keys := range j.index {
+		positions = append(positions, &cursor{Key: keys[name], Id: id})
+	}
+	return positions, nil
+}
+
+func (j *JSONStore) indexed(id uuid.UUID, keys map[string]int64) {
+	j.indexLock.Lock()
+	defer j.indexLock.Unlock()
+	if j.index == nil {
+		return
+	}
+	if keys == nil {
+		delete(j.index, id)
+	} else {
+		j.index[id] = keys
+	}
 }
 
 // Get a Task
@@ -42,16 +88,27 @@ func (j *JSONStore) Put(t *task.Task) error {
 		return errors.New("Task wihtout id")
 	}
 	t.Mtime = time.Now()
+	t.Revision++
 	value, err := json.Marshal(t)
 	if err != nil {
 		return err
 	}
-	return j.store.Put([]byte(t.Id.String()), value)
+	err = j.store.Put([]byte(t.Id.String()), value)
+	if err != nil {
+		return err
+	}
+	j.indexed(t.Id, keysOf(t))
+	return nil
 }
 
 // Delete a task
 func (j *JSONStore) Delete(id uuid.UUID) error {
-	return j.store.Delete([]byte(id.String()))
+	err := j.store.Delete([]byte(id.String()))
+	if err != nil {
+		return err
+	}
+	j.indexed(id, nil)
+	return nil
 }
 
 // Length of the store
@@ -78,6 +135,10 @@ func (j *JSONStore) DeleteWithClause(fn func(t *task.Task) bool) error {
 		if err != nil {
 			panic(err)
 		}
-		return fn(t)
+		if !fn(t) {
+			return false
+		}
+		j.indexed(t.Id, nil)
+		return true
 	})
 }
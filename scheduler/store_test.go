@@ -19,7 +19,7 @@ func TestStore(t *testing.T) {
 	assert.NoError(t, err)
 	stores := []store.Store{store.NewMemoryStore(), b}
 	for _, s := range stores {
-		j := JSONStore{s}
+		j := JSONStore{store: s}
 		assert.Equal(t, 0, j.Length())
 		id, err := uuid.NewRandom()
 		assert.NoError(t, err)
@@ -0,0 +1,151 @@
+// Package selector parses label selectors, like Kubernetes ones :
+// `env in (prod,staging)`, `env notin (dev)`, `team=ops`, `team!=ops`, `tier`, `exists tier`, `!temporary`.
+// Requirements are separated by commas, all of them must match.
+package selector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Operator of a requirement
+type Operator string
+
+const (
+	In           Operator = "in"
+	NotIn        Operator = "notin"
+	Equals       Operator = "="
+	NotEquals    Operator = "!="
+	Exists       Operator = "exists"
+	DoesNotExist Operator = "!"
+)
+
+// Requirement on a label
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Selector is a list of requirements
+type Selector []Requirement
+
+var (
+	setRequirement    = regexp.MustCompile(`^([^\s!=(),]+)\s+(in|notin)\s*\(([^()]*)\)$`)
+	existsRequirement = regexp.MustCompile(`^(?:exists\s+)?([^\s!=(),]+)$`)
+	notRequirement    = regexp.MustCompile(`^!\s*([^\s!=(),]+)$`)
+	equalRequirement  = regexp.MustCompile(`^([^\s!=(),]+)\s*(==|=|!=)\s*([^\s!=(),]*)$`)
+)
+
+// Parse a selector, an empty selector matches everything
+func Parse(raw string) (Selector, error) {
+	selector := make(Selector, 0)
+	for _, part := range split(raw) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var r Requirement
+		if m := setRequirement.FindStringSubmatch(part); m != nil {
+			r = Requirement{Key: m[1], Operator: Operator(m[2])}
+			for _, value := range strings.Split(m[3], ",") {
+				value = strings.TrimSpace(value)
+				if value == "" {
+					return nil, fmt.Errorf("Empty value in selector: %s", part)
+				}
+				r.Values = append(r.Values, value)
+			}
+		} else if m := notRequirement.FindStringSubmatch(part); m != nil {
+			r = Requirement{Key: m[1], Operator: DoesNotExist}
+		} else if m := existsRequirement.FindStringSubmatch(part); m != nil {
+			r = Requirement{Key: m[1], Operator: Exists}
+		} else if m := equalRequirement.FindStringSubmatch(part); m != nil {
+			r = Requirement{Key: m[1], Operator: Equals, Values: []string{m[3]}}
+			if m[2] == "!=" {
+				r.Operator = NotEquals
+			}
+		} else {
+			return nil, fmt.Errorf("Bad selector requirement: %s", part)
+		}
+		selector = append(selector, r)
+	}
+	return selector, nil
+}
+
+// split on commas, outside parenthesis
+func split(raw string) []string {
+	parts := make([]string, 0)
+	depth := 0
+	start := 0
+	for i, c := range raw {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, raw[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, raw[start:])
+}
+
+// Matches returns true if the labels match all the requirements
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches returns true if the labels match the requirement
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, found := labels[r.Key]
+	switch r.Operator {
+	case Exists:
+		return found
+	case DoesNotExist:
+		return !found
+	case Equals, In:
+		return found && r.has(value)
+	case NotEquals, NotIn:
+		return !found || !r.has(value)
+	}
+	return false
+}
+
+func (r Requirement) has(value string) bool {
+	for _, v := range r.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Requirement) String() string {
+	switch r.Operator {
+	case Exists:
+		return r.Key
+	case DoesNotExist:
+		return "!" + r.Key
+	case In, NotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+	default:
+		return r.Key + string(r.Operator) + strings.Join(r.Values, "")
+	}
+}
+
+func (s Selector) String() string {
+	requirements := make([]string, len(s))
+	for i, r := range s {
+		requirements[i] = r.String()
+	}
+	return strings.Join(requirements, ",")
+}
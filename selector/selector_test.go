@@ -0,0 +1,51 @@
+package selector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse("env in (prod, staging),team!=ops, !temporary,exists tier")
+	assert.NoError(t, err)
+	assert.Len(t, s, 4)
+	assert.Equal(t, Requirement{Key: "env", Operator: In, Values: []string{"prod", "staging"}}, s[0])
+	assert.Equal(t, NotEquals, s[1].Operator)
+	assert.Equal(t, DoesNotExist, s[2].Operator)
+	assert.Equal(t, Requirement{Key: "tier", Operator: Exists}, s[3])
+	assert.Equal(t, "env in (prod,staging),team!=ops,!temporary,tier", s.String())
+
+	s, err = Parse("")
+	assert.NoError(t, err)
+	assert.Len(t, s, 0)
+
+	for _, bad := range []string{"env in prod", "env in ()", "a b c", "=prod", "env in (prod"} {
+		_, err = Parse(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	labels := map[string]string{
+		"env":  "prod",
+		"team": "dev",
+		"tier": "front",
+	}
+	for raw, match := range map[string]bool{
+		"":                         true,
+		"env in (prod,staging)":    true,
+		"env notin (prod,staging)": false,
+		"env=prod,team!=ops":       true,
+		"env==staging":             false,
+		"!temporary":               true,
+		"!tier":                    false,
+		"exists tier":              true,
+		"temporary":                false,
+		"temporary!=yes":           true,
+	} {
+		s, err := Parse(raw)
+		assert.NoError(t, err)
+		assert.Equal(t, match, s.Matches(labels), raw)
+	}
+}
@@ -12,12 +12,15 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/factorysh/density/compose"
 	handlers "github.com/factorysh/density/handlers/api"
+	"github.com/factorysh/density/logs"
+	"github.com/factorysh/density/middlewares"
 	"github.com/factorysh/density/runner"
 	"github.com/factorysh/density/scheduler"
 	"github.com/factorysh/density/store"
 	"github.com/factorysh/density/task"
 	_ "github.com/factorysh/density/task/compose" // Register validator and recomposator
 	"github.com/factorysh/density/version"
+	"github.com/factorysh/density/webhook"
 	sentryhttp "github.com/getsentry/sentry-go/http"
 	"github.com/gorilla/mux"
 )
@@ -25,8 +28,12 @@ import (
 // Server struct containing config
 type Server struct {
 	Scheduler *scheduler.Scheduler
-	AuthKey   string
-	Addr      string
+	// Verifier of the tokens, with the AuthKey, and public keys
+	Verifier *middlewares.Verifier
+	AuthKey  string
+	Addr     string
+	// JWKSRefresh is the period of JWKS reloads
+	JWKSRefresh time.Duration
 }
 
 // New initializes server instance
@@ -34,7 +41,7 @@ func New(addr, dataDir, authKey string, cpu, ram int) (*Server, error) {
 
 	dataDir = strings.TrimRight(dataDir, "/")
 
-	for _, sub := range [3]string{"validator", "wd", "store"} {
+	for _, sub := range [4]string{"validator", "wd", "store", "logs"} {
 		err := os.MkdirAll(path.Join(dataDir, sub), 0755)
 		if err != nil {
 			return nil, err
@@ -62,11 +69,17 @@ func New(addr, dataDir, authKey string, cpu, ram int) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	schd, err := scheduler.New(scheduler.NewResources(cpu, ram),
+		runner.New(path.Join(dataDir, "wd"), recompose), store)
+	if err != nil {
+		return nil, err
+	}
+	schd.Logs = logs.New(path.Join(dataDir, "logs"))
 	return &Server{
-		AuthKey: authKey,
-		Addr:    addr,
-		Scheduler: scheduler.New(scheduler.NewResources(cpu, ram),
-			runner.New(path.Join(dataDir, "wd"), recompose), store),
+		AuthKey:   authKey,
+		Verifier:  middlewares.NewVerifier(authKey),
+		Addr:      addr,
+		Scheduler: schd,
 	}, nil
 }
 
@@ -81,8 +94,50 @@ func (s *Server) Run(ctx context.Context) {
 	}
 
 	go s.Scheduler.Start(ctxScheduler)
+	if s.JWKSRefresh > 0 {
+		s.Verifier.Start(ctxScheduler, s.JWKSRefresh)
+	}
 
-	sentryHandler := sentryhttp.New(sentryhttp.Options{})
+	webhooks, err := s.Scheduler.Bucket(webhook.WebhooksBucket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	deliveries, err := s.Scheduler.Bucket(webhook.DeliveriesBucket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	webhook.NewDispatcher(
+		webhook.NewWebhooks(webhooks),
+		webhook.NewDeliveries(deliveries),
+		s.Scheduler.GetTask,
+	).Start(ctxScheduler, s.Scheduler.Pubsub)
+
+	handler, err := s.Handler()
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := &http.Server{
+		Addr:    s.Addr,
+		Handler: handler,
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		ctxShutdown, cancelShutdown := context.WithTimeout(context.TODO(), 3*time.Second)
+		defer cancelShutdown()
+		server.Shutdown(ctxShutdown)
+		cancelShutdown()
+	}
+}
+
+// Handler of the HTTP API, with Sentry
+func (s *Server) Handler() (http.Handler, error) {
 	router := mux.NewRouter()
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-type", "text/plain")
@@ -104,27 +159,16 @@ func (s *Server) Run(ctx context.Context) {
 			"compose": compose.StandardConfig,
 		},
 	}
-	err = v.Register()
-	if err != nil { // FIXME it's ugly
-		panic(err)
-	}
-	handlers.RegisterAPI(router.PathPrefix("/api").Subrouter(), s.Scheduler, v, s.AuthKey)
-	server := &http.Server{
-		Addr:    s.Addr,
-		Handler: sentryHandler.HandleFunc(router.ServeHTTP),
+	err := v.Register()
+	if err != nil {
+		return nil, err
 	}
-
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal(err)
-		}
-	}()
-
-	select {
-	case <-ctx.Done():
-		ctxShutdown, cancelShutdown := context.WithTimeout(context.TODO(), 3*time.Second)
-		defer cancelShutdown()
-		server.Shutdown(ctxShutdown)
-		cancelShutdown()
+	// the OpenAPI document is public, before the authenticated API
+	router.HandleFunc("/api/openapi.json", handlers.HandleGetOpenAPI).Methods(http.MethodGet)
+	err = handlers.RegisterAPI(router.PathPrefix("/api").Subrouter(), s.Scheduler, v, s.Verifier)
+	if err != nil {
+		return nil, err
 	}
+	sentryHandler := sentryhttp.New(sentryhttp.Options{})
+	return sentryHandler.HandleFunc(router.ServeHTTP), nil
 }
@@ -12,7 +12,8 @@ var DefaultBucket = []byte("default")
 
 // BoltStore wraps all the bbol storage logic
 type BoltStore struct {
-	Db *bolt.DB
+	Db     *bolt.DB
+	bucket []byte
 }
 
 // NewBoltStore inits a BoltStore struct
@@ -26,23 +27,44 @@ func NewBoltStore(path string) (*BoltStore, error) {
 	}
 
 	// create a default bucket if not exists
-	db.Update(func(tx *bolt.Tx) error {
-		tx.CreateBucketIfNotExists(DefaultBucket)
-		return nil
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(DefaultBucket)
+		return err
 	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	return &BoltStore{
-		Db: db,
-	}, err
+		Db:     db,
+		bucket: DefaultBucket,
+	}, nil
+}
+
+// Bucket returns a store sharing the same database, in its own bucket
+func (bs *BoltStore) Bucket(name string) (Store, error) {
+	bucket := []byte(name)
+	err := bs.Db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStore{
+		Db:     bs.Db,
+		bucket: bucket,
+	}, nil
 }
 
 // Put value associtated to key in the datastore
 func (bs *BoltStore) Put(key []byte, value []byte) error {
 
 	err := bs.Db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(DefaultBucket)
+		b := tx.Bucket(bs.bucket)
 		if b == nil {
-			return fmt.Errorf("bucket %s does not exists", DefaultBucket)
+			return fmt.Errorf("bucket %s does not exists", bs.bucket)
 		}
 
 		err := b.Put(key, value)
@@ -60,9 +82,9 @@ func (bs *BoltStore) Get(key []byte) ([]byte, error) {
 	var value []byte
 
 	err := bs.Db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(DefaultBucket)
+		b := tx.Bucket(bs.bucket)
 		if b == nil {
-			return fmt.Errorf("bucket %s does not exists", DefaultBucket)
+			return fmt.Errorf("bucket %s does not exists", bs.bucket)
 		}
 
 		v := b.Get(key)
@@ -85,9 +107,9 @@ func (bs *BoltStore) Get(key []byte) ([]byte, error) {
 func (bs *BoltStore) Delete(key []byte) error {
 
 	err := bs.Db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(DefaultBucket)
+		b := tx.Bucket(bs.bucket)
 		if b == nil {
-			return fmt.Errorf("bucket %s does not exists", DefaultBucket)
+			return fmt.Errorf("bucket %s does not exists", bs.bucket)
 		}
 
 		return b.Delete(key)
@@ -100,7 +122,7 @@ func (bs *BoltStore) Delete(key []byte) error {
 func (bs *BoltStore) Length() int {
 	var l int
 	bs.Db.View(func(tx *bolt.Tx) error {
-		l = tx.Bucket(DefaultBucket).Stats().KeyN
+		l = tx.Bucket(bs.bucket).Stats().KeyN
 		return nil
 	})
 	return l
@@ -112,14 +134,28 @@ func (bs *BoltStore) Sync() error {
 
 func (bs *BoltStore) ForEach(fn func(k, v []byte) error) error {
 	return bs.Db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(DefaultBucket)
+		b := tx.Bucket(bs.bucket)
 		return b.ForEach(fn)
 	})
 }
 
+// ForEachFrom iterates from the first key greater or equal to start, with a cursor
+func (bs *BoltStore) ForEachFrom(start []byte, fn func(k, v []byte) error) error {
+	return bs.Db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bs.bucket).Cursor()
+		for k, v := c.Seek(start); k != nil; k, v = c.Next() {
+			err := fn(k, v)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (bs *BoltStore) DeleteWithClause(fn func(k, v []byte) bool) error {
 	bs.Db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket(DefaultBucket)
+		b := tx.Bucket(bs.bucket)
 		c := b.Cursor()
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			if fn(k, v) {
@@ -68,3 +68,30 @@ func TestDelete(t *testing.T) {
 
 	store.Db.Close()
 }
+
+func TestForEachFrom(t *testing.T) {
+	store, err := NewBoltStore("../tests/store.bolt")
+	assert.NoError(t, err)
+	defer store.Db.Close()
+	s, err := store.Bucket("from")
+	assert.NoError(t, err)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		err = s.Put([]byte(k), []byte(k))
+		assert.NoError(t, err)
+	}
+	keys := []string{}
+	err = s.(Seeker).ForEachFrom([]byte("bb"), func(k, v []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "d"}, keys)
+}
+
+func TestBucketError(t *testing.T) {
+	store, err := NewBoltStore("../tests/store.bolt")
+	assert.NoError(t, err)
+	store.Db.Close()
+	_, err = store.Bucket("closed")
+	assert.Error(t, err)
+}
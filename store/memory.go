@@ -5,17 +5,30 @@ import (
 )
 
 type MemoryStore struct {
-	kv   map[string][]byte
-	lock *sync.RWMutex
+	kv      map[string][]byte
+	lock    *sync.RWMutex
+	buckets map[string]*MemoryStore
 }
 
 func NewMemoryStore() *MemoryStore {
 	return &MemoryStore{
-		kv:   make(map[string][]byte),
-		lock: &sync.RWMutex{},
+		kv:      make(map[string][]byte),
+		lock:    &sync.RWMutex{},
+		buckets: make(map[string]*MemoryStore),
 	}
 }
 
+func (m *MemoryStore) Bucket(name string) (Store, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	b, ok := m.buckets[name]
+	if !ok {
+		b = NewMemoryStore()
+		m.buckets[name] = b
+	}
+	return b, nil
+}
+
 func (m *MemoryStore) Get(key []byte) ([]byte, error) {
 	m.lock.RLock()
 	defer m.lock.RUnlock()
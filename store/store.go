@@ -9,4 +9,12 @@ type Store interface {
 	Sync() error
 	ForEach(func(k, v []byte) error) error
 	DeleteWithClause(fn func(k, v []byte) bool) error
+	// Bucket is another namespace in the same Store
+	Bucket(name string) (Store, error)
+}
+
+// Seeker is a Store with ordered keys
+type Seeker interface {
+	// ForEachFrom iterates from the first key greater or equal to start
+	ForEachFrom(start []byte, fn func(k, v []byte) error) error
 }
@@ -53,3 +53,28 @@ func TestStore(t *testing.T) {
 		assert.Equal(t, 2, m.Length())
 	}
 }
+
+func TestBucket(t *testing.T) {
+	f, err := ioutil.TempFile(os.TempDir(), "bolt-")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	store, err := NewBoltStore(f.Name())
+	assert.NoError(t, err)
+	stores := []Store{NewMemoryStore(), store}
+	for _, m := range stores {
+		err := m.Put([]byte("name"), []byte("Bob"))
+		assert.NoError(t, err)
+		b, err := m.Bucket("other")
+		assert.NoError(t, err)
+		assert.Equal(t, 0, b.Length())
+		err = b.Put([]byte("name"), []byte("Alice"))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, m.Length())
+		v, err := m.Get([]byte("name"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("Bob"), v)
+		v, err = b.Get([]byte("name"))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("Alice"), v)
+	}
+}
@@ -0,0 +1,115 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/factorysh/density/task/status"
+)
+
+// MaxArraySize is the maximum number of children of an array task
+const MaxArraySize = 1000
+
+// Array spec expands a task in children, one per index, or one per parameters map
+type Array struct {
+	Start       int                 `json:"start"`                // First index
+	End         int                 `json:"end"`                  // Last index, included
+	Parameters  []map[string]string `json:"parameters,omitempty"` // Environments of each child, exclusive with Start and End
+	Parallelism int                 `json:"parallelism"`          // Maximum children running at once, 0 is unlimited
+}
+
+// Validate an array spec
+func (a *Array) Validate() error {
+	if a.Parallelism < 0 {
+		return errors.New("Array parallelism must be >= 0")
+	}
+	if len(a.Parameters) > 0 {
+		if a.Start != 0 || a.End != 0 {
+			return errors.New("Array parameters and index range are mutually exclusive")
+		}
+	} else if a.End < a.Start {
+		return errors.New("Array end must be >= start")
+	}
+	if a.Size() > MaxArraySize {
+		return fmt.Errorf("Array is too large : %d > %d", a.Size(), MaxArraySize)
+	}
+	return nil
+}
+
+// Size is the number of children
+func (a *Array) Size() int {
+	if len(a.Parameters) > 0 {
+		return len(a.Parameters)
+	}
+	return a.End - a.Start + 1
+}
+
+// Children of an array task, without Id
+func (t *Task) Children() ([]*Task, error) {
+	if t.Array == nil {
+		return nil, errors.New("Not an array task")
+	}
+	children := make([]*Task, t.Array.Size())
+	for i := range children {
+		child, err := t.Clone()
+		if err != nil {
+			return nil, err
+		}
+		child.Array = nil
+		child.Parent = t.Id
+		if len(t.Array.Parameters) > 0 {
+			child.ArrayIndex = i
+			child.Parameters = t.Array.Parameters[i]
+		} else {
+			child.ArrayIndex = t.Array.Start + i
+		}
+		children[i] = child
+	}
+	return children, nil
+}
+
+// Clone a task, with its own Action
+func (t *Task) Clone() (*Task, error) {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	var clone Task
+	err = json.Unmarshal(raw, &clone)
+	if err != nil {
+		return nil, err
+	}
+	return &clone, nil
+}
+
+// AggregateStatus is the status of an array task, from the status of its children.
+// Waiting until a child starts, Running until all children are finished,
+// then Done, or the status of a failed child.
+func AggregateStatus(children []*Task) status.Status {
+	waiting := 0
+	finished := 0
+	aggregated := status.Done
+	for _, child := range children {
+		switch child.Status {
+		case status.Waiting:
+			waiting++
+		case status.Running:
+		case status.Done:
+			finished++
+		default:
+			finished++
+			if aggregated == status.Done || child.Status == status.Error {
+				aggregated = child.Status
+			}
+		}
+	}
+	switch {
+	case finished == len(children):
+		return aggregated
+	case waiting == len(children):
+		return status.Waiting
+	default:
+		return status.Running
+	}
+}
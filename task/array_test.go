@@ -0,0 +1,64 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/factorysh/density/task/status"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChildren(t *testing.T) {
+	parent := &Task{
+		Id:     uuid.New(),
+		Action: &DummyAction{Name: "array"},
+		Array: &Array{
+			Start: 3,
+			End:   5,
+		},
+	}
+	assert.NoError(t, parent.Array.Validate())
+	children, err := parent.Children()
+	assert.NoError(t, err)
+	assert.Len(t, children, 3)
+	for i, child := range children {
+		assert.Nil(t, child.Array)
+		assert.Equal(t, parent.Id, child.Parent)
+		assert.Equal(t, 3+i, child.ArrayIndex)
+		assert.Equal(t, "array", child.Action.(*DummyAction).Name)
+		assert.NotSame(t, parent.Action, child.Action)
+	}
+
+	parent.Array = &Array{
+		Parameters: []map[string]string{
+			{"URL": "https://example.com"},
+			{"URL": "https://example.org"},
+		},
+	}
+	children, err = parent.Children()
+	assert.NoError(t, err)
+	assert.Len(t, children, 2)
+	children[1].InjectPredefinedEnv()
+	assert.Equal(t, "1", children[1].Environments["DENSITY_ARRAY_INDEX"])
+	assert.Equal(t, "https://example.org", children[1].Environments["URL"])
+
+	assert.Error(t, (&Array{Start: 2, End: 1}).Validate())
+	assert.Error(t, (&Array{End: MaxArraySize}).Validate())
+	assert.Error(t, (&Array{End: 2, Parameters: []map[string]string{{}}}).Validate())
+}
+
+func TestAggregateStatus(t *testing.T) {
+	children := func(statuses ...status.Status) []*Task {
+		tasks := make([]*Task, len(statuses))
+		for i, s := range statuses {
+			tasks[i] = &Task{Status: s}
+		}
+		return tasks
+	}
+	assert.Equal(t, status.Waiting, AggregateStatus(children(status.Waiting, status.Waiting)))
+	assert.Equal(t, status.Running, AggregateStatus(children(status.Done, status.Waiting)))
+	assert.Equal(t, status.Running, AggregateStatus(children(status.Running, status.Waiting)))
+	assert.Equal(t, status.Done, AggregateStatus(children(status.Done, status.Done)))
+	assert.Equal(t, status.Timeout, AggregateStatus(children(status.Done, status.Timeout)))
+	assert.Equal(t, status.Error, AggregateStatus(children(status.Canceled, status.Error)))
+}
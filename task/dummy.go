@@ -13,6 +13,7 @@ import (
 
 var _ action.Action = &DummyAction{}
 var _ action.Run = &DummyRun{}
+var _ run.Logger = &DummyRun{}
 
 // DummyAction is the most basic action, used for tests and illustration purpose
 type DummyAction struct {
@@ -20,7 +21,6 @@ type DummyAction struct {
 	Wait     time.Duration `json:"wait"`
 	Counter  int64         `json:"counter"`
 	ExitCode int           `json:"exit_code"`
-	waiters  []chan interface{}
 }
 
 func (da *DummyAction) RegisteredName() string {
@@ -33,7 +33,8 @@ func (da *DummyAction) Validate() error {
 }
 
 type DummyRun struct {
-	da *DummyAction
+	da   *DummyAction
+	done chan interface{}
 }
 
 func (r *DummyRun) Data() run.Data {
@@ -53,11 +54,9 @@ func (r *DummyRun) RegisteredName() string {
 }
 
 func (r *DummyRun) Wait(ctx context.Context) (_status.Status, error) {
-	waiter := make(chan interface{})
-	r.da.waiters = append(r.da.waiters, waiter)
 	var status _status.Status
 	select {
-	case <-waiter:
+	case <-r.done:
 		fmt.Printf("DummyRun.Wait %s done\n", r.da.Name)
 		status = _status.Done
 	case <-ctx.Done():
@@ -73,6 +72,21 @@ func (r *DummyRun) Wait(ctx context.Context) (_status.Status, error) {
 	return status, nil
 }
 
+// Logs of a dummy run is its name
+func (r *DummyRun) Logs(ctx context.Context, follow bool, sink func(run.Line) error) error {
+	err := sink(run.Line{
+		Time:    time.Now(),
+		Service: "dummy",
+		Stream:  "stdout",
+		Text:    r.da.Name,
+	})
+	if err != nil || !follow {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
 func (r DummyRun) Down() error {
 	return nil
 }
@@ -81,23 +95,21 @@ func (r DummyRun) Down() error {
 func (da *DummyAction) Up(pwd string, environments map[string]string, runID int) (run.Run, error) {
 	// Print name
 	fmt.Println("DummyAction.Up :", da.Name)
-	if da.waiters == nil {
-		da.waiters = make([]chan interface{}, 0)
-	}
 	if da.Wait == 0 {
 		da.Wait = 100 * time.Microsecond
 	}
+	// closed when the run is done, a late Wait doesn't miss it
+	done := make(chan interface{})
 	go func() {
 		// Sleep
 		time.Sleep(da.Wait)
 		// Add to dedicated counter
 		atomic.AddInt64(&da.Counter, 1)
-		for _, waiter := range da.waiters {
-			waiter <- new(interface{})
-		}
+		close(done)
 	}()
 
 	return &DummyRun{
-		da: da,
+		da:   da,
+		done: done,
 	}, nil
 }
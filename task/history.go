@@ -0,0 +1,43 @@
+package task
+
+import (
+	"time"
+
+	"github.com/factorysh/density/task/status"
+)
+
+// MaxHistory is the number of transitions kept in a task history
+const MaxHistory = 100
+
+// Transition of a task, from a status to another one
+type Transition struct {
+	From   status.Status `json:"from"`
+	To     status.Status `json:"to"`
+	Time   time.Time     `json:"time"`
+	Reason string        `json:"reason,omitempty"`
+}
+
+// SetStatus changes the status of the task, and records the transition, latest last
+func (t *Task) SetStatus(s status.Status, reason string) {
+	if t.Status == s {
+		return
+	}
+	t.History = append(t.History, Transition{
+		From:   t.Status,
+		To:     s,
+		Time:   time.Now(),
+		Reason: reason,
+	})
+	if len(t.History) > MaxHistory {
+		t.History = t.History[len(t.History)-MaxHistory:]
+	}
+	t.Status = s
+}
+
+// LastTransition of the task, nil without any transition
+func (t *Task) LastTransition() *Transition {
+	if len(t.History) == 0 {
+		return nil
+	}
+	return &t.History[len(t.History)-1]
+}
@@ -0,0 +1,77 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/factorysh/density/task/status"
+)
+
+// Notify is a webhook called on some status transitions of a task
+type Notify struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"` // Lower case status names, every transition if empty
+	Secret string   `json:"secret,omitempty"` // HMAC key of the payload signature
+}
+
+// NotifyEvents are the transitions a webhook can choose
+var NotifyEvents = map[string]bool{}
+
+func init() {
+	for _, s := range []status.Status{status.Waiting, status.Running, status.Done,
+		status.Timeout, status.Canceled, status.Error} {
+		NotifyEvents[strings.ToLower(s.String())] = true
+	}
+}
+
+// Validate a webhook
+func (n *Notify) Validate() error {
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("Webhook URL must be http or https: %s", n.URL)
+	}
+	if n.Secret == "" {
+		return errors.New("Webhook needs a secret")
+	}
+	for _, event := range n.Events {
+		if event == "expired" {
+			return errors.New("Tasks don't expire, there is no expired event, use timeout or canceled")
+		}
+		if !NotifyEvents[event] {
+			return fmt.Errorf("Unknown webhook event: %s", event)
+		}
+	}
+	return nil
+}
+
+// HideSecrets returns a copy of the webhooks, without their secrets
+func HideSecrets(notify []Notify) []Notify {
+	if notify == nil {
+		return nil
+	}
+	hidden := make([]Notify, len(notify))
+	for i, n := range notify {
+		n.Secret = ""
+		hidden[i] = n
+	}
+	return hidden
+}
+
+// Wants returns true if the webhook is called for this status
+func (n *Notify) Wants(s string) bool {
+	if len(n.Events) == 0 {
+		return true
+	}
+	s = strings.ToLower(s)
+	for _, event := range n.Events {
+		if event == s {
+			return true
+		}
+	}
+	return false
+}
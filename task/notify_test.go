@@ -0,0 +1,19 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyValidate(t *testing.T) {
+	n := &Notify{URL: "https://example.com", Secret: "s3cr3t", Events: []string{"done", "timeout"}}
+	assert.NoError(t, n.Validate())
+	n.Events = []string{"expired"}
+	assert.Error(t, n.Validate())
+	n.Events = []string{"plop"}
+	assert.Error(t, n.Validate())
+	n.Events = nil
+	n.Secret = ""
+	assert.Error(t, n.Validate())
+}
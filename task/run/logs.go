@@ -0,0 +1,21 @@
+package run
+
+import (
+	"context"
+	"time"
+)
+
+// Line of the output of a service
+type Line struct {
+	Time    time.Time `json:"time"`
+	Service string    `json:"service"`
+	Stream  string    `json:"stream"` // stdout or stderr
+	Text    string    `json:"text"`
+}
+
+// Logger is a Run with readable logs
+type Logger interface {
+	// Logs of all the services, from the start of the run.
+	// With follow, logs are streamed until the end of the run.
+	Logs(ctx context.Context, follow bool, sink func(Line) error) error
+}
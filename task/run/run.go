@@ -15,6 +15,9 @@ type Data struct {
 	ExitCode int       `json:"exit_code"`
 	Runner   string    `json:"runner"`
 	Running  bool      `json:"running"`
+	// Preempted runs were stopped to make room for a task with a higher priority,
+	// they don't count as a failure
+	Preempted bool `json:"preempted,omitempty"`
 }
 
 type Run interface {
@@ -4,6 +4,7 @@ package status
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 type Status int
@@ -38,3 +39,15 @@ func (s *Status) UnmarshalJSON(b []byte) error {
 	}
 	return fmt.Errorf("Not a known status: %s", raw)
 }
+
+// Parse a status name, case insensitive
+func Parse(raw string) (Status, error) {
+	var start uint8
+	for i, end := range _Status_index[1:] {
+		if strings.EqualFold(_Status_name[start:end], raw) {
+			return Status(i), nil
+		}
+		start = end
+	}
+	return Waiting, fmt.Errorf("Not a known status: %s", raw)
+}
@@ -25,3 +25,11 @@ func TestStatusJSON(t *testing.T) {
 	fmt.Println(string(j), s2.String())
 	assert.Equal(t, Done, s2)
 }
+
+func TestParse(t *testing.T) {
+	s, err := Parse("running")
+	assert.NoError(t, err)
+	assert.Equal(t, Running, s)
+	_, err = Parse("plop")
+	assert.Error(t, err)
+}
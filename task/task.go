@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/factorysh/density/task/action"
@@ -32,9 +33,7 @@ func init() {
 		ActionsRegistry = make(map[string]func() action.Action)
 	}
 	ActionsRegistry["dummy"] = func() action.Action {
-		return &DummyAction{
-			waiters: make([]chan interface{}, 0),
-		}
+		return &DummyAction{}
 	}
 
 	if RunRegistry == nil {
@@ -63,16 +62,27 @@ type Task struct {
 	Cancel          context.CancelFunc `json:"-"`                  // Cancel the action
 	Status          status.Status      `json:"status"`             // Status
 	Mtime           time.Time          `json:"mtime"`              // Modified time
+	Revision        int                `json:"revision"`           // Incremented at each modification
 	Owner           string             `json:"owner"`              // Owner
 	Retry           int                `json:"retry"`              // Number of retry before crash
 	Every           time.Duration      `json:"every"`              // Periodic execution. Exclusive with Cron
 	Cron            string             `json:"cron"`               // Cron definition. Exclusive with Every
+	CatchUp         bool               `json:"catch_up"`           // Run a periodic occurrence missed during a blackout once it ends
+	Priority        int                `json:"priority"`           // Higher priority starts first
+	Preemptible     bool               `json:"preemptible"`        // Can be stopped to make room for a task with a higher priority
+	Paused          bool               `json:"paused"`             // A paused waiting task doesn't start
+	Array           *Array             `json:"array,omitempty"`    // Expanded in children tasks
+	Parent          uuid.UUID          `json:"parent"`             // Array task of this child
+	ArrayIndex      int                `json:"array_index"`        // Index of this child
+	Parameters      map[string]string  `json:"parameters,omitempty"`
 	Environments    map[string]string  `json:"environments,omitempty"`
 	resourceCancel  context.CancelFunc `json:"-"`
 	Run             _run.Run           `json:"run"`
 	RunCounter      int                `json:"run_counter"`
 	Runs            []_run.Data        `json:"runs"`
+	History         []Transition       `json:"history"` // Status transitions, latest last
 	Labels          map[string]string  `json:"labels"`
+	Notify          []Notify           `json:"notify,omitempty"` // Webhooks called on transitions
 }
 
 // Resp represent a task that can be send directly on the wire
@@ -85,19 +95,34 @@ type Resp struct {
 	Id              uuid.UUID         `json:"id"`                 // Id
 	Status          status.Status     `json:"status"`             // Status
 	Mtime           time.Time         `json:"mtime"`              // Modified time
+	Revision        int               `json:"revision"`           // Incremented at each modification
 	Owner           string            `json:"owner"`              // Owner
 	Retry           int               `json:"retry"`              // Number of retry before crash
 	Every           time.Duration     `json:"every"`              // Periodic execution. Exclusive with Cron
 	Cron            string            `json:"cron"`               // Cron definition. Exclusive with Every
+	CatchUp         bool              `json:"catch_up"`           // Run a periodic occurrence missed during a blackout once it ends
+	Priority        int               `json:"priority"`           // Higher priority starts first
+	Preemptible     bool              `json:"preemptible"`        // Can be stopped to make room for a task with a higher priority
+	Paused          bool              `json:"paused"`             // A paused waiting task doesn't start
+	Array           *Array            `json:"array,omitempty"`    // Expanded in children tasks
+	Parent          uuid.UUID         `json:"parent"`             // Array task of this child
+	ArrayIndex      int               `json:"array_index"`        // Index of this child
+	Parameters      map[string]string `json:"parameters,omitempty"`
 	Environments    map[string]string `json:"environments,omitempty"`
 	Run             _run.Data         `json:"run"`
 	RunCounter      int               `json:"run_counter"`
 	Runs            []_run.Data       `json:"runs"`
+	History         []Transition      `json:"history"` // Status transitions, latest last
 	Labels          map[string]string `json:"labels"`
+	Notify          []Notify          `json:"notify,omitempty"` // Webhooks called on transitions
 }
 
-// ToTaskResp will Convert a Task to TaskResp
+// ToTaskResp will Convert a Task to TaskResp, webhook secrets are hidden
 func (t *Task) ToTaskResp() Resp {
+	var run _run.Data
+	if t.Run != nil {
+		run = t.Run.Data()
+	}
 
 	return Resp{
 		Start:           t.Start,
@@ -108,15 +133,26 @@ func (t *Task) ToTaskResp() Resp {
 		Id:              t.Id,
 		Status:          t.Status,
 		Mtime:           t.Mtime,
+		Revision:        t.Revision,
 		Owner:           t.Owner,
 		Retry:           t.Retry,
 		Every:           t.Every,
 		Cron:            t.Cron,
+		CatchUp:         t.CatchUp,
+		Priority:        t.Priority,
+		Preemptible:     t.Preemptible,
+		Paused:          t.Paused,
+		Array:           t.Array,
+		Parent:          t.Parent,
+		ArrayIndex:      t.ArrayIndex,
+		Parameters:      t.Parameters,
 		Environments:    t.Environments,
-		Run:             t.Run.Data(),
+		Run:             run,
 		RunCounter:      t.RunCounter,
 		Runs:            t.Runs,
+		History:         t.History,
 		Labels:          t.Labels,
+		Notify:          HideSecrets(t.Notify),
 	}
 
 }
@@ -159,15 +195,26 @@ type RawTask struct {
 	Id              uuid.UUID                  `json:"id"`                 // Id
 	Status          status.Status              `json:"status"`             // Status
 	Mtime           time.Time                  `json:"mtime"`              // Modified time
+	Revision        int                        `json:"revision"`           // Incremented at each modification
 	Owner           string                     `json:"owner"`              // Owner
 	Retry           int                        `json:"retry"`              // Number of retry before crash
 	Every           time.Duration              `json:"every"`              // Periodic execution. Exclusive with Cron
 	Cron            string                     `json:"cron"`               // Cron definition. Exclusive with Every
+	CatchUp         bool                       `json:"catch_up"`           // Run a periodic occurrence missed during a blackout once it ends
+	Priority        int                        `json:"priority"`           // Higher priority starts first
+	Preemptible     bool                       `json:"preemptible"`        // Can be stopped to make room for a task with a higher priority
+	Paused          bool                       `json:"paused"`             // A paused waiting task doesn't start
+	Array           *Array                     `json:"array,omitempty"`    // Expanded in children tasks
+	Parent          uuid.UUID                  `json:"parent"`             // Array task of this child
+	ArrayIndex      int                        `json:"array_index"`        // Index of this child
+	Parameters      map[string]string          `json:"parameters,omitempty"`
 	Environments    map[string]string          `json:"environments,omitempty"`
 	Run             map[string]json.RawMessage `json:"run"`
 	RunCounter      int                        `json:"run_counter"`
 	Runs            []_run.Data                `json:"runs"`
+	History         []Transition               `json:"history"` // Status transitions, latest last
 	Labels          map[string]string          `json:"labels"`
+	Notify          []Notify                   `json:"notify,omitempty"` // Webhooks called on transitions
 }
 
 func (t *Task) UnmarshalJSON(b []byte) error {
@@ -230,14 +277,25 @@ func (t *Task) UnmarshalJSON(b []byte) error {
 	t.Id = raw.Id
 	t.Status = raw.Status
 	t.Mtime = raw.Mtime
+	t.Revision = raw.Revision
 	t.Owner = raw.Owner
 	t.Retry = raw.Retry
 	t.Every = raw.Every
 	t.Cron = raw.Cron
+	t.CatchUp = raw.CatchUp
+	t.Priority = raw.Priority
+	t.Preemptible = raw.Preemptible
+	t.Paused = raw.Paused
+	t.Array = raw.Array
+	t.Parent = raw.Parent
+	t.ArrayIndex = raw.ArrayIndex
+	t.Parameters = raw.Parameters
 	t.Environments = raw.Environments
 	t.RunCounter = raw.RunCounter
 	t.Runs = raw.Runs
+	t.History = raw.History
 	t.Labels = raw.Labels
+	t.Notify = raw.Notify
 
 	return nil
 }
@@ -252,16 +310,27 @@ func (t *Task) MarshalJSON() ([]byte, error) {
 		Id:              t.Id,
 		Status:          t.Status,
 		Mtime:           t.Mtime,
+		Revision:        t.Revision,
 		Owner:           t.Owner,
 		Retry:           t.Retry,
 		Every:           t.Every,
 		Cron:            t.Cron,
+		CatchUp:         t.CatchUp,
+		Priority:        t.Priority,
+		Preemptible:     t.Preemptible,
+		Paused:          t.Paused,
+		Array:           t.Array,
+		Parent:          t.Parent,
+		ArrayIndex:      t.ArrayIndex,
+		Parameters:      t.Parameters,
 		Environments:    t.Environments,
 		Action:          make(map[string]json.RawMessage),
 		Run:             make(map[string]json.RawMessage),
 		RunCounter:      t.RunCounter,
 		Runs:            t.Runs,
+		History:         t.History,
 		Labels:          t.Labels,
+		Notify:          t.Notify,
 	}
 	if t.Action != nil {
 		rawAction, err := json.Marshal(t.Action)
@@ -303,13 +372,32 @@ func (t *Task) PrepareReschedule() {
 		if err == nil {
 			t.Start = sched.Next(time.Now())
 		} else {
-			t.Status = status.Error
+			t.SetStatus(status.Error, "invalid cron")
 			log.Error(fmt.Errorf("cron value %v for task %v is invalid", t.Cron, t.Id))
 		}
 	}
 
 }
 
+// SkipUntil moves the start date of a periodic task to its first occurrence not before end
+func (t *Task) SkipUntil(end time.Time) {
+	if t.Every > 0 {
+		for t.Start.Before(end) {
+			t.Start = t.Start.Add(t.Every)
+		}
+	}
+
+	if t.Cron != "" {
+		sched, err := Parser.Parse(t.Cron)
+		if err == nil {
+			t.Start = sched.Next(end.Add(-time.Nanosecond))
+		} else {
+			t.SetStatus(status.Error, "invalid cron")
+			log.Error(fmt.Errorf("cron value %v for task %v is invalid", t.Cron, t.Id))
+		}
+	}
+}
+
 const defaultCachePath = "/density/cache"
 
 // InjectPredefinedEnv is used to inject or modifiy Density predefined env variables
@@ -327,6 +415,13 @@ func (t *Task) InjectPredefinedEnv() {
 	t.Environments["XDG_CACHE_HOME"] = defaultCachePath
 	t.Environments["DENSITY_RUNNER"] = t.Action.RegisteredName()
 	t.Environments["DENSITY_MAX_EXECUTION_TIME"] = t.MaxExectionTime.String()
+	if t.Parent != uuid.Nil {
+		t.Environments["DENSITY_ARRAY_PARENT_ID"] = t.Parent.String()
+		t.Environments["DENSITY_ARRAY_INDEX"] = strconv.Itoa(t.ArrayIndex)
+		for k, v := range t.Parameters {
+			t.Environments[k] = v
+		}
+	}
 
 }
 
@@ -339,6 +434,13 @@ func (t *Task) AddRunToHistory(r _run.Run) {
 	t.Runs = append([]_run.Data{r.Data()}, t.Runs...)
 }
 
+// Preempted marks the latest run as preempted
+func (t *Task) Preempted() {
+	if len(t.Runs) > 0 {
+		t.Runs[0].Preempted = true
+	}
+}
+
 // NewTask init a new task
 func NewTask(o string, a action.Action) Task {
 	t := New()
@@ -367,6 +469,9 @@ type TaskByKarma []*Task
 func (t TaskByKarma) Len() int      { return len(t) }
 func (t TaskByKarma) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
 func (t TaskByKarma) Less(i, j int) bool {
+	if t[i].Priority != t[j].Priority {
+		return t[i].Priority > t[j].Priority
+	}
 	return (t[i].RAM * t[i].CPU / int(int64(t[i].MaxExectionTime))) <
 		(t[j].RAM * t[j].CPU / int(int64(t[j].MaxExectionTime)))
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/factorysh/density/task/status"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -78,3 +79,18 @@ func TestValidateLabel(t *testing.T) {
 	}
 
 }
+
+func TestSetStatus(t *testing.T) {
+	task := New()
+	task.SetStatus(status.Waiting, "nothing")
+	assert.Len(t, task.History, 0)
+	task.SetStatus(status.Running, "started")
+	assert.Equal(t, status.Running, task.Status)
+	assert.Equal(t, status.Waiting, task.LastTransition().From)
+	assert.Equal(t, "started", task.LastTransition().Reason)
+	for i := 0; i < MaxHistory; i++ {
+		task.SetStatus(status.Waiting, "")
+		task.SetStatus(status.Running, "")
+	}
+	assert.Len(t, task.History, MaxHistory)
+}
@@ -0,0 +1,79 @@
+package template
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/factorysh/density/store"
+)
+
+// Templates stores Template, named per owner
+type Templates struct {
+	store store.Store
+}
+
+// NewTemplates uses a store
+func NewTemplates(s store.Store) *Templates {
+	return &Templates{store: s}
+}
+
+func key(owner, name string) []byte {
+	return []byte(owner + "/" + name)
+}
+
+// Get a Template of an owner, nil if it doesn't exist
+func (t *Templates) Get(owner, name string) (*Template, error) {
+	v, err := t.store.Get(key(owner, name))
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, nil
+	}
+	var tmpl Template
+	err = json.Unmarshal(v, &tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
+// Put a Template, under its owner
+func (t *Templates) Put(tmpl *Template) error {
+	tmpl.Mtime = time.Now()
+	value, err := json.Marshal(tmpl)
+	if err != nil {
+		return err
+	}
+	return t.store.Put(key(tmpl.Owner, tmpl.Name), value)
+}
+
+// Delete a Template of an owner
+func (t *Templates) Delete(owner, name string) error {
+	return t.store.Delete(key(owner, name))
+}
+
+// List all Templates, sorted by name and owner
+func (t *Templates) List() ([]*Template, error) {
+	templates := make([]*Template, 0)
+	err := t.store.ForEach(func(k, v []byte) error {
+		var tmpl Template
+		err := json.Unmarshal(v, &tmpl)
+		if err != nil {
+			return err
+		}
+		templates = append(templates, &tmpl)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Name != templates[j].Name {
+			return templates[i].Name < templates[j].Name
+		}
+		return templates[i].Owner < templates[j].Owner
+	})
+	return templates, nil
+}
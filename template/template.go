@@ -0,0 +1,342 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	txt "text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IsNameValid is used to check template and parameter names
+var IsNameValid = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`).MatchString
+
+// Parameter types
+const (
+	String   = "string"
+	Int      = "int"
+	Bool     = "bool"
+	Duration = "duration"
+)
+
+// Parameter of a template
+type Parameter struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`              // string, int, bool or duration
+	Default     interface{} `json:"default,omitempty"` // Parameter is required without default
+	Pattern     string      `json:"pattern,omitempty"` // Regexp for a string
+	Enum        []string    `json:"enum,omitempty"`    // Allowed values for a string
+	Description string      `json:"description,omitempty"`
+}
+
+// Validate a parameter definition
+func (p *Parameter) Validate() error {
+	if !IsNameValid(p.Name) {
+		return fmt.Errorf("Invalid parameter name: %s", p.Name)
+	}
+	switch p.Type {
+	case String, Int, Bool, Duration:
+	case "":
+		p.Type = String
+	default:
+		return fmt.Errorf("Unknown type %s for parameter %s", p.Type, p.Name)
+	}
+	if p.Pattern != "" {
+		if p.Type != String {
+			return fmt.Errorf("Only a string parameter can have a pattern: %s", p.Name)
+		}
+		_, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return err
+		}
+	}
+	if len(p.Enum) > 0 && p.Type != String {
+		return fmt.Errorf("Only a string parameter can have an enum: %s", p.Name)
+	}
+	if p.Default != nil {
+		_, err := p.Value(p.Default)
+		if err != nil {
+			return fmt.Errorf("Bad default: %v", err)
+		}
+	}
+	return nil
+}
+
+// Value casts and validates a raw value
+func (p *Parameter) Value(raw interface{}) (interface{}, error) {
+	switch p.Type {
+	case Int:
+		switch v := raw.(type) {
+		case float64:
+			if v != float64(int(v)) {
+				return nil, fmt.Errorf("%s is not an int: %v", p.Name, v)
+			}
+			return int(v), nil
+		case int:
+			return v, nil
+		case string:
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s is not an int: %v", p.Name, v)
+			}
+			return i, nil
+		}
+	case Bool:
+		switch v := raw.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a bool: %v", p.Name, v)
+			}
+			return b, nil
+		}
+	case Duration:
+		v, ok := raw.(string)
+		if ok {
+			_, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s is not a duration: %v", p.Name, v)
+			}
+			return v, nil
+		}
+	default:
+		v, ok := raw.(string)
+		if !ok {
+			break
+		}
+		if p.Pattern != "" && !regexp.MustCompile(p.Pattern).MatchString(v) {
+			return nil, fmt.Errorf("%s doesn't match %s", p.Name, p.Pattern)
+		}
+		if len(p.Enum) > 0 {
+			for _, e := range p.Enum {
+				if e == v {
+					return v, nil
+				}
+			}
+			return nil, fmt.Errorf("%s must be one of %v", p.Name, p.Enum)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("%s is not a %s: %v", p.Name, p.Type, raw)
+}
+
+// zero is a valid value, used to check a template
+func (p *Parameter) zero() interface{} {
+	if p.Default != nil {
+		v, _ := p.Value(p.Default)
+		return v
+	}
+	switch p.Type {
+	case Int:
+		return 0
+	case Bool:
+		return false
+	case Duration:
+		return "1s"
+	default:
+		if len(p.Enum) > 0 {
+			return p.Enum[0]
+		}
+		return ""
+	}
+}
+
+// Template is a compose document, with parameters.
+// Parameters are used with the text/template syntax : {{ .name }}, or {{ quote .name }} for a YAML string.
+// String parameters are escaped, they must be in a double quoted string, or quoted, an enum is safe anywhere.
+type Template struct {
+	Name       string                 `json:"name"`
+	Owner      string                 `json:"owner"`
+	Compose    string                 `json:"compose"`
+	Batch      map[string]interface{} `json:"x-batch,omitempty"` // Default x-batch values
+	Parameters []Parameter            `json:"parameters"`
+	Mtime      time.Time              `json:"mtime"`
+}
+
+// escaped is a string parameter, escaped for a double quoted YAML string
+type escaped string
+
+func escape(v string) escaped {
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	raw := strings.TrimSpace(out.String())
+	return escaped(raw[1 : len(raw)-1])
+}
+
+var funcs = txt.FuncMap{
+	"quote": func(v interface{}) (string, error) {
+		if e, ok := v.(escaped); ok {
+			return `"` + string(e) + `"`, nil
+		}
+		raw, err := json.Marshal(fmt.Sprint(v))
+		return string(raw), err
+	},
+}
+
+// probe is a string value breaking YAML if it's not quoted
+const probe = `probe\" a: [b] # c` + "\n- d"
+
+// count the strings containing the probe, in keys and values
+func countProbes(doc interface{}) int {
+	switch v := doc.(type) {
+	case string:
+		return strings.Count(v, probe)
+	case map[string]interface{}:
+		n := 0
+		for k, value := range v {
+			n += strings.Count(k, probe) + countProbes(value)
+		}
+		return n
+	case []interface{}:
+		n := 0
+		for _, value := range v {
+			n += countProbes(value)
+		}
+		return n
+	}
+	return 0
+}
+
+// checkQuoted checks that a string parameter is only used in quoted strings
+func (t *Template) checkQuoted(values map[string]interface{}, name string) error {
+	probed := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		probed[k] = v
+	}
+	probed[name] = probe
+	out, err := t.execute(probed)
+	if err != nil {
+		return err
+	}
+	used := strings.Count(string(out), string(escape(probe)))
+	var doc interface{}
+	err = yaml.Unmarshal(out, &doc)
+	if err != nil || countProbes(doc) != used {
+		return fmt.Errorf("The string parameter %s must be in a double quoted string, or quoted: {{ quote .%s }}", name, name)
+	}
+	return nil
+}
+
+// Validate a template, rendered with default values
+func (t *Template) Validate() error {
+	if !IsNameValid(t.Name) {
+		return fmt.Errorf("Invalid template name: %s", t.Name)
+	}
+	if t.Compose == "" {
+		return errors.New("Empty compose")
+	}
+	names := make(map[string]bool)
+	values := make(map[string]interface{})
+	for i := range t.Parameters {
+		p := &t.Parameters[i]
+		err := p.Validate()
+		if err != nil {
+			return err
+		}
+		if names[p.Name] {
+			return fmt.Errorf("Duplicated parameter: %s", p.Name)
+		}
+		names[p.Name] = true
+		values[p.Name] = p.zero()
+	}
+	_, err := t.render(values)
+	if err != nil {
+		return err
+	}
+	for _, p := range t.Parameters {
+		if p.Type == String && len(p.Enum) == 0 {
+			err = t.checkQuoted(values, p.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Render the compose document with these parameters
+func (t *Template) Render(parameters map[string]interface{}) ([]byte, error) {
+	values := make(map[string]interface{})
+	for i := range t.Parameters {
+		p := &t.Parameters[i]
+		raw, ok := parameters[p.Name]
+		if !ok {
+			if p.Default == nil {
+				return nil, fmt.Errorf("Missing parameter: %s", p.Name)
+			}
+			raw = p.Default
+		}
+		v, err := p.Value(raw)
+		if err != nil {
+			return nil, err
+		}
+		values[p.Name] = v
+	}
+	for k := range parameters {
+		if _, ok := values[k]; !ok {
+			return nil, fmt.Errorf("Unknown parameter: %s", k)
+		}
+	}
+	return t.render(values)
+}
+
+// execute the template, string values are escaped
+func (t *Template) execute(values map[string]interface{}) ([]byte, error) {
+	tmpl, err := txt.New(t.Name).Funcs(funcs).Option("missingkey=error").Parse(t.Compose)
+	if err != nil {
+		return nil, err
+	}
+	escapedValues := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		if s, ok := v.(string); ok {
+			v = escape(s)
+		}
+		escapedValues[k] = v
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, escapedValues)
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (t *Template) render(values map[string]interface{}) ([]byte, error) {
+	out, err := t.execute(values)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	err = yaml.Unmarshal(out, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, errors.New("Empty compose")
+	}
+	if len(t.Batch) == 0 {
+		return out, nil
+	}
+	// x-batch defaults
+	batch, ok := doc["x-batch"].(map[string]interface{})
+	if !ok {
+		batch = make(map[string]interface{})
+	}
+	for k, v := range t.Batch {
+		if _, ok := batch[k]; !ok {
+			batch[k] = v
+		}
+	}
+	doc["x-batch"] = batch
+	return yaml.Marshal(doc)
+}
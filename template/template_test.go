@@ -0,0 +1,146 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/factorysh/density/store"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRender(t *testing.T) {
+	tmpl := &Template{
+		Name: "sitespeed",
+		Compose: `
+version: '3'
+services:
+  sitespeed:
+    image: "sitespeedio/sitespeed.io:{{ .version }}"
+    command: {{ quote .url }}
+x-batch:
+  max_execution_time: {{ .timeout }}
+`,
+		Batch: map[string]interface{}{
+			"max_execution_time": "1m",
+			"retry":              2,
+		},
+		Parameters: []Parameter{
+			{
+				Name:    "url",
+				Pattern: "^https://",
+			},
+			{
+				Name: "version",
+				Enum: []string{"16", "17"},
+			},
+			{
+				Name:    "timeout",
+				Type:    Duration,
+				Default: "5m",
+			},
+		},
+	}
+	assert.NoError(t, tmpl.Validate())
+
+	raw, err := tmpl.Render(map[string]interface{}{
+		"url":     "https://example.com",
+		"version": "17",
+	})
+	assert.NoError(t, err)
+	var doc map[string]interface{}
+	err = yaml.Unmarshal(raw, &doc)
+	assert.NoError(t, err)
+	service := doc["services"].(map[string]interface{})["sitespeed"].(map[string]interface{})
+	assert.Equal(t, "sitespeedio/sitespeed.io:17", service["image"])
+	assert.Equal(t, "https://example.com", service["command"])
+	batch := doc["x-batch"].(map[string]interface{})
+	assert.Equal(t, "5m", batch["max_execution_time"])
+	assert.Equal(t, 2, batch["retry"])
+
+	for _, bad := range []map[string]interface{}{
+		{"version": "17"}, // missing url
+		{"url": "http://example.com", "version": "17"},  // pattern
+		{"url": "https://example.com", "version": "15"}, // enum
+		{"url": "https://example.com", "version": "17", "timeout": "soon"},
+		{"url": "https://example.com", "version": "17", "other": "plop"},
+	} {
+		_, err = tmpl.Render(bad)
+		assert.Error(t, err, bad)
+	}
+
+	tmpl.Parameters = append(tmpl.Parameters, Parameter{Name: "count", Type: Int, Default: "many"})
+	assert.Error(t, tmpl.Validate())
+}
+
+func TestEscape(t *testing.T) {
+	tmpl := &Template{
+		Name: "hello",
+		Compose: `
+version: '3'
+services:
+  hello:
+    image: "busybox"
+    command: "echo {{ .message }}"
+    environment:
+      MESSAGE: {{ quote .message }}
+`,
+		Parameters: []Parameter{{Name: "message"}},
+	}
+	assert.NoError(t, tmpl.Validate())
+	injection := "hi\"\n    privileged: true\n    x: \""
+	raw, err := tmpl.Render(map[string]interface{}{"message": injection})
+	assert.NoError(t, err)
+	var doc map[string]interface{}
+	err = yaml.Unmarshal(raw, &doc)
+	assert.NoError(t, err)
+	service := doc["services"].(map[string]interface{})["hello"].(map[string]interface{})
+	assert.Equal(t, "echo "+injection, service["command"])
+	assert.Equal(t, injection, service["environment"].(map[string]interface{})["MESSAGE"])
+	assert.NotContains(t, service, "privileged")
+
+	for _, compose := range []string{
+		"version: '3'\nservices:\n  hello:\n    image: busybox:{{ .message }}\n",
+		"version: '3'\nservices:\n  hello:\n    image: 'busybox:{{ .message }}'\n",
+		"version: '3'\nservices:\n  hello:\n    image: \"busybox\"\n    command: {{ .message }}\n",
+	} {
+		tmpl.Compose = compose
+		assert.Error(t, tmpl.Validate(), compose)
+	}
+	// an enum is safe anywhere
+	tmpl.Parameters[0].Enum = []string{"latest"}
+	assert.NoError(t, tmpl.Validate())
+}
+
+func TestTemplates(t *testing.T) {
+	templates := NewTemplates(store.NewMemoryStore())
+	err := templates.Put(&Template{
+		Name:    "hello",
+		Owner:   "bob",
+		Compose: "version: '3'",
+	})
+	assert.NoError(t, err)
+	err = templates.Put(&Template{
+		Name:    "hello",
+		Owner:   "alice",
+		Compose: "version: '3.7'",
+	})
+	assert.NoError(t, err)
+	tmpl, err := templates.Get("bob", "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "version: '3'", tmpl.Compose)
+	tmpl, err = templates.Get("bob", "nope")
+	assert.NoError(t, err)
+	assert.Nil(t, tmpl)
+	list, err := templates.List()
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "alice", list[0].Owner)
+	err = templates.Delete("bob", "hello")
+	assert.NoError(t, err)
+	list, err = templates.List()
+	assert.NoError(t, err)
+	assert.Len(t, list, 1)
+	tmpl, err = templates.Get("alice", "hello")
+	assert.NoError(t, err)
+	assert.Equal(t, "version: '3.7'", tmpl.Compose)
+}
@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/store"
+	"github.com/google/uuid"
+)
+
+// Delivery states
+const (
+	Pending   = "pending"
+	Delivered = "delivered"
+	Failed    = "failed"
+)
+
+// Delivery of an event to a webhook, retried until it succeeds or fails too many times
+type Delivery struct {
+	Id          uuid.UUID    `json:"id"`
+	Owner       string       `json:"owner"`
+	Webhook     uuid.UUID    `json:"webhook"` // Nil for a webhook of a task
+	URL         string       `json:"url"`
+	Secret      string       `json:"secret,omitempty"`
+	Event       pubsub.Event `json:"event"`
+	State       string       `json:"state"`
+	Attempts    int          `json:"attempts"`
+	NextAttempt time.Time    `json:"next_attempt"`
+	StatusCode  int          `json:"status_code,omitempty"` // Of the latest attempt
+	LastError   string       `json:"last_error,omitempty"`
+	Created     time.Time    `json:"created"`
+	Mtime       time.Time    `json:"mtime"`
+}
+
+// Deliveries is the persistent queue of Delivery
+type Deliveries struct {
+	store store.Store
+}
+
+// NewDeliveries uses a store
+func NewDeliveries(s store.Store) *Deliveries {
+	return &Deliveries{store: s}
+}
+
+// Put a Delivery
+func (d *Deliveries) Put(delivery *Delivery) error {
+	delivery.Mtime = time.Now()
+	value, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	return d.store.Put([]byte(delivery.Id.String()), value)
+}
+
+// List Deliveries matching the filter, latest first
+func (d *Deliveries) List(filter func(*Delivery) bool) ([]*Delivery, error) {
+	deliveries := make([]*Delivery, 0)
+	err := d.store.ForEach(func(k, v []byte) error {
+		var delivery Delivery
+		err := json.Unmarshal(v, &delivery)
+		if err != nil {
+			return err
+		}
+		if filter == nil || filter(&delivery) {
+			deliveries = append(deliveries, &delivery)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].Created.After(deliveries[j].Created)
+	})
+	return deliveries, nil
+}
+
+// Due returns the pending Deliveries, oldest first, and the time of the next one not yet due
+func (d *Deliveries) Due(now time.Time) ([]*Delivery, time.Time, error) {
+	var next time.Time
+	pending, err := d.List(func(delivery *Delivery) bool {
+		if delivery.State != Pending {
+			return false
+		}
+		if delivery.NextAttempt.After(now) {
+			if next.IsZero() || delivery.NextAttempt.Before(next) {
+				next = delivery.NextAttempt
+			}
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, next, err
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Created.Before(pending[j].Created)
+	})
+	return pending, next, nil
+}
+
+// Trim finished Deliveries older than a date
+func (d *Deliveries) Trim(before time.Time) error {
+	return d.store.DeleteWithClause(func(k, v []byte) bool {
+		var delivery Delivery
+		err := json.Unmarshal(v, &delivery)
+		if err != nil {
+			return false
+		}
+		return delivery.State != Pending && delivery.Mtime.Before(before)
+	})
+}
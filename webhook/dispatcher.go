@@ -0,0 +1,276 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/task"
+	"github.com/factorysh/density/todo"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Dispatcher queues deliveries of the transitions of tasks, and sends them.
+// Events are buffered in memory, deliveries are stored by another goroutine, the publisher never waits.
+type Dispatcher struct {
+	webhooks    *Webhooks
+	deliveries  *Deliveries
+	tasks       func(uuid.UUID) (*task.Task, error)
+	received    []pubsub.Event
+	lock        sync.Mutex
+	incoming    *todo.Todo
+	last        uint64 // sequence of the last handled event
+	queued      *todo.Todo
+	Client      *http.Client
+	MaxAttempts int           // A delivery fails after this number of attempts
+	Backoff     time.Duration // Delay before the first retry, doubled at each attempt
+	MaxBackoff  time.Duration
+	Retention   time.Duration // Finished deliveries are kept this long
+}
+
+// NewDispatcher uses webhooks and deliveries stores, and reads tasks for their own webhooks
+func NewDispatcher(webhooks *Webhooks, deliveries *Deliveries, tasks func(uuid.UUID) (*task.Task, error)) *Dispatcher {
+	return &Dispatcher{
+		webhooks:    webhooks,
+		deliveries:  deliveries,
+		tasks:       tasks,
+		received:    make([]pubsub.Event, 0),
+		incoming:    todo.New(),
+		queued:      todo.New(),
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 8,
+		Backoff:     10 * time.Second,
+		MaxBackoff:  time.Hour,
+		Retention:   7 * 24 * time.Hour,
+	}
+}
+
+// Start listening events, and sending deliveries, until the context is done
+func (d *Dispatcher) Start(ctx context.Context, ps *pubsub.PubSub) {
+	events := ps.Subscribe(ctx)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt := <-events:
+				d.lock.Lock()
+				d.received = append(d.received, evt)
+				d.lock.Unlock()
+				d.incoming.Ping()
+			}
+		}
+	}()
+	go d.persist(ctx, ps.Journal)
+	go d.loop(ctx)
+}
+
+// persist the deliveries of the received events
+func (d *Dispatcher) persist(ctx context.Context, journal *pubsub.Journal) {
+	for {
+		d.incoming.Done()
+		d.lock.Lock()
+		received := d.received
+		d.received = make([]pubsub.Event, 0)
+		d.lock.Unlock()
+		for _, evt := range received {
+			d.handle(journal, evt)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.incoming.Wait():
+		}
+	}
+}
+
+// handle an event, events dropped by the subscription are read from the journal
+func (d *Dispatcher) handle(journal *pubsub.Journal, evt pubsub.Event) {
+	if evt.Seq <= d.last { // already read from the journal
+		return
+	}
+	if journal != nil && d.last != 0 && evt.Seq > d.last+1 {
+		missed, err := journal.Since(d.last)
+		if err != nil {
+			log.WithError(err).WithField("since", d.last).Error("Can't read missed events")
+		}
+		for _, m := range missed {
+			if m.Seq < evt.Seq {
+				d.enqueueOrLog(m)
+			}
+		}
+	}
+	d.last = evt.Seq
+	d.enqueueOrLog(evt)
+}
+
+func (d *Dispatcher) enqueueOrLog(evt pubsub.Event) {
+	err := d.enqueue(evt)
+	if err != nil {
+		log.WithError(err).WithField("event", evt).Error("Can't queue webhook deliveries")
+	}
+}
+
+// enqueue deliveries of a transition
+func (d *Dispatcher) enqueue(evt pubsub.Event) error {
+	if evt.From == "" { // not a transition
+		return nil
+	}
+	queued := false
+	hooks, err := d.webhooks.List()
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		if (hook.Owner == "" || hook.Owner == evt.Owner) && hook.Wants(evt.To) {
+			err = d.queue(evt, hook.Owner, hook.Id, hook.Notify)
+			if err != nil {
+				return err
+			}
+			queued = true
+		}
+	}
+	t, err := d.tasks(evt.Id)
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		for _, notify := range t.Notify {
+			if notify.Wants(evt.To) {
+				err = d.queue(evt, t.Owner, uuid.Nil, notify)
+				if err != nil {
+					return err
+				}
+				queued = true
+			}
+		}
+	}
+	if queued {
+		d.queued.Ping()
+	}
+	return nil
+}
+
+func (d *Dispatcher) queue(evt pubsub.Event, owner string, hook uuid.UUID, notify task.Notify) error {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return d.deliveries.Put(&Delivery{
+		Id:          id,
+		Owner:       owner,
+		Webhook:     hook,
+		URL:         notify.URL,
+		Secret:      notify.Secret,
+		Event:       evt,
+		State:       Pending,
+		NextAttempt: now,
+		Created:     now,
+	})
+}
+
+func (d *Dispatcher) loop(ctx context.Context) {
+	for {
+		d.queued.Done()
+		next := d.sendDue(ctx)
+		err := d.deliveries.Trim(time.Now().Add(-d.Retention))
+		if err != nil {
+			log.WithError(err).Error("Can't trim webhook deliveries")
+		}
+		wait := time.Minute
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.queued.Wait():
+		case <-time.After(wait):
+		}
+	}
+}
+
+// sendDue sends the due deliveries, and returns the time of the next one
+func (d *Dispatcher) sendDue(ctx context.Context) time.Time {
+	for {
+		pending, next, err := d.deliveries.Due(time.Now())
+		if err != nil {
+			log.WithError(err).Error("Can't read webhook deliveries")
+			return next
+		}
+		if len(pending) == 0 || ctx.Err() != nil {
+			return next
+		}
+		for _, delivery := range pending {
+			d.send(ctx, delivery)
+		}
+	}
+}
+
+// send a delivery, and plan the next attempt if it fails
+func (d *Dispatcher) send(ctx context.Context, delivery *Delivery) {
+	delivery.Attempts++
+	err := d.post(ctx, delivery)
+	l := log.WithField("delivery", delivery.Id).WithField("url", delivery.URL).WithField("attempts", delivery.Attempts)
+	if err == nil {
+		delivery.State = Delivered
+		delivery.LastError = ""
+		l.Info("Webhook delivered")
+	} else {
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= d.MaxAttempts {
+			delivery.State = Failed
+			l.WithError(err).Error("Webhook delivery failed")
+		} else {
+			delivery.NextAttempt = time.Now().Add(d.backoff(delivery.Attempts))
+			l.WithError(err).Warning("Webhook delivery will be retried")
+		}
+	}
+	err = d.deliveries.Put(delivery)
+	if err != nil {
+		l.WithError(err).Error("Can't save webhook delivery")
+	}
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.Backoff
+	for i := 1; i < attempts && delay < d.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxBackoff {
+		delay = d.MaxBackoff
+	}
+	return delay
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery *Delivery) error {
+	payload, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("X-Density-Event", delivery.Event.Action)
+	req.Header.Set("X-Density-Delivery", delivery.Id.String())
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, payload))
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	delivery.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("Webhook answered %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/factorysh/density/pubsub"
+	"github.com/factorysh/density/store"
+	"github.com/factorysh/density/task"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func bucket(t *testing.T, s store.Store, name string) store.Store {
+	b, err := s.Bucket(name)
+	assert.NoError(t, err)
+	return b
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t, "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		Sign("key", []byte("The quick brown fox jumps over the lazy dog")))
+}
+
+func TestDispatcher(t *testing.T) {
+	lock := sync.Mutex{}
+	calls := 0
+	delivered := make(chan *http.Request, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+		if calls == 1 { // the first attempt fails
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, Sign("s3cr3t", body), r.Header.Get(SignatureHeader))
+		delivered <- r
+	}))
+	defer ts.Close()
+
+	s := store.NewMemoryStore()
+	webhooks := NewWebhooks(bucket(t, s, WebhooksBucket))
+	deliveries := NewDeliveries(bucket(t, s, DeliveriesBucket))
+	err := webhooks.Put(&Webhook{
+		Owner: "bob",
+		Notify: task.Notify{
+			URL:    ts.URL,
+			Events: []string{"done", "error"},
+			Secret: "s3cr3t",
+		},
+	})
+	assert.NoError(t, err)
+	// a task without its own webhook
+	tasks := func(uuid.UUID) (*task.Task, error) { return nil, nil }
+	d := NewDispatcher(webhooks, deliveries, tasks)
+	d.Backoff = 10 * time.Millisecond
+
+	ps := pubsub.NewPubSub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d.Start(ctx, ps)
+
+	id := uuid.New()
+	ps.Publish(pubsub.Event{Action: "Running", Id: id, Owner: "bob", From: "Waiting", To: "Running"})
+	ps.Publish(pubsub.Event{Action: "Done", Id: id, Owner: "alice", From: "Running", To: "Done"})
+	ps.Publish(pubsub.Event{Action: "Done", Id: id, Owner: "bob", From: "Running", To: "Done"})
+
+	select {
+	case r := <-delivered:
+		assert.Equal(t, "Done", r.Header.Get("X-Density-Event"))
+	case <-time.After(5 * time.Second):
+		t.Fatal("No delivery")
+	}
+	time.Sleep(50 * time.Millisecond)
+	all, err := deliveries.List(nil)
+	assert.NoError(t, err)
+	assert.Len(t, all, 1)
+	assert.Equal(t, Delivered, all[0].State)
+	assert.Equal(t, 2, all[0].Attempts)
+	assert.Equal(t, http.StatusOK, all[0].StatusCode)
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, nil, nil)
+	assert.Equal(t, 10*time.Second, d.backoff(1))
+	assert.Equal(t, 40*time.Second, d.backoff(3))
+	assert.Equal(t, time.Hour, d.backoff(20))
+}
+
+func TestDispatcherMissed(t *testing.T) {
+	s := store.NewMemoryStore()
+	webhooks := NewWebhooks(bucket(t, s, WebhooksBucket))
+	deliveries := NewDeliveries(bucket(t, s, DeliveriesBucket))
+	err := webhooks.Put(&Webhook{
+		Owner: "bob",
+		Notify: task.Notify{
+			URL:    "http://example.com",
+			Secret: "s3cr3t",
+		},
+	})
+	assert.NoError(t, err)
+	d := NewDispatcher(webhooks, deliveries, func(uuid.UUID) (*task.Task, error) { return nil, nil })
+	journal, err := pubsub.NewJournal(bucket(t, s, "events"), 100)
+	assert.NoError(t, err)
+	id := uuid.New()
+	for _, seq := range []uint64{1, 2, 3} {
+		err = journal.Append(pubsub.Event{Seq: seq, Action: "Done", Id: id, Owner: "bob", From: "Running", To: "Done"})
+		assert.NoError(t, err)
+	}
+	evts, err := journal.Since(0)
+	assert.NoError(t, err)
+	// the second event was dropped by the subscription, the third arrives twice
+	d.handle(journal, evts[0])
+	d.handle(journal, evts[2])
+	d.handle(journal, evts[1])
+	all, err := deliveries.List(nil)
+	assert.NoError(t, err)
+	assert.Len(t, all, 3)
+}
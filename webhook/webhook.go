@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/factorysh/density/store"
+	"github.com/factorysh/density/task"
+	"github.com/google/uuid"
+)
+
+// Buckets of the stores
+const (
+	WebhooksBucket   = "webhooks"
+	DeliveriesBucket = "deliveries"
+)
+
+// SignatureHeader is the HTTP header with the HMAC signature of the payload
+const SignatureHeader = "X-Density-Signature"
+
+// ErrUnknownWebhook is returned when deleting a webhook that doesn't exist
+var ErrUnknownWebhook = errors.New("Unknown webhook")
+
+// Webhook is called on transitions of all the tasks of an owner, every task if Owner is empty
+type Webhook struct {
+	Id    uuid.UUID `json:"id"`
+	Owner string    `json:"owner"`
+	task.Notify
+}
+
+// Sign a payload, with HMAC SHA256
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret returns a random secret
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// Webhooks stores Webhook
+type Webhooks struct {
+	store store.Store
+}
+
+// NewWebhooks uses a store
+func NewWebhooks(s store.Store) *Webhooks {
+	return &Webhooks{store: s}
+}
+
+// Get a Webhook, nil if it doesn't exist
+func (w *Webhooks) Get(id uuid.UUID) (*Webhook, error) {
+	v, err := w.store.Get([]byte(id.String()))
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, nil
+	}
+	var hook Webhook
+	err = json.Unmarshal(v, &hook)
+	if err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// Put a Webhook, an id is given to a new one
+func (w *Webhooks) Put(hook *Webhook) error {
+	if hook.Id == uuid.Nil {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return err
+		}
+		hook.Id = id
+	}
+	value, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+	return w.store.Put([]byte(hook.Id.String()), value)
+}
+
+// Delete a Webhook
+func (w *Webhooks) Delete(id uuid.UUID) error {
+	hook, err := w.Get(id)
+	if err != nil {
+		return err
+	}
+	if hook == nil {
+		return ErrUnknownWebhook
+	}
+	return w.store.Delete([]byte(id.String()))
+}
+
+// List all Webhooks, sorted by owner
+func (w *Webhooks) List() ([]*Webhook, error) {
+	hooks := make([]*Webhook, 0)
+	err := w.store.ForEach(func(k, v []byte) error {
+		var hook Webhook
+		err := json.Unmarshal(v, &hook)
+		if err != nil {
+			return err
+		}
+		hooks = append(hooks, &hook)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].Owner < hooks[j].Owner
+	})
+	return hooks, nil
+}